@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errLeaseGone is returned by the coordinator API once a lease was revoked or
+// its run canceled.
+var errLeaseGone = errors.New("lease is gone")
+
+// Agent run statuses reported in heartbeats.
+const (
+	statusPreparing = "preparing"
+	statusFuzzing   = "fuzzing"
+	statusReporting = "reporting"
+)
+
+// agent runs the fuzzing runs leased from a coordinator in local containers,
+// and sends their new corpus inputs and outcome back to the coordinator.
+type agent struct {
+	logger  *slog.Logger
+	cfg     *Config
+	runner  Runner
+	http    *http.Client
+	retrier *retrier
+
+	// pulledImages records the container images already pulled.
+	mu           sync.Mutex
+	pulledImages map[string]bool
+}
+
+// runAgent runs cfg.Fuzz.NumWorkers agent workers, each of which repeatedly
+// leases a fuzzing run from the coordinator and executes it, until ctx is
+// canceled. Failures are logged: when an agent stops reporting, the
+// coordinator re-queues its runs.
+func runAgent(ctx context.Context, logger *slog.Logger, cfg *Config) error {
+	runner, err := newRunner(logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := runner.Close(); err != nil {
+			logger.Error("Failed to close runner", "error", err)
+		}
+	}()
+
+	// Remove the containers left over by previous instances, and those
+	// of this instance on shutdown.
+	reapOrphans(ctx, logger, runner, cfg)
+	defer func() {
+		reapCtx, cancel := shutdownReapContext()
+		defer cancel()
+
+		reapOrphans(reapCtx, logger, runner, cfg)
+	}()
+
+	a := &agent{
+		logger:       logger.With("agent", cfg.Agent.Name),
+		cfg:          cfg,
+		runner:       runner,
+		http:         &http.Client{},
+		retrier:      newRetrier(logger, cfg),
+		pulledImages: make(map[string]bool),
+	}
+
+	a.logger.Info("Agent started", "coordinator",
+		SanitizeURL(cfg.Agent.CoordinatorURL), "workers",
+		cfg.Fuzz.NumWorkers)
+
+	var wg sync.WaitGroup
+	for workerID := 1; workerID <= cfg.Fuzz.NumWorkers; workerID++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runLoop(ctx, workerID)
+		}()
+	}
+	wg.Wait()
+
+	a.logger.Info("Agent stopped")
+
+	return nil
+}
+
+// runLoop leases and executes fuzzing runs until ctx is canceled, polling the
+// coordinator while it has no run to hand out.
+func (a *agent) runLoop(ctx context.Context, workerID int) {
+	logger := a.logger.With("workerID", workerID)
+
+	for {
+		lease, err := a.requestLease(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+
+		case err != nil:
+			logger.Warn("Failed to request a lease from the "+
+				"coordinator", "error", err)
+
+		case lease != nil:
+			err := a.runLease(ctx, logger, lease)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Leased fuzzing run failed",
+					"lease", lease.ID, "error", err)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(a.cfg.Agent.PollInterval):
+		}
+	}
+}
+
+// runLease executes a leased fuzzing run: it downloads the fuzz binary and
+// corpus, fuzzes the target until the lease timeout, and uploads the new
+// corpus inputs and the outcome of the run. Heartbeats keep the lease alive
+// throughout; if the coordinator revoked the lease, the run is abandoned.
+func (a *agent) runLease(ctx context.Context, logger *slog.Logger,
+	lease *Lease) error {
+
+	task := lease.Task
+	logger = logger.With("lease", lease.ID, "package", task.Package.Path,
+		"target", task.Target, "goVersion", task.GoVersion)
+	logger.Info("Starting leased fuzzing run", "timeout", lease.Timeout)
+
+	runDir := filepath.Join(a.cfg.Project.BinaryDir, lease.ID)
+	defer func() {
+		if err := os.RemoveAll(runDir); err != nil {
+			logger.Error("Failed to clean up run directory",
+				"error", err)
+		}
+	}()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var status atomic.Value
+	status.Store(statusPreparing)
+	var gone atomic.Bool
+	go a.sendHeartbeats(runCtx, logger, lease, &status, func() {
+		gone.Store(true)
+		cancel()
+	})
+
+	var metrics metricsRecorder
+	crash, err := a.fuzz(runCtx, logger, lease, runDir, &status, &metrics)
+
+	status.Store(statusReporting)
+
+	// The run log only helps debugging the run, so failing to upload it
+	// does not fail the run.
+	logErr := a.retrier.do(runCtx, "run log upload", func() error {
+		return a.uploadRunLog(runCtx, lease, runDir)
+	})
+	if logErr != nil {
+		logger.Error("Failed to upload run log", "error", logErr)
+	}
+	if err == nil {
+		err = a.retrier.do(runCtx, "corpus upload", func() error {
+			return a.uploadCorpus(runCtx, lease, runDir)
+		})
+	}
+
+	var res RunResult
+	if m := metrics.result(); m.Runs > 0 {
+		res.Metrics = &m
+	}
+
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+		res.Transient = isTransientError(err)
+
+	case crash != nil:
+		res.Crash = crashResult(crash, runDir)
+	}
+
+	if gone.Load() {
+		logger.Warn("Lease revoked by the coordinator; run abandoned")
+		return nil
+	}
+
+	err = a.retrier.do(runCtx, "run outcome report", func() error {
+		return a.postJSON(runCtx, leaseAPIPath(lease.ID, "result"), res)
+	})
+	if err != nil {
+		return fmt.Errorf("reporting run outcome: %w", err)
+	}
+
+	logger.Info("Completed leased fuzzing run", "crashed", crash != nil,
+		"error", res.Error)
+
+	return nil
+}
+
+// fuzz downloads the run bundle of the lease into runDir and runs the fuzz
+// target in a local container until the lease expires, recording the metrics of
+// the run in metrics. It returns the crash found, if any.
+func (a *agent) fuzz(ctx context.Context, logger *slog.Logger, lease *Lease,
+	runDir string, status *atomic.Value,
+	metrics *metricsRecorder) (*fuzzCrash, error) {
+
+	task := lease.Task
+
+	if err := a.downloadBundle(ctx, lease.ID, runDir); err != nil {
+		return nil, err
+	}
+
+	// The target may have no corpus yet, but the directory must exist to
+	// avoid permission errors when running the container as a non-root
+	// user.
+	corpusDir := filepath.Join(runDir, bundleCorpusPrefix)
+	if err := EnsureDirExists(corpusDir); err != nil {
+		return nil, err
+	}
+
+	image := lease.Image
+	if err := a.ensureImage(ctx, image); err != nil {
+		return nil, err
+	}
+
+	// Redact the secrets the coordinator redacts, and those of the agent,
+	// from the run log.
+	patterns, err := compileRedactPatterns(lease.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+	patterns = append(patterns, a.cfg.Fuzz.RedactRegexps...)
+
+	// The fuzzing time counts from when the lease was received, so that
+	// the run ends when the coordinator expects its outcome, however long
+	// the download and the pull took.
+	fuzzCtx, cancel := context.WithDeadline(ctx, lease.expires)
+	defer cancel()
+
+	status.Store(statusFuzzing)
+
+	c := &Container{
+		ctx:            fuzzCtx,
+		logger:         logger,
+		runner:         a.runner,
+		image:          image,
+		fuzzBinaryPath: filepath.Join(runDir, bundleBinaryPrefix),
+		hostCorpusPath: corpusDir,
+		cmd: fuzzCommand(task.Target,
+			lease.Limits.Parallel),
+		limits:   lease.Limits,
+		sandbox:  lease.Sandbox,
+		labels:   withOwnerLabels(a.cfg, lease.Labels),
+		hang:     lease.Hang,
+		logPath:  filepath.Join(runDir, AgentRunLogFile),
+		metrics:  metrics,
+		redactor: newRedactor(a.cfg, patterns),
+	}
+
+	return runContainer(c, task)
+}
+
+// crashResult converts a crash found in runDir into the crash reported to the
+// coordinator.
+func crashResult(crash *fuzzCrash, runDir string) *CrashResult {
+	cr := &CrashResult{
+		Kind:               crash.kind,
+		Detail:             crash.detail,
+		ErrorLogs:          crash.errorLogs,
+		StderrLogs:         crash.stderrLogs,
+		FailingInput:       []byte(crash.failingInput),
+		FailureFileAndLine: crash.failureFileAndLine,
+		Stack:              crash.stack,
+	}
+	for _, input := range crash.recentInputs {
+		cr.RecentInputs = append(cr.RecentInputs, []byte(input))
+	}
+
+	if crash.failingInputFile != "" {
+		fuzzDir := filepath.Join(runDir, bundleBinaryPrefix, "testdata",
+			"fuzz")
+		rel, err := filepath.Rel(fuzzDir, crash.failingInputFile)
+		if err == nil {
+			cr.FailingInputName = filepath.ToSlash(rel)
+		}
+	}
+
+	return cr
+}
+
+// ensureImage makes the given container image available according to the pull
+// policy, unless this agent already did so.
+func (a *agent) ensureImage(ctx context.Context, image string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pulledImages[image] {
+		return nil
+	}
+
+	err := ensureImage(ctx, a.logger, a.runner, image,
+		a.cfg.Fuzz.ImagePullPolicy)
+	if err != nil {
+		return err
+	}
+	a.pulledImages[image] = true
+
+	return nil
+}
+
+// sendHeartbeats renews the lease with the current run status every heartbeat
+// interval until ctx is done. If the coordinator reports the lease as gone,
+// onGone is called and heartbeats stop.
+func (a *agent) sendHeartbeats(ctx context.Context, logger *slog.Logger,
+	lease *Lease, status *atomic.Value, onGone func()) {
+
+	ticker := time.NewTicker(lease.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		hb := Heartbeat{Status: status.Load().(string)}
+		err := a.postJSON(ctx, leaseAPIPath(lease.ID, "heartbeat"), hb)
+		switch {
+		case errors.Is(err, errLeaseGone):
+			onGone()
+			return
+
+		case err != nil && ctx.Err() == nil:
+			logger.Warn("Failed to send heartbeat", "error", err)
+		}
+	}
+}
+
+// requestLease asks the coordinator for a fuzzing run. It returns nil if the
+// coordinator has no run to hand out.
+func (a *agent) requestLease(ctx context.Context) (*Lease, error) {
+	body, err := json.Marshal(LeaseRequest{Agent: a.cfg.Agent.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.call(ctx, http.MethodPost, "/v1/lease",
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := drainBody(resp.Body); err != nil {
+			a.logger.Error("Failed to close response body",
+				"error", err)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var lease Lease
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return nil, fmt.Errorf("decoding lease: %w", err)
+	}
+	lease.expires = time.Now().Add(lease.Timeout)
+
+	return &lease, nil
+}
+
+// downloadBundle downloads the fuzz binary, testdata and corpus of the lease
+// and extracts them into runDir.
+func (a *agent) downloadBundle(ctx context.Context, leaseID,
+	runDir string) error {
+
+	resp, err := a.call(ctx, http.MethodGet, leaseAPIPath(leaseID,
+		"bundle"), nil)
+	if err != nil {
+		return err
+	}
+
+	err = extractTarGz(resp.Body, runDir, bundleBinaryPrefix,
+		bundleCorpusPrefix)
+	if err != nil {
+		err = fmt.Errorf("extracting run bundle: %w", err)
+	}
+
+	return errors.Join(err, drainBody(resp.Body))
+}
+
+// uploadCorpus sends the corpus of the leased fuzz target in runDir, including
+// the inputs found during the run, to the coordinator.
+func (a *agent) uploadCorpus(ctx context.Context, lease *Lease,
+	runDir string) error {
+
+	target := lease.Task.Target
+	corpusDir := filepath.Join(runDir, bundleCorpusPrefix, target)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTarGz(pw, map[string]string{
+			target: corpusDir,
+		}))
+	}()
+
+	// The HTTP client closes the request body, which stops the archive
+	// writer if the request ends early.
+	resp, err := a.call(ctx, http.MethodPost, leaseAPIPath(lease.ID,
+		"corpus"), pr)
+	if err != nil {
+		return fmt.Errorf("uploading corpus: %w", err)
+	}
+
+	return drainBody(resp.Body)
+}
+
+// uploadRunLog sends the run log of the leased run in runDir, if the run
+// produced one, to the coordinator.
+func (a *agent) uploadRunLog(ctx context.Context, lease *Lease,
+	runDir string) error {
+
+	file, err := os.Open(filepath.Join(runDir, AgentRunLogFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening run log: %w", err)
+	}
+
+	// The HTTP client closes the request body.
+	resp, err := a.call(ctx, http.MethodPost, leaseAPIPath(lease.ID,
+		"log"), file)
+	if err != nil {
+		return fmt.Errorf("uploading run log: %w", err)
+	}
+
+	return drainBody(resp.Body)
+}
+
+// postJSON sends v as JSON to the given coordinator API path, discarding the
+// response.
+func (a *agent) postJSON(ctx context.Context, apiPath string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.call(ctx, http.MethodPost, apiPath,
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	return drainBody(resp.Body)
+}
+
+// call sends an authenticated request to the coordinator API. It returns
+// errLeaseGone if the coordinator reports the lease as gone, and an error for
+// any other unsuccessful status. Connection failures and server errors are
+// transient.
+func (a *agent) call(ctx context.Context, method, apiPath string,
+	body io.Reader) (*http.Response, error) {
+
+	endpoint := strings.TrimSuffix(a.cfg.Agent.CoordinatorURL, "/") +
+		apiPath
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Coordinator.AuthToken)
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, newTransientError(fmt.Errorf("%s %s: %w", method,
+			apiPath, err))
+	}
+	if resp.StatusCode < http.StatusMultipleChoices {
+		return resp, nil
+	}
+
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = errors.Join(err, drainBody(resp.Body))
+	if resp.StatusCode == http.StatusGone {
+		return nil, errLeaseGone
+	}
+
+	err = errors.Join(fmt.Errorf("%s %s: %s: %s", method, apiPath,
+		resp.Status, strings.TrimSpace(string(msg))), err)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		err = newTransientError(err)
+	}
+
+	return nil, err
+}
+
+// leaseAPIPath returns the coordinator API path of the given lease resource.
+func leaseAPIPath(leaseID, resource string) string {
+	return fmt.Sprintf("/v1/leases/%s/%s", leaseID, resource)
+}
+
+// drainBody discards the rest of a response body, so that the underlying
+// connection can be reused, and closes it.
+func drainBody(body io.ReadCloser) error {
+	_, err := io.Copy(io.Discard, body)
+	return errors.Join(err, body.Close())
+}
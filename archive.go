@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// writeTarGz writes a gzip-compressed tar archive to w. Each entry of dirs maps
+// a slash-separated prefix inside the archive to the directory whose contents
+// are stored under it. Missing directories are skipped, and only directories
+// and regular files are archived.
+func writeTarGz(w io.Writer, dirs map[string]string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	for prefix, dir := range dirs {
+		if err := addDirToTar(tw, prefix, dir); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar writer: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("closing gzip writer: %w", err)
+	}
+
+	return nil
+}
+
+// addDirToTar adds the contents of dir to the tar archive below prefix.
+func addDirToTar(tw *tar.Writer, prefix, dir string) error {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry,
+		walkErr error) error {
+
+		if walkErr != nil {
+			return walkErr
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("writing tar header for %q: %w", p,
+				err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return fmt.Errorf("opening file %q: %w", p, err)
+		}
+
+		_, err = io.Copy(tw, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("archiving file %q: %w", p, err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// extractTarGz extracts a gzip-compressed tar archive read from r into destDir.
+// Only entries below one of the given slash-separated prefixes are accepted,
+// and entries escaping destDir are rejected.
+func extractTarGz(r io.Reader, destDir string,
+	prefixes ...string) (err error) {
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("opening gzip stream: %w", err)
+	}
+	defer func() {
+		if closeErr := gr.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar stream: %w", err)
+		}
+
+		name := path.Clean(header.Name)
+		if !hasArchivePrefix(name, prefixes) {
+			return fmt.Errorf("unexpected archive entry %q",
+				header.Name)
+		}
+		fullPath := filepath.Join(destDir, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := EnsureDirExists(fullPath); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			err := writeFileAtomic(tr, fullPath,
+				header.FileInfo().Mode())
+			if err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unsupported archive entry %q",
+				header.Name)
+		}
+	}
+}
+
+// hasArchivePrefix reports whether the cleaned, slash-separated archive entry
+// name lies below one of the given prefixes.
+func hasArchivePrefix(name string, prefixes []string) bool {
+	if path.IsAbs(name) || name == ".." ||
+		strings.HasPrefix(name, "../") {
+
+		return false
+	}
+
+	for _, prefix := range prefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// crashKind classifies the crashes found by fuzzing.
+type crashKind string
+
+const (
+	// crashKindFailure is a failure reported by the fuzzer that could not
+	// be classified further.
+	crashKindFailure crashKind = ""
+
+	// crashKindPanic is a panic of the fuzz target.
+	crashKindPanic crashKind = "panic"
+
+	// crashKindTestFailure is a failure reported by the fuzz target itself
+	// with t.Error, t.Fatal or one of their variants.
+	crashKindTestFailure crashKind = "test-failure"
+
+	// crashKindFatalError is an unrecoverable error of the Go runtime,
+	// such as concurrent map writes or a stack overflow.
+	crashKindFatalError crashKind = "fatal-error"
+
+	// crashKindDataRace is a data race found by the race detector.
+	crashKindDataRace crashKind = "data-race"
+
+	// crashKindSanitizer is an error reported by a sanitizer, such as
+	// AddressSanitizer or MemorySanitizer.
+	crashKindSanitizer crashKind = "sanitizer"
+
+	// crashKindSeedCorpus is a failure of an entry of the seed corpus,
+	// added with f.Add or read from testdata, before fuzzing began.
+	crashKindSeedCorpus crashKind = "seed-corpus"
+
+	// crashKindOOM is a run that ran out of memory: killed for exceeding
+	// its memory limit, or stopped by a failed allocation.
+	crashKindOOM crashKind = "oom"
+
+	// crashKindHang is a run that stopped making progress, or a fuzz
+	// worker that stopped responding to the fuzzer.
+	crashKindHang crashKind = "hang"
+)
+
+// label returns the GitHub label of the issues of crashes of this kind, or an
+// empty string for unclassified failures.
+func (k crashKind) label() string {
+	switch k {
+	case crashKindFailure:
+		return ""
+
+	case crashKindOOM:
+		return "out-of-memory"
+
+	default:
+		return string(k)
+	}
+}
+
+var (
+	// panicRegex matches the first line of a panic, capturing the panic
+	// value without the note of a recovered and repanicked panic. The
+	// testing package reports the panics of fuzz workers as errors.
+	//
+	// It matches lines like:
+	//   "panic: runtime error: index out of range [3] with length 3"
+	//   "    panic: boom [recovered]"
+	//   "        testing.go:1591: panic: boom"
+	panicRegex = regexp.MustCompile(
+		`^\s*(?:testing\.go:[0-9]+: )?panic: (?P<value>.*?)` +
+			`(?: \[recovered[^\]]*\])?$`,
+	)
+
+	// fatalErrorRegex matches an unrecoverable error of the Go runtime,
+	// capturing its message.
+	//
+	// It matches lines like:
+	//   "fatal error: concurrent map writes"
+	fatalErrorRegex = regexp.MustCompile(
+		`^\s*fatal error: (?P<message>.+)$`,
+	)
+
+	// sanitizerRegex matches the report of a sanitizer, capturing the
+	// sanitizer and the kind of error it found.
+	//
+	// It matches lines like:
+	//   "==42==ERROR: AddressSanitizer: heap-use-after-free on address"
+	sanitizerRegex = regexp.MustCompile(
+		`(?:ERROR|WARNING): (?P<sanitizer>\w+Sanitizer)` +
+			`(?:: (?P<error>\S+))?`,
+	)
+
+	// seedCorpusRegex matches the failure of a seed corpus entry, capturing
+	// the entry.
+	//
+	// It matches lines like:
+	//   "failure while testing seed corpus entry: FuzzFoo/seed#0"
+	seedCorpusRegex = regexp.MustCompile(
+		`failure while testing seed corpus entry: ` +
+			`[^/\s]+/(?P<entry>\S+)`,
+	)
+
+	// testFailureRegex matches a message logged by the fuzz target with
+	// t.Error, t.Fatal or one of their variants, which is prefixed with the
+	// base name of the file and the line it was logged at, unlike the
+	// frames of stack traces.
+	//
+	// It matches lines like:
+	//   "    stringutils_test.go:17: Reverse produced invalid UTF-8 string"
+	testFailureRegex = regexp.MustCompile(`^\s*[^\s/:]+\.go:[0-9]+: `)
+)
+
+// dataRaceMarkers are printed by the race detector when it finds a data race,
+// and by the testing package when a test raced.
+var dataRaceMarkers = []string{
+	"WARNING: DATA RACE",
+	"race detected during execution of test",
+}
+
+// crashClassifier classifies a failure from the output that follows its report
+// by the testing package, keeping the first details of each kind it sees.
+type crashClassifier struct {
+	panicValue  string
+	panicked    bool
+	fatalError  string
+	outOfMemory bool
+	dataRace    bool
+	sanitizer   string
+	seedEntry   string
+	testFailure bool
+	hungWorker  bool
+	timedOut    bool
+}
+
+// observe records the signs of a crash kind in an output line.
+func (c *crashClassifier) observe(line string) {
+	if !c.panicked {
+		if m := panicRegex.FindStringSubmatch(line); m != nil {
+			c.panicked = true
+			c.panicValue = m[1]
+		}
+	}
+
+	if m := fatalErrorRegex.FindStringSubmatch(line); m != nil &&
+		c.fatalError == "" {
+
+		c.fatalError = m[1]
+	}
+
+	// A failed allocation makes the fuzz target crash with a Go runtime
+	// error rather than a failure of its own.
+	if strings.Contains(line, outOfMemoryMarker) {
+		c.outOfMemory = true
+	}
+
+	for _, marker := range dataRaceMarkers {
+		if strings.Contains(line, marker) {
+			c.dataRace = true
+		}
+	}
+
+	if m := sanitizerRegex.FindStringSubmatch(line); m != nil &&
+		c.sanitizer == "" {
+
+		c.sanitizer = m[1]
+		if m[2] != "" {
+			c.sanitizer += ": " + m[2]
+		}
+	}
+
+	if m := seedCorpusRegex.FindStringSubmatch(line); m != nil &&
+		c.seedEntry == "" {
+
+		c.seedEntry = m[1]
+	}
+
+	if testFailureRegex.MatchString(line) {
+		c.testFailure = true
+	}
+
+	// The fuzzer reports workers that hung and workers that crashed
+	// alike; only the latter print a panic or fatal error.
+	if strings.Contains(line, hungWorkerMarker) {
+		c.hungWorker = true
+	}
+
+	if strings.HasPrefix(line, testTimeoutMarker) {
+		c.timedOut = true
+	}
+}
+
+// classify returns the kind of the crash and its detail: the panic value of
+// panics, the message of fatal errors, the sanitizer and error of sanitizer
+// reports, and the failing entry (e.g. seed#2) of seed corpus failures,
+// followed by how it failed (e.g. "seed#2: panic: boom").
+//
+// Kinds that explain the others come first: a failed allocation is a fatal
+// error and a race makes the test fail, for example. A failing seed corpus
+// entry is reported as such whatever made it fail, since it fails before
+// fuzzing begins.
+func (c *crashClassifier) classify() (crashKind, string) {
+	crashed := c.panicked || c.fatalError != "" || c.dataRace ||
+		c.sanitizer != ""
+
+	switch {
+	case c.outOfMemory:
+		return crashKindOOM, ""
+
+	// The testing package panics once the test binary ran too long.
+	case c.timedOut:
+		return crashKindHang, ""
+
+	case c.hungWorker && !crashed:
+		return crashKindHang, ""
+
+	case c.seedEntry != "":
+		return crashKindSeedCorpus, c.seedCorpusDetail()
+
+	case c.dataRace:
+		return crashKindDataRace, ""
+
+	case c.sanitizer != "":
+		return crashKindSanitizer, c.sanitizer
+
+	case c.fatalError != "":
+		return crashKindFatalError, c.fatalError
+
+	case c.panicked:
+		return crashKindPanic, c.panicValue
+
+	case c.testFailure:
+		return crashKindTestFailure, ""
+
+	default:
+		return crashKindFailure, ""
+	}
+}
+
+// seedCorpusDetail returns the detail of a seed corpus failure: the failing
+// entry, followed by the kind of the failure and its detail, if classified.
+func (c *crashClassifier) seedCorpusDetail() string {
+	cause := *c
+	cause.seedEntry = ""
+	kind, detail := cause.classify()
+
+	switch {
+	case kind == crashKindFailure:
+		return c.seedEntry
+
+	case kind == crashKindPanic:
+		return fmt.Sprintf("%s: panic: %s", c.seedEntry, detail)
+
+	case kind == crashKindFatalError:
+		return fmt.Sprintf("%s: fatal error: %s", c.seedEntry, detail)
+
+	case detail != "":
+		return fmt.Sprintf("%s: %s: %s", c.seedEntry, kind, detail)
+
+	default:
+		return fmt.Sprintf("%s: %s", c.seedEntry, kind)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCrashClassifier verifies that failures are classified from the output
+// following their report, with the detail of each kind, and that the kinds
+// explaining the others take precedence.
+func TestCrashClassifier(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		expectedKind   crashKind
+		expectedDetail string
+	}{
+		{
+			name: "panic",
+			output: "    panic: runtime error: index out of " +
+				"range [3] with length 3 [recovered]\n" +
+				"    goroutine 7 [running]:\n" +
+				"    panic({0x5a4d20?, 0xc000012345?})\n",
+			expectedKind: crashKindPanic,
+			expectedDetail: "runtime error: index out of range " +
+				"[3] with length 3",
+		},
+		{
+			name: "fuzz worker panic",
+			output: "        testing.go:1591: panic: boom\n" +
+				"            goroutine 17 [running]:\n",
+			expectedKind:   crashKindPanic,
+			expectedDetail: "boom",
+		},
+		{
+			name: "test failure",
+			output: "    stringutils_test.go:17: Reverse " +
+				"produced invalid UTF-8 string\n",
+			expectedKind: crashKindTestFailure,
+		},
+		{
+			name: "stack overflow",
+			output: "runtime: goroutine stack exceeds " +
+				"1000000000-byte limit\n" +
+				"fatal error: stack overflow\n",
+			expectedKind:   crashKindFatalError,
+			expectedDetail: "stack overflow",
+		},
+		{
+			name: "concurrent map writes",
+			output: "fatal error: concurrent map writes\n" +
+				"goroutine 9 [running]:\n",
+			expectedKind:   crashKindFatalError,
+			expectedDetail: "concurrent map writes",
+		},
+		{
+			name: "data race",
+			output: "WARNING: DATA RACE\n" +
+				"    testing.go:1490: race detected during " +
+				"execution of test\n",
+			expectedKind: crashKindDataRace,
+		},
+		{
+			name: "sanitizer",
+			output: "==42==ERROR: AddressSanitizer: " +
+				"heap-use-after-free on address 0x6020\n",
+			expectedKind:   crashKindSanitizer,
+			expectedDetail: "AddressSanitizer: heap-use-after-free",
+		},
+		{
+			name: "seed corpus panic",
+			output: "    failure while testing seed corpus " +
+				"entry: FuzzFoo/seed#2\n" +
+				"    panic: boom\n",
+			expectedKind:   crashKindSeedCorpus,
+			expectedDetail: "seed#2: panic: boom",
+		},
+		{
+			name: "seed corpus test failure",
+			output: "    failure while testing seed corpus " +
+				"entry: FuzzFoo/seed#0\n" +
+				"    stringutils_test.go:17: invalid\n",
+			expectedKind:   crashKindSeedCorpus,
+			expectedDetail: "seed#0: test-failure",
+		},
+		{
+			name: "out of memory",
+			output: "    fatal error: runtime: out of memory\n" +
+				"    stringutils_test.go:17\n",
+			expectedKind: crashKindOOM,
+		},
+		{
+			name: "hung worker",
+			output: "    fuzzing process hung or terminated " +
+				"unexpectedly: exit status 2\n",
+			expectedKind: crashKindHang,
+		},
+		{
+			name: "test timeout",
+			output: "panic: test timed out after 10m0s\n" +
+				"goroutine 8 [running]:\n",
+			expectedKind: crashKindHang,
+		},
+		{
+			name:         "unclassified",
+			output:       "    exit status 1\n",
+			expectedKind: crashKindFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c crashClassifier
+			lines := strings.Split(tt.output, "\n")
+			for _, line := range lines {
+				c.observe(line)
+			}
+
+			kind, detail := c.classify()
+			assert.Equal(t, tt.expectedKind, kind)
+			assert.Equal(t, tt.expectedDetail, detail)
+		})
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -27,12 +29,16 @@ const (
 	// binaries are located.
 	TmpBinaryDir = "binaries"
 
+	// TmpShardDir is the temporary directory where the fuzz cache
+	// directories of sharded fuzz targets are located.
+	TmpShardDir = "shards"
+
 	// ConfigFilename is the filename for the go-continuous-fuzz
 	// configuration file.
 	ConfigFilename = "go-continuous-fuzz.conf"
 
-	// ContainerImage specifies the Docker image to use for running the
-	// container.
+	// ContainerImage specifies the default Docker image to use for running
+	// the container when the local toolchain is selected.
 	ContainerImage = "golang:1.24.6"
 
 	// ContainerWorkDir specifies the working directory for the fuzz
@@ -48,9 +54,24 @@ const (
 	// sufficient time to complete.
 	ContainerGracePeriod = 20 * time.Second
 
+	// MinRestartTime is the minimum fuzzing time left in a target's time
+	// slice for it to be restarted after a crash.
+	MinRestartTime = 30 * time.Second
+
 	// LogFilename is the filename where go-continuous-fuzz writes its log
 	// output, in addition to writing it to stdout.
 	LogFilename = "gcf.log"
+
+	// ModeStandalone runs discovery, scheduling, fuzzing and reporting in a
+	// single process.
+	ModeStandalone = "standalone"
+
+	// ModeCoordinator owns discovery, the task queue, the corpus and the
+	// reports, and hands the fuzzing runs to remote agents.
+	ModeCoordinator = "coordinator"
+
+	// ModeAgent runs the fuzzing runs leased from a coordinator.
+	ModeAgent = "agent"
 )
 
 var (
@@ -81,9 +102,11 @@ var (
 type Project struct {
 	WorkSpacePath string `long:"workspace-path" description:"Absolute path to the directory where go-continuous-fuzz generated files are stored"`
 
-	SrcRepo string `long:"src-repo" description:"Git repo URL of the project to fuzz" required:"true"`
+	SrcRepo string `long:"src-repo" description:"Git repo URL of the project to fuzz"`
 
-	S3BucketName string `long:"s3-bucket-name" description:"Name of the S3 bucket where the seed corpus will be stored" required:"true"`
+	S3BucketName string `long:"s3-bucket-name" description:"Name of the S3 bucket where the seed corpus will be stored"`
+
+	ReportURL string `long:"report-url" description:"Public base URL the reports uploaded to the S3 bucket are served from, used to link run logs from issues; defaults to s3:// URLs"`
 
 	// SrcDir contains the absolute path to the directory where the project
 	// to fuzz is located.
@@ -103,6 +126,16 @@ type Project struct {
 	// BinaryDir contains the absolute path to the directory where the
 	// fuzz target binaries are located.
 	BinaryDir string
+
+	// ShardDir contains the absolute path to the directory where the fuzz
+	// cache directories of the shards of sharded fuzz targets are located.
+	ShardDir string
+
+	// GoWork contains the value of GOWORK used for every go command run
+	// inside the project: the path to the project's go.work file, or "off"
+	// if the project does not use a workspace. It is detected after each
+	// clone.
+	GoWork string
 }
 
 // Fuzz defines all fuzzing-related flags and defaults, including the Git
@@ -111,9 +144,9 @@ type Project struct {
 //
 //nolint:lll
 type Fuzz struct {
-	CrashRepo string `long:"crash-repo" description:"Git repository URL where issues are created for fuzz crashes" required:"true"`
+	CrashRepo string `long:"crash-repo" description:"Git repository URL where issues are created for fuzz crashes"`
 
-	PkgsPath []string `long:"pkgs-path" description:"List of package paths to fuzz" required:"true"`
+	PkgsPath []string `long:"pkgs-path" description:"List of package paths to fuzz, relative to the project root; a path ending in /... selects every package below it, including nested modules"`
 
 	SyncFrequency time.Duration `long:"sync-frequency" description:"Duration between consecutive fuzzing cycles" default:"24h"`
 
@@ -122,6 +155,121 @@ type Fuzz struct {
 	CorpusMinimizeInterval time.Duration `long:"corpus-minimize-interval" description:"Interval between consecutive corpus minimizations" default:"7d"`
 
 	Iterations int `long:"iterations" description:"Number of fuzzing cycles to run (0 means to run forever)" default:"0"`
+
+	GoToolchain string `long:"go-toolchain" description:"Go toolchain used to build and run fuzz targets: 'local' (host toolchain and default image), 'gomod' (version from the module's go.mod) or an explicit Go version such as 1.24.6" default:"local"`
+
+	GoVersions []string `long:"go-versions" description:"Fuzz every target once per listed Go version (fuzzing matrix); overrides go-toolchain"`
+
+	Image string `long:"image" description:"Container image the fuzz targets built with the local toolchain run in; may be pinned by digest, such as golang:1.24.6@sha256:<digest>" default:"golang:1.24.6"`
+
+	TargetImages map[string]string `long:"target-image" description:"Container image of a package or fuzz target as <pkg>[/<target>]:<image>, for targets that need extra system libraries; a target's entry takes precedence over its package's, and both over the image of the Go version"`
+
+	ImagePullPolicy string `long:"image-pull-policy" description:"When container images are pulled: 'always' at every cycle, 'if-not-present' only when missing from the runtime, 'never' for hosts with pre-loaded images" choice:"always" choice:"if-not-present" choice:"never" default:"always"`
+
+	MaxAttempts int `long:"max-attempts" description:"Maximum number of attempts for operations failing with transient errors (Docker, log stream or GitHub hiccups)" default:"3"`
+
+	RetryBackoff time.Duration `long:"retry-backoff" description:"Delay before the first retry of a transient failure; doubles after every attempt" default:"5s"`
+
+	RetryMaxBackoff time.Duration `long:"retry-max-backoff" description:"Maximum delay between retries of a transient failure" default:"1m"`
+
+	TargetWeights map[string]float64 `long:"target-weight" description:"Scheduling weight of a fuzz target as <pkg>/<target>:<weight>; targets default to a weight of 1"`
+
+	StalenessWeight float64 `long:"priority-staleness-weight" description:"Priority added per day since a target was last fuzzed" default:"1"`
+
+	ChangeWeight float64 `long:"priority-change-weight" description:"Priority added when a target's package changed since it was last fuzzed" default:"2"`
+
+	OpenIssueWeight float64 `long:"priority-open-issue-weight" description:"Priority added when a crash issue is open for a target (negative values deprioritize it)" default:"-1"`
+
+	DiscoveryWeight float64 `long:"priority-discovery-weight" description:"Priority added when a target found new interesting inputs the last time it was fuzzed" default:"1"`
+
+	AgingWeight float64 `long:"priority-aging-weight" description:"Priority added per hour a target waits to be fuzzed again" default:"1"`
+
+	ContinueAfterCrash bool `long:"continue-after-crash" description:"After reporting a crash, restart the fuzz target for the rest of its time slice, excluding the crashers already seen; time left when restarting is pointless goes to the remaining targets"`
+
+	SignatureDepth int `long:"signature-depth" description:"Number of topmost project frames of a crash's stack trace, skipping runtime, testing and fuzzing harness frames, that identify the crash for deduplication" default:"3"`
+
+	SignatureIgnoreLines bool `long:"signature-ignore-lines" description:"Leave the line numbers out of the stack frames identifying a crash, so that edits moving the code keep its crashes deduplicated"`
+
+	ProgressTimeout time.Duration `long:"progress-timeout" description:"Time without fuzzer progress lines after which a fuzz target is reported as hung, after dumping its goroutines; 0 disables the check" default:"5m"`
+
+	StallTimeout time.Duration `long:"stall-timeout" description:"Time the fuzzer's execution count may stall before the fuzz target is reported as hung; with several fuzzing workers, one stuck worker does not stall the count; 0 disables the check" default:"1m"`
+
+	InputTimeout time.Duration `long:"input-timeout" description:"Time a single corpus input may run during coverage measurement and corpus minimization before it is reported as a hang" default:"1m"`
+
+	LogRetention time.Duration `long:"log-retention" description:"Time the archived raw output of the fuzzing runs is kept in the S3 bucket; 0 keeps it forever" default:"720h"`
+
+	TargetShards map[string]int `long:"target-shards" description:"Number of parallel shards a fuzz target is fuzzed with as <pkg>/<target>:<shards>, each taking one worker; targets default to a single shard"`
+
+	ShardSyncInterval time.Duration `long:"shard-sync-interval" description:"Interval at which the shards of a sharded fuzz target exchange new interesting inputs" default:"10m"`
+
+	ContainerMemory string `long:"container-memory" description:"Memory limit of a fuzzing container, such as 512m or 4g; 0 means unlimited" default:"2g"`
+
+	ContainerCPUs float64 `long:"container-cpus" description:"Number of CPUs a fuzzing container may use; containers run at once as long as their CPUs fit into num-workers" default:"1"`
+
+	ContainerPidsLimit int64 `long:"container-pids-limit" description:"Maximum number of processes in a fuzzing container; 0 means unlimited" default:"0"`
+
+	ContainerTmpfsSize string `long:"container-tmpfs-size" description:"Size of the tmpfs mounted at /tmp, which holds the Go build cache, in fuzzing containers, such as 512m; empty means no tmpfs"`
+
+	Parallel int `long:"parallel" description:"Number of fuzzing processes in a fuzzing container (-test.parallel)" default:"1"`
+
+	Resources map[string]string `long:"resources" description:"Container resources of a package or fuzz target as <pkg>[/<target>]:<key>=<value>[,...] with the keys memory, cpus, pids, tmpfs and parallel; unset keys keep the global values, and a target's entry takes precedence over its package's"`
+
+	Sandbox string `long:"sandbox" description:"Security profile of fuzzing containers: 'default' keeps Docker's defaults, 'hardened' disables networking, mounts the root filesystem read-only with a tmpfs at /tmp, drops all capabilities and forbids privilege escalation" choice:"default" choice:"hardened" default:"default"`
+
+	SeccompProfile string `long:"seccomp-profile" description:"Path to the seccomp profile (JSON) of hardened fuzzing containers; empty uses the daemon's default profile"`
+
+	UsernsMode string `long:"userns-mode" description:"User namespace mode of hardened fuzzing containers, such as 'host'; empty uses the daemon's default"`
+
+	NetworkTargets []string `long:"network-target" description:"Package or fuzz target, as <pkg> or <pkg>/<target>, whose hardened containers keep the default network"`
+
+	Runtime string `long:"runtime" description:"Runtime the fuzz targets run in: 'docker', 'podman' (through its Docker-compatible API) or 'process' (plain processes on the host, without isolation)" choice:"docker" choice:"podman" choice:"process" default:"docker"`
+
+	RuntimeHost string `long:"runtime-host" description:"Address of the Docker or Podman API, such as unix:///run/user/1000/podman/podman.sock; empty uses DOCKER_HOST for Docker, and CONTAINER_HOST or the default Podman socket for Podman"`
+
+	ProcessCgroup string `long:"process-cgroup" description:"Delegated cgroup v2 directory under which the process runtime creates a cgroup per fuzzing run to enforce its CPU, memory and process limits; empty limits only the memory, with rlimits"`
+
+	CrashMinimizeTime time.Duration `long:"crash-minimize-time" description:"Time spent shrinking the failing input of a new crash before its issue is filed, by rerunning the fuzz target on smaller inputs that still crash with the same signature; 0 disables minimization" default:"1m"`
+
+	RedactPatterns []string `long:"redact-pattern" description:"Regular expression of secrets to redact from crash reports, issue comments, run logs and cycle reports, in addition to the built-in patterns for credentials in URLs, AWS keys and GitHub tokens; a group named 'secret' limits the redaction to the text it matches"`
+
+	// SeccompProfileJSON holds the contents of the seccomp profile.
+	SeccompProfileJSON string
+
+	// RedactRegexps holds the compiled redaction patterns.
+	RedactRegexps []*regexp.Regexp
+
+	// DefaultLimits holds the container resources of the fuzz targets
+	// without a resources entry, resolved from the global options.
+	DefaultLimits ResourceLimits
+
+	// Limits holds the container resources of the packages and fuzz
+	// targets with a resources entry, keyed like the entries.
+	Limits map[string]ResourceLimits
+}
+
+// Coordinator holds the options of the HTTP API through which a coordinator
+// hands fuzzing runs to agents. The authentication token is shared by the
+// coordinator and its agents.
+//
+//nolint:lll
+type Coordinator struct {
+	ListenAddr string `long:"listen" description:"Address the coordinator API listens on" default:"127.0.0.1:8470"`
+
+	AuthToken string `long:"auth-token" description:"Shared secret authenticating agents to the coordinator; required in coordinator and agent modes"`
+
+	LeaseTimeout time.Duration `long:"lease-timeout" description:"Time without heartbeat after which a run leased to an agent is re-queued for another agent" default:"1m"`
+}
+
+// Agent holds the options of an agent, which runs the fuzzing runs leased from
+// a coordinator.
+//
+//nolint:lll
+type Agent struct {
+	CoordinatorURL string `long:"coordinator-url" description:"Base URL of the coordinator API" default:"http://127.0.0.1:8470"`
+
+	Name string `long:"name" description:"Name identifying the agent in the coordinator logs (defaults to the host name)"`
+
+	PollInterval time.Duration `long:"poll-interval" description:"Delay between lease requests while the coordinator has no run to hand out" default:"10s"`
 }
 
 // Config encapsulates all top-level configuration parameters required to run
@@ -129,12 +277,26 @@ type Fuzz struct {
 //  1. Command-line flags.
 //  2. CONF file (ConfigFile).
 //  3. Default
+//
+//nolint:lll
 type Config struct {
 	LogDir string `long:"logdir" description:"Directory to log output."`
 
+	Mode string `long:"mode" description:"Role of the process: 'standalone' fuzzes locally, 'coordinator' hands the fuzzing runs to agents, 'agent' runs the fuzzing runs leased from a coordinator" choice:"standalone" choice:"coordinator" choice:"agent" default:"standalone"`
+
 	Project Project `group:"Project" namespace:"project"`
 
 	Fuzz Fuzz `group:"Fuzz Options" namespace:"fuzz"`
+
+	Coordinator Coordinator `group:"Coordinator Options" namespace:"coordinator"`
+
+	Agent Agent `group:"Agent Options" namespace:"agent"`
+
+	// DaemonID identifies the daemon across restarts, and InstanceID this
+	// process of it. They label the fuzzing containers, so that the
+	// containers left over by previous instances can be removed.
+	DaemonID   string
+	InstanceID string
 }
 
 // loadConfig reads configuration values from
@@ -181,13 +343,30 @@ func loadConfig() (*Config, error) {
 		return nil, fmt.Errorf("create logs directory: %w", err)
 	}
 
+	// Agents only run the fuzzing runs leased from a coordinator, so the
+	// project and its fuzz targets are only required in the other modes.
+	if cfg.Mode != ModeAgent {
+		if err := validateRequired(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateDistributedConfig(&cfg); err != nil {
+		return nil, err
+	}
+
 	// Validate the number of workers to ensure it is within the allowed
-	// range.
+	// range. A coordinator runs no fuzz targets itself: its workers only
+	// wait for the agents, so their number is the total number of
+	// concurrent runs across all agents and is not capped.
 	maxProcs := runtime.NumCPU()
+	if cfg.Mode == ModeCoordinator {
+		maxProcs = math.MaxInt
+	}
 	if cfg.Fuzz.NumWorkers <= 0 || cfg.Fuzz.NumWorkers > maxProcs {
 		return nil, fmt.Errorf("invalid number of workers: %d, "+
 			"allowed range is [1, %d]", cfg.Fuzz.NumWorkers,
-			runtime.NumCPU())
+			maxProcs)
 	}
 
 	// Ensure iterations are non-negative.
@@ -196,13 +375,115 @@ func loadConfig() (*Config, error) {
 			"must be non-negative", cfg.Fuzz.Iterations)
 	}
 
-	// Extract the repository name from the source URL and use it to set the
-	// corpus key and corpus directory.
-	repo, err := extractRepo(cfg.Project.SrcRepo)
+	// Ensure at least one attempt is made and the retry backoff is sane.
+	if cfg.Fuzz.MaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid max attempts: %d, must be at "+
+			"least 1", cfg.Fuzz.MaxAttempts)
+	}
+	if cfg.Fuzz.RetryBackoff < 0 ||
+		cfg.Fuzz.RetryMaxBackoff < cfg.Fuzz.RetryBackoff {
+
+		return nil, fmt.Errorf("invalid retry backoff: %s (max %s), "+
+			"must be non-negative and not exceed the maximum",
+			cfg.Fuzz.RetryBackoff, cfg.Fuzz.RetryMaxBackoff)
+	}
+
+	// Ensure target weights and the aging weight are non-negative, so that
+	// waiting tasks never lose priority.
+	for key, weight := range cfg.Fuzz.TargetWeights {
+		if weight < 0 {
+			return nil, fmt.Errorf("invalid weight %v for target "+
+				"%q: must be non-negative", weight, key)
+		}
+	}
+	if cfg.Fuzz.AgingWeight < 0 {
+		return nil, fmt.Errorf("invalid priority aging weight: %v, "+
+			"must be non-negative", cfg.Fuzz.AgingWeight)
+	}
+
+	// Every shard of a sharded target takes a worker, so a target can never
+	// have more shards than there are workers. Shards restart to exchange
+	// inputs, which is pointless if they barely fuzz in between.
+	for key, shards := range cfg.Fuzz.TargetShards {
+		if shards < 1 || shards > cfg.Fuzz.NumWorkers {
+			return nil, fmt.Errorf("invalid number of shards %d "+
+				"for target %q: allowed range is [1, %d]",
+				shards, key, cfg.Fuzz.NumWorkers)
+		}
+	}
+	if cfg.Fuzz.ProgressTimeout < 0 || cfg.Fuzz.StallTimeout < 0 {
+		return nil, fmt.Errorf("invalid hang timeouts: progress "+
+			"timeout %s, stall timeout %s, must not be negative",
+			cfg.Fuzz.ProgressTimeout, cfg.Fuzz.StallTimeout)
+	}
+	if cfg.Fuzz.InputTimeout <= 0 {
+		return nil, fmt.Errorf("invalid input timeout: %s, must be "+
+			"positive", cfg.Fuzz.InputTimeout)
+	}
+	if cfg.Fuzz.SignatureDepth < 1 {
+		return nil, fmt.Errorf("invalid signature depth: %d, must be "+
+			"at least 1", cfg.Fuzz.SignatureDepth)
+	}
+	if cfg.Fuzz.LogRetention < 0 {
+		return nil, fmt.Errorf("invalid log retention: %s, must not "+
+			"be negative", cfg.Fuzz.LogRetention)
+	}
+	if cfg.Fuzz.CrashMinimizeTime < 0 {
+		return nil, fmt.Errorf("invalid crash minimize time: %s, "+
+			"must not be negative", cfg.Fuzz.CrashMinimizeTime)
+	}
+	if cfg.Fuzz.ShardSyncInterval < MinRestartTime {
+		return nil, fmt.Errorf("invalid shard sync interval: %s, "+
+			"must be at least %s", cfg.Fuzz.ShardSyncInterval,
+			MinRestartTime)
+	}
+
+	// Resolve the container resources of the fuzz targets.
+	if err := parseResourceLimits(&cfg.Fuzz); err != nil {
+		return nil, err
+	}
+
+	// The process runtime has no way to enforce the hardened sandbox.
+	if cfg.Fuzz.Runtime == RuntimeProcess &&
+		cfg.Fuzz.Sandbox == SandboxHardened {
+
+		return nil, fmt.Errorf("the %s sandbox is not supported by "+
+			"the %s runtime", SandboxHardened, RuntimeProcess)
+	}
+
+	// Load the seccomp profile of hardened containers.
+	if err := loadSeccompProfile(&cfg.Fuzz); err != nil {
+		return nil, err
+	}
+
+	// Compile the patterns of the secrets redacted from the reports.
+	cfg.Fuzz.RedactRegexps, err = compileRedactPatterns(
+		cfg.Fuzz.RedactPatterns)
 	if err != nil {
 		return nil, err
 	}
-	cfg.Project.CorpusKey = fmt.Sprintf("%s_corpus.zip", repo)
+
+	// Validate the toolchain selection and the Go versions of the fuzzing
+	// matrix.
+	if err := validateToolchainConfig(&cfg.Fuzz); err != nil {
+		return nil, err
+	}
+
+	// Validate the container images.
+	if err := validateImageConfig(&cfg.Fuzz); err != nil {
+		return nil, err
+	}
+
+	// Extract the repository name from the source URL and use it to set the
+	// corpus key and corpus directory. Agents have no project.
+	var repo string
+	if cfg.Mode != ModeAgent {
+		repo, err = extractRepo(cfg.Project.SrcRepo)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Project.CorpusKey = fmt.Sprintf("%s_corpus.zip", repo)
+	}
 
 	// Set the absolute path to the workspace directory.
 	//
@@ -226,10 +507,67 @@ func loadConfig() (*Config, error) {
 		fmt.Sprintf("%s_corpus", repo))
 	cfg.Project.ReportDir = filepath.Join(tmpDirPath, TmpReportDir)
 	cfg.Project.BinaryDir = filepath.Join(tmpDirPath, TmpBinaryDir)
+	cfg.Project.ShardDir = filepath.Join(tmpDirPath, TmpShardDir)
+
+	cfg.DaemonID = daemonID(&cfg)
+	cfg.InstanceID = newInstanceID()
 
 	return &cfg, nil
 }
 
+// validateRequired ensures that the options needed to fuzz a project are set.
+func validateRequired(cfg *Config) error {
+	required := []struct {
+		name  string
+		isSet bool
+	}{
+		{"project.src-repo", cfg.Project.SrcRepo != ""},
+		{"project.s3-bucket-name", cfg.Project.S3BucketName != ""},
+		{"fuzz.crash-repo", cfg.Fuzz.CrashRepo != ""},
+		{"fuzz.pkgs-path", len(cfg.Fuzz.PkgsPath) > 0},
+	}
+
+	for _, opt := range required {
+		if !opt.isSet {
+			return fmt.Errorf("the required flag `--%s' was not "+
+				"specified", opt.name)
+		}
+	}
+
+	return nil
+}
+
+// validateDistributedConfig checks the coordinator and agent options, and
+// defaults the agent name to the host name.
+func validateDistributedConfig(cfg *Config) error {
+	if cfg.Mode == ModeStandalone {
+		return nil
+	}
+
+	if cfg.Coordinator.AuthToken == "" {
+		return fmt.Errorf("coordinator.auth-token is required in %s "+
+			"mode", cfg.Mode)
+	}
+	if cfg.Coordinator.LeaseTimeout <= 0 {
+		return fmt.Errorf("invalid lease timeout: %s, must be "+
+			"positive", cfg.Coordinator.LeaseTimeout)
+	}
+	if cfg.Agent.PollInterval <= 0 {
+		return fmt.Errorf("invalid poll interval: %s, must be "+
+			"positive", cfg.Agent.PollInterval)
+	}
+
+	if cfg.Mode == ModeAgent && cfg.Agent.Name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("determining agent name: %w", err)
+		}
+		cfg.Agent.Name = hostname
+	}
+
+	return nil
+}
+
 // CleanAndExpandPath expands environment variables and leading ~ in the
 // passed path, cleans the result, and returns it.
 // This function is taken from https://github.com/btcsuite/btcd
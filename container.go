@@ -4,72 +4,65 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
+	"time"
 )
 
-// Container encapsulates the configuration and state needed to manage a Docker
-// container for running fuzzing tasks, including context, logger, Docker client
-// configuration, directories path, and command.
+// Container encapsulates the configuration and state needed to manage a
+// fuzzing run in the configured runtime, including context, logger, runner,
+// image, directories path, command, resource limits, security settings and
+// labels.
 type Container struct {
 	ctx            context.Context
 	logger         *slog.Logger
-	cli            *client.Client
+	runner         Runner
+	image          string
 	fuzzBinaryPath string
 	hostCorpusPath string
 	cmd            []string
-}
+	limits         ResourceLimits
+	sandbox        SandboxOptions
+	labels         map[string]string
 
-// Start creates and starts a Docker container with the specified configuration.
-// It returns the container ID if successful, or an error if container creation
-// or startup fails.
-func (c *Container) Start() (string, error) {
-	// Prepare Docker container configuration and limit resources for the
-	// container.
-	containerConfig := &container.Config{
-		Image:        ContainerImage,
-		Cmd:          c.cmd,
-		WorkingDir:   ContainerWorkDir,
-		User:         fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
-		AttachStdout: true,
-		AttachStderr: true,
-		Tty:          true,
-		Env: []string{
-			"GOCACHE=/tmp",
-		},
-	}
-	hostConfig := &container.HostConfig{
-		AutoRemove: true,
-		Binds: []string{
-			fmt.Sprintf("%s:%s", c.fuzzBinaryPath,
-				ContainerWorkDir),
-			fmt.Sprintf("%s:%s", c.hostCorpusPath,
-				ContainerCorpusPath),
-		},
-		Resources: container.Resources{
-			Memory:   2 * 1024 * 1024 * 1024,
-			NanoCPUs: 1_000_000_000,
-		},
-	}
+	// hang bounds how long the run may go without progress; zero limits
+	// disable hang detection.
+	hang HangLimits
 
-	resp, err := c.cli.ContainerCreate(c.ctx, containerConfig, hostConfig,
-		nil, nil, "")
-	if err != nil {
-		return "",
-			fmt.Errorf("failed to create fuzz container: %w", err)
-	}
+	// logPath, if set, is the run log the raw output of the run is
+	// archived in, through runLog while the run is streamed.
+	logPath string
+	runLog  *runLog
 
-	if err := c.cli.ContainerStart(c.ctx, resp.ID,
-		container.StartOptions{}); err != nil {
-		return "",
-			fmt.Errorf("failed to start fuzz container: %w", err)
-	}
+	// started is when the run was started.
+	started time.Time
+
+	// metrics, if set, records the metrics of the run from its progress
+	// lines.
+	metrics *metricsRecorder
 
-	return resp.ID, nil
+	// redactor removes the secrets from the output of the run before it is
+	// logged and archived.
+	redactor *redactor
+
+	// quiet logs the output of the run at the debug level, for runs whose
+	// output is of no interest beyond the crash it shows.
+	quiet bool
+}
+
+// Start starts the fuzzing run with the specified configuration. It returns
+// the run ID if successful, or an error if the run could not be started.
+func (c *Container) Start() (string, error) {
+	c.started = time.Now()
+	return c.runner.Start(c.ctx, RunSpec{
+		Image:     c.image,
+		WorkDir:   c.fuzzBinaryPath,
+		CorpusDir: c.hostCorpusPath,
+		Cmd:       c.cmd,
+		Limits:    c.limits,
+		Sandbox:   c.sandbox,
+		Labels:    c.labels,
+	})
 }
 
 // WaitAndGetLogs listens to the container's log stream, processes fuzz output,
@@ -85,14 +78,9 @@ func (c *Container) Start() (string, error) {
 func (c *Container) WaitAndGetLogs(ID, pkg, target string,
 	fuzzCrashChan chan fuzzCrash, errChan chan error) {
 
-	// Acquire the log stream (stdout + stderr) for the running container.
-	logsReader, err := c.cli.ContainerLogs(c.ctx, ID,
-		container.LogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-			Follow:     true,
-			Timestamps: false,
-		})
+	// Acquire the multiplexed log stream (stdout and stderr) for the
+	// running container.
+	logsReader, err := c.runner.Logs(c.ctx, ID)
 	if err != nil {
 		if c.ctx.Err() == nil {
 			errChan <- fmt.Errorf("unable to attach to logs for "+
@@ -112,60 +100,195 @@ func (c *Container) WaitAndGetLogs(ID, pkg, target string,
 	maybeFailingCorpusPath := filepath.Join(c.fuzzBinaryPath, "testdata",
 		"fuzz")
 
-	// Process the standard output, which may include both stdout and stderr
-	// content.
+	// Process the standard output and standard error of the run. The raw
+	// output of an archived run only goes to the debug log.
 	processor := NewFuzzOutputProcessor(c.logger.With("target", target).
 		With("package", pkg), maybeFailingCorpusPath)
+	if c.runLog != nil {
+		processor.archive = c.runLog
+	}
+	if c.runLog != nil || c.quiet {
+		processor.outputLevel = slog.LevelDebug
+	}
+	processor.metrics = c.metrics
+	processor.redactor = c.redactor
+
+	// Watch the progress of the run while its output is processed.
+	streamDone := make(chan struct{})
+	if c.hang.enabled() {
+		processor.watchdog = newProgressWatchdog(c.hang, c.started)
+		go c.watchProgress(ID, processor.watchdog, streamDone)
+	}
+
 	crashData, err := processor.processFuzzStream(logsReader)
+	close(streamDone)
 	if err != nil {
 		errChan <- fmt.Errorf("failed to process fuzz stream for "+
 			"container %s: %w", ID, err)
 		return
 	}
 
-	// Fuzz target crashed, so report and exit this goroutine.
+	var hangReason string
+	if processor.watchdog != nil {
+		hangReason, _ = processor.watchdog.hung()
+	}
+
+	// Fuzz target crashed, so report and exit this goroutine. A fuzz
+	// worker killed for exceeding the memory limit shows up as a failure
+	// reported by the fuzzer; only the runtime knows why it was killed.
 	if crashData != nil {
+		status, err := c.Wait(ID)
+		switch {
+		case err == nil && status.OOMKilled:
+			crashData.kind = crashKindOOM
+
+		case hangReason != "":
+			crashData.kind = crashKindHang
+		}
 		fuzzCrashChan <- *crashData
 		return
 	}
 
 	// Retrieve the container's exit status and send error (if any) on
-	// errChan.
-	errChan <- c.Wait(ID)
-}
+	// errChan. A run that ran out of memory or hung is a crash of its own.
+	status, err := c.Wait(ID)
+	stdout, stderr := processor.recentOutput()
+	switch {
+	case err != nil || c.ctx.Err() != nil:
+		errChan <- err
+
+	case ranOutOfMemory(status, stdout+stderr):
+		c.logger.Warn("Fuzz container ran out of memory", "target",
+			target, "status", status.Code, "oomKilled",
+			status.OOMKilled, "memoryLimit", c.limits.MemoryBytes)
+
+		fuzzCrashChan <- c.killedRunCrash(crashKindOOM, target,
+			stdout+fmt.Sprintf("fuzz container ran out of memory "+
+				"(exit status %d, memory limit %d bytes)\n",
+				status.Code, c.limits.MemoryBytes), stderr)
 
-// Wait waits for the specified Docker container to finish execution. It returns
-// an error if the container exits with a non-zero status or if there is an
-// error waiting for the container to finish.
-func (c *Container) Wait(ID string) error {
-	// Wait for the container to finish.
-	statusCh, errCh := c.cli.ContainerWait(c.ctx, ID,
-		container.WaitConditionNotRunning)
+	case hangReason != "":
+		stdout, stderr = processor.hangOutput()
+		fuzzCrashChan <- c.killedRunCrash(crashKindHang, target,
+			stdout+fmt.Sprintf("fuzz target hung: %s (exit "+
+				"status %d after SIGQUIT)\n", hangReason,
+				status.Code), stderr)
 
-	select {
-	case err := <-errCh:
+	case status.Code != 0:
+		errChan <- fmt.Errorf("fuzz container exited with status %d",
+			status.Code)
+
+	default:
+		errChan <- nil
+	}
+}
+
+// Wait waits for the specified run to finish execution and returns its exit
+// status. It returns an error if there is an error waiting for the run to
+// finish while the context is still alive.
+func (c *Container) Wait(ID string) (ExitStatus, error) {
+	status, err := c.runner.Wait(c.ctx, ID)
+	if err != nil {
+		// Losing track of the container is worth retrying the run.
 		if c.ctx.Err() == nil {
-			return fmt.Errorf("error waiting for fuzz container: "+
-				"%w", err)
+			return ExitStatus{}, newTransientError(fmt.Errorf(
+				"error waiting for fuzz container: %w", err))
 		}
-	case status := <-statusCh:
-		if status.StatusCode != 0 {
-			return fmt.Errorf("fuzz container exited with "+
-				"status %d", status.StatusCode)
+		return ExitStatus{}, nil
+	}
+
+	return status, nil
+}
+
+// ranOutOfMemory reports whether a run that exited with the given status and
+// output ran out of memory: it was killed for exceeding its memory limit, or
+// the Go runtime failed an allocation. A run killed with SIGKILL otherwise,
+// such as by a stop timeout or the reaper, did not.
+func ranOutOfMemory(status ExitStatus, output string) bool {
+	switch {
+	case status.OOMKilled:
+		return true
+
+	case status.Code != 0:
+		return strings.Contains(output, outOfMemoryMarker)
+
+	default:
+		return false
+	}
+}
+
+// killedRunCrash returns the crash of the given kind of a run that was killed
+// before the fuzzer could report a failure: its last output on the standard
+// output and the standard error, and the inputs the fuzzer added to the corpus
+// last, one of which may have triggered the crash.
+func (c *Container) killedRunCrash(kind crashKind, target, stdout,
+	stderr string) fuzzCrash {
+
+	inputs, err := recentCorpusInputs(filepath.Join(c.hostCorpusPath,
+		target), c.started, maxRecentInputs)
+	if err != nil {
+		c.logger.Warn("Failed to collect the recent inputs of the "+
+			"fuzz target", "target", target, "error", err)
+	}
+
+	return fuzzCrash{
+		kind:         kind,
+		errorLogs:    stdout,
+		stderrLogs:   stderr,
+		recentInputs: inputs,
+	}
+}
+
+// watchProgress checks the progress of the run until its output ends or the
+// context is done. Once the run hangs, it sends SIGQUIT to the run, so that it
+// dumps its goroutines into the output and exits.
+func (c *Container) watchProgress(ID string, watchdog *progressWatchdog,
+	streamDone <-chan struct{}) {
+
+	ticker := time.NewTicker(hangCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+
+		case <-streamDone:
+			return
+
+		case now := <-ticker.C:
+			if !watchdog.check(now) {
+				continue
+			}
+
+			reason, _ := watchdog.hung()
+			c.logger.Warn("Fuzz target hung, dumping its "+
+				"goroutines", "containerID", ID, "reason",
+				reason)
+
+			if err := c.runner.Quit(c.ctx, ID); err != nil {
+				c.logger.Error("Failed to quit hung fuzz "+
+					"container", "containerID", ID,
+					"error", err)
+			}
+			return
 		}
 	}
+}
 
-	return nil
+// closeRunLog closes the run log once streamDone is closed.
+func (c *Container) closeRunLog(streamDone <-chan struct{}) {
+	<-streamDone
+	if err := c.runLog.Close(); err != nil {
+		c.logger.Error("Failed to close run log", "error", err)
+	}
 }
 
-// Stop attempts to gracefully stop the specified Docker container by its ID.
-// After a default timeout of 10 seconds, the container is forcefully killed.
+// Stop attempts to gracefully stop the specified run by its ID and releases
+// it. After a default timeout of 10 seconds, the run is forcefully killed.
 func (c *Container) Stop(ID string) {
-	if err := c.cli.ContainerStop(context.Background(), ID,
-		container.StopOptions{}); err != nil {
-		if !strings.Contains(err.Error(), "No such container") {
-			c.logger.Error("Failed to stop container", "error", err,
-				"containerID", ID)
-		}
+	if err := c.runner.Stop(ID); err != nil {
+		c.logger.Error("Failed to stop container", "error", err,
+			"containerID", ID)
 	}
 }
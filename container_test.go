@@ -5,17 +5,18 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/client"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-// TestContainerRace verifies that the Docker client is safe for concurrent use
+// TestContainerRace verifies that the Docker runner is safe for concurrent use
 // by launching two containers in parallel. It ensures that concurrent
-// operations on a shared Docker client do not cause data races or unexpected
+// operations on a shared Docker runner do not cause data races or unexpected
 // errors.
 func TestContainerRace(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -25,20 +26,13 @@ func TestContainerRace(t *testing.T) {
 	tmpDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	// Set up Docker client for running containers.
-	cli, err := client.NewClientWithOpts(client.FromEnv,
-		client.WithAPIVersionNegotiation())
+	// Set up the Docker runner for running containers.
+	runner, err := newDockerRunner(logger, "", false)
 	assert.NoError(t, err)
-	t.Cleanup(func() { assert.NoError(t, cli.Close()) })
+	t.Cleanup(func() { assert.NoError(t, runner.Close()) })
 
 	// Pull the golang image once for both containers.
-	reader, err := cli.ImagePull(ctx, ContainerImage,
-		image.PullOptions{})
-	assert.NoError(t, err)
-
-	_, err = io.Copy(io.Discard, reader)
-	assert.NoError(t, err)
-	t.Cleanup(func() { assert.NoError(t, reader.Close()) })
+	assert.NoError(t, runner.PullImage(ctx, ContainerImage))
 
 	const timeout = 15 * time.Second
 
@@ -53,7 +47,8 @@ func TestContainerRace(t *testing.T) {
 			c := &Container{
 				ctx:            taskCtx,
 				logger:         logger,
-				cli:            cli,
+				runner:         runner,
+				image:          ContainerImage,
 				fuzzBinaryPath: tmpDir,
 				hostCorpusPath: tmpDir,
 				cmd:            []string{"sleep", "infinity"},
@@ -80,3 +75,59 @@ func TestContainerRace(t *testing.T) {
 		})
 	}
 }
+
+// TestRanOutOfMemory verifies how runs that ran out of memory are told apart
+// from runs that failed otherwise.
+func TestRanOutOfMemory(t *testing.T) {
+	tests := []struct {
+		name   string
+		status ExitStatus
+		output string
+		want   bool
+	}{
+		{name: "success"},
+		{name: "failure", status: ExitStatus{Code: 1}},
+		{name: "oom killed", status: ExitStatus{Code: 137,
+			OOMKilled: true}, want: true},
+		{name: "sigkill", status: ExitStatus{Code: 137}},
+		{name: "failed allocation", status: ExitStatus{Code: 2},
+			output: "fatal error: runtime: out of memory\n",
+			want:   true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ranOutOfMemory(tt.status,
+				tt.output))
+		})
+	}
+}
+
+// TestRecentCorpusInputs verifies that the inputs written since the start of a
+// run are returned newest first, up to the requested number.
+func TestRecentCorpusInputs(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+
+	inputs := map[string]time.Duration{
+		"old":    -2 * time.Hour,
+		"first":  -30 * time.Minute,
+		"second": -20 * time.Minute,
+		"third":  -10 * time.Minute,
+	}
+	for name, age := range inputs {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+		modTime := time.Now().Add(age)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	recent, err := recentCorpusInputs(dir, start, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"third", "second"}, recent)
+
+	recent, err = recentCorpusInputs(filepath.Join(dir, "missing"), start,
+		2)
+	require.NoError(t, err)
+	assert.Empty(t, recent)
+}
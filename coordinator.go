@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// bundleBinaryPrefix is the directory of a run bundle holding the fuzz
+	// binary and its testdata.
+	bundleBinaryPrefix = "binary"
+
+	// bundleCorpusPrefix is the directory of a run bundle holding the
+	// corpus of the fuzz target.
+	bundleCorpusPrefix = "corpus"
+
+	// apiShutdownTimeout bounds the graceful shutdown of the coordinator
+	// API.
+	apiShutdownTimeout = 5 * time.Second
+
+	// leaseReportWindow is how long the lease of a run stays open after
+	// its fuzzing time is over, for the agent to stop the run and upload
+	// its corpus, run log and outcome.
+	leaseReportWindow = 5 * time.Minute
+)
+
+// LeaseRequest is sent by an agent to ask the coordinator for a fuzzing run.
+type LeaseRequest struct {
+	Agent string
+}
+
+// Lease is a fuzzing run handed to an agent.
+type Lease struct {
+	// ID identifies the lease in every later request of the agent.
+	ID string
+
+	// Task is the fuzz target to run.
+	Task Task
+
+	// Timeout is the fuzzing time of the run, counted from when the lease
+	// is granted, so that preparing the run on the agent counts against
+	// it.
+	Timeout time.Duration
+
+	// Image is the container image of the run.
+	Image string
+
+	// Limits are the resources of the fuzzing container.
+	Limits ResourceLimits
+
+	// Sandbox holds the security settings of the fuzzing container.
+	Sandbox SandboxOptions
+
+	// Labels describe the run; the agent adds the labels identifying
+	// itself.
+	Labels map[string]string
+
+	// Hang bounds how long the run may go without progress.
+	Hang HangLimits
+
+	// RedactPatterns are the user-configured patterns of the secrets to
+	// redact from the run log.
+	RedactPatterns []string `json:",omitempty"`
+
+	// HeartbeatInterval is how often the agent must send heartbeats to
+	// keep the lease.
+	HeartbeatInterval time.Duration
+
+	// expires is when the fuzzing time of the lease ends on the agent's
+	// clock, set when the agent receives the lease.
+	expires time.Time
+}
+
+// Heartbeat keeps a lease alive and reports the status of its run.
+type Heartbeat struct {
+	Status string
+}
+
+// CrashResult describes a crash found by an agent.
+type CrashResult struct {
+	Kind               crashKind `json:",omitempty"`
+	Detail             string    `json:",omitempty"`
+	ErrorLogs          string
+	FailureFileAndLine string
+
+	// FailingInput is the input that crashed the run. It is sent as bytes,
+	// encoded as base64 in JSON, since inputs need not be valid UTF-8.
+	FailingInput []byte `json:",omitempty"`
+
+	// Stack holds the project frames of the crash's stack trace.
+	Stack []StackFrame `json:",omitempty"`
+
+	// StderrLogs is the standard error output of the run that goes with
+	// ErrorLogs.
+	StderrLogs string `json:",omitempty"`
+
+	// FailingInputName is the slash-separated path of the failing input
+	// below testdata/fuzz (e.g. "FuzzFoo/771e938e4458e983"), or empty for
+	// seed corpus failures.
+	FailingInputName string `json:",omitempty"`
+
+	// RecentInputs are the inputs the fuzzer added last before the run was
+	// killed, newest first.
+	RecentInputs [][]byte `json:",omitempty"`
+}
+
+// RunResult is the outcome of a leased fuzzing run.
+type RunResult struct {
+	Crash     *CrashResult `json:",omitempty"`
+	Error     string       `json:",omitempty"`
+	Transient bool         `json:",omitempty"`
+
+	// Metrics are the metrics of the run, if it showed progress.
+	Metrics *RunMetrics `json:",omitempty"`
+}
+
+// remoteRun is a fuzzing run handed to agents by the coordinator. It waits on
+// the lease board until an agent leases it, and is re-queued if that agent
+// stops sending heartbeats.
+type remoteRun struct {
+	task      Task
+	image     string
+	limits    ResourceLimits
+	sandbox   SandboxOptions
+	labels    map[string]string
+	binaryDir string
+	corpusDir string
+	logPath   string
+
+	// deadline is when the fuzzing time of the run ends.
+	deadline time.Time
+
+	// result receives the outcome reported by the agent.
+	result chan RunResult
+
+	// The following fields describe the current lease of the run, if any.
+	leaseID  string
+	agent    string
+	status   string
+	lastSeen time.Time
+}
+
+// leaseBoard holds the fuzzing runs waiting for an agent and the runs leased to
+// agents. A lease whose agent sent no heartbeat for leaseTimeout is revoked
+// and its run re-queued the next time an agent asks for a run. The lease of a
+// run whose fuzzing time is over stays open for reportWindow, for its agent to
+// report the run. Leased runs are reported as hung according to hang, and
+// redactPatterns match the secrets redacted from their run logs.
+type leaseBoard struct {
+	mu             sync.Mutex
+	logger         *slog.Logger
+	leaseTimeout   time.Duration
+	reportWindow   time.Duration
+	hang           HangLimits
+	redactPatterns []string
+	pending        []*remoteRun
+	leased         map[string]*remoteRun
+}
+
+// newLeaseBoard returns an empty lease board.
+func newLeaseBoard(logger *slog.Logger, leaseTimeout time.Duration,
+	hang HangLimits, redactPatterns []string) *leaseBoard {
+
+	return &leaseBoard{
+		logger:         logger,
+		leaseTimeout:   leaseTimeout,
+		reportWindow:   leaseReportWindow,
+		hang:           hang,
+		redactPatterns: redactPatterns,
+		leased:         make(map[string]*remoteRun),
+	}
+}
+
+// run hands the fuzzing run of the task, with the given container image,
+// resources, security settings and labels, to an agent and waits for its
+// outcome until ctx is done, which, as for local runs, is not an error. If ctx
+// ends with the fuzzing time of the run, the outcome the agent reports within
+// the report window is still used. A crasher found by the agent is written to
+// the task's testdata in binaryDir, as a local run would have done, the output
+// of the run uploaded by the agent is appended to the run log at logPath, and
+// the metrics of the run reported by the agent are recorded in metrics.
+func (b *leaseBoard) run(ctx context.Context, task Task, image string,
+	limits ResourceLimits, sandbox SandboxOptions,
+	labels map[string]string, binaryDir, corpusDir, logPath string,
+	metrics *metricsRecorder) (*fuzzCrash, error) {
+
+	r := &remoteRun{
+		task:      task,
+		image:     image,
+		limits:    limits,
+		sandbox:   sandbox,
+		labels:    labels,
+		binaryDir: binaryDir,
+		corpusDir: corpusDir,
+		logPath:   logPath,
+		deadline:  time.Now().Add(remainingFuzzTime(ctx)),
+		result:    make(chan RunResult, 1),
+	}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, r)
+	b.mu.Unlock()
+	defer b.remove(r)
+
+	b.logger.Info("Fuzzing run waiting for an agent", "package",
+		task.Package.Path, "target", task.Target, "goVersion",
+		task.GoVersion)
+
+	var res RunResult
+	select {
+	case <-ctx.Done():
+		var ok bool
+		res, ok = b.awaitReport(r)
+		if !ok {
+			return nil, nil
+		}
+
+	case res = <-r.result:
+	}
+
+	b.mu.Lock()
+	agent := r.agent
+	b.mu.Unlock()
+
+	if res.Metrics != nil {
+		metrics.record(*res.Metrics)
+	}
+
+	if res.Error != "" {
+		err := errors.New(res.Error)
+		if res.Transient {
+			err = newTransientError(err)
+		}
+		return nil, fmt.Errorf("agent %s: %w", agent, err)
+	}
+	if res.Crash == nil {
+		return nil, nil
+	}
+
+	return writeRemoteCrash(task, binaryDir, res.Crash)
+}
+
+// awaitReport returns the outcome of a run whose worker stopped waiting for it.
+// The agent of a run whose fuzzing time is over still stops the run and
+// uploads its corpus, run log and outcome, so the lease is kept open for the
+// report window. A run stopped before its deadline, or that no agent holds, is
+// abandoned, and awaitReport reports false.
+func (b *leaseBoard) awaitReport(r *remoteRun) (RunResult, bool) {
+	select {
+	case res := <-r.result:
+		return res, true
+
+	default:
+	}
+
+	b.mu.Lock()
+	leased := b.leased[r.leaseID] == r
+	agent, leaseID := r.agent, r.leaseID
+	b.mu.Unlock()
+
+	if !leased || time.Now().Before(r.deadline) {
+		return RunResult{}, false
+	}
+
+	b.logger.Info("Waiting for agent to report fuzzing run", "agent",
+		agent, "lease", leaseID, "package", r.task.Package.Path,
+		"target", r.task.Target, "window", b.reportWindow)
+
+	timer := time.NewTimer(b.reportWindow)
+	defer timer.Stop()
+
+	select {
+	case res := <-r.result:
+		return res, true
+
+	case <-timer.C:
+		b.logger.Warn("Agent did not report fuzzing run in time",
+			"agent", agent, "lease", leaseID, "package",
+			r.task.Package.Path, "target", r.task.Target)
+
+		return RunResult{}, false
+	}
+}
+
+// writeRemoteCrash converts a crash reported by an agent into a fuzzCrash and
+// writes its failing input to the task's testdata in binaryDir.
+func writeRemoteCrash(task Task, binaryDir string,
+	cr *CrashResult) (*fuzzCrash, error) {
+
+	crash := &fuzzCrash{
+		kind:               cr.Kind,
+		detail:             cr.Detail,
+		errorLogs:          cr.ErrorLogs,
+		stderrLogs:         cr.StderrLogs,
+		failingInput:       string(cr.FailingInput),
+		failureFileAndLine: cr.FailureFileAndLine,
+		stack:              cr.Stack,
+	}
+	for _, input := range cr.RecentInputs {
+		crash.recentInputs = append(crash.recentInputs, string(input))
+	}
+	if cr.FailingInputName == "" {
+		return crash, nil
+	}
+
+	dir, id := path.Split(cr.FailingInputName)
+	if dir != task.Target+"/" || id == "" || id == "." || id == ".." {
+		return nil, fmt.Errorf("invalid failing input name %q",
+			cr.FailingInputName)
+	}
+
+	inputDir := filepath.Join(binaryDir, "testdata", "fuzz", task.Target)
+	if err := EnsureDirExists(inputDir); err != nil {
+		return nil, err
+	}
+
+	crash.failingInputFile = filepath.Join(inputDir, id)
+	err := os.WriteFile(crash.failingInputFile, cr.FailingInput, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("writing failing input: %w", err)
+	}
+
+	return crash, nil
+}
+
+// remove takes the run off the board, revoking its lease if any.
+func (b *leaseBoard) remove(r *remoteRun) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = slices.DeleteFunc(b.pending, func(p *remoteRun) bool {
+		return p == r
+	})
+	if b.leased[r.leaseID] == r {
+		delete(b.leased, r.leaseID)
+	}
+}
+
+// grant leases the oldest waiting run to the given agent, after re-queuing the
+// runs of agents that stopped sending heartbeats. It returns nil if no run is
+// waiting.
+func (b *leaseBoard) grant(agent string) *Lease {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.requeueExpired(now)
+
+	for len(b.pending) > 0 {
+		r := b.pending[0]
+		b.pending = b.pending[1:]
+
+		// The run is about to be canceled by its worker.
+		timeout := r.deadline.Sub(now)
+		if timeout <= 0 {
+			continue
+		}
+
+		r.leaseID = rand.Text()
+		r.agent = agent
+		r.status = ""
+		r.lastSeen = now
+		b.leased[r.leaseID] = r
+
+		b.logger.Info("Leased fuzzing run to agent", "agent", agent,
+			"lease", r.leaseID, "package", r.task.Package.Path,
+			"target", r.task.Target, "goVersion",
+			r.task.GoVersion, "timeout", timeout)
+
+		return &Lease{
+			ID:                r.leaseID,
+			Task:              r.task,
+			Timeout:           timeout,
+			Image:             r.image,
+			Limits:            r.limits,
+			Sandbox:           r.sandbox,
+			Labels:            r.labels,
+			Hang:              b.hang,
+			RedactPatterns:    b.redactPatterns,
+			HeartbeatInterval: b.leaseTimeout / 3,
+		}
+	}
+
+	return nil
+}
+
+// requeueExpired revokes the leases whose agent sent no heartbeat for
+// leaseTimeout, and puts their runs back at the front of the queue.
+func (b *leaseBoard) requeueExpired(now time.Time) {
+	for id, r := range b.leased {
+		if now.Sub(r.lastSeen) <= b.leaseTimeout {
+			continue
+		}
+
+		b.logger.Warn("Agent lost; re-queuing fuzzing run", "agent",
+			r.agent, "lease", id, "package", r.task.Package.Path,
+			"target", r.task.Target, "lastSeen", r.lastSeen)
+
+		delete(b.leased, id)
+		r.leaseID = ""
+		b.pending = append([]*remoteRun{r}, b.pending...)
+	}
+}
+
+// leasedRun returns the run leased under the given lease ID.
+func (b *leaseBoard) leasedRun(leaseID string) (*remoteRun, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.leased[leaseID]
+	return r, ok
+}
+
+// heartbeat renews the given lease and records the status of its run. It
+// reports false if the lease was revoked or its run canceled.
+func (b *leaseBoard) heartbeat(leaseID string, hb Heartbeat) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.leased[leaseID]
+	if !ok {
+		return false
+	}
+
+	r.lastSeen = time.Now()
+	if hb.Status != r.status {
+		r.status = hb.Status
+		b.logger.Info("Agent status", "agent", r.agent, "lease",
+			leaseID, "package", r.task.Package.Path, "target",
+			r.task.Target, "status", hb.Status)
+	}
+
+	return true
+}
+
+// complete ends the given lease with the outcome reported by its agent. It
+// reports false if the lease was revoked or its run canceled.
+func (b *leaseBoard) complete(leaseID string, res RunResult) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.leased[leaseID]
+	if !ok {
+		return false
+	}
+
+	delete(b.leased, leaseID)
+	r.result <- res
+
+	return true
+}
+
+// coordinatorServer serves the coordinator API, through which agents lease
+// fuzzing runs, download their binary and corpus, send heartbeats, and upload
+// the new corpus inputs and the outcome of the runs. Every request must carry
+// the shared token as a bearer token.
+type coordinatorServer struct {
+	logger *slog.Logger
+	token  string
+	board  *leaseBoard
+}
+
+// handler returns the HTTP handler of the coordinator API.
+func (s *coordinatorServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/lease", s.handleLease)
+	mux.HandleFunc("GET /v1/leases/{id}/bundle", s.handleBundle)
+	mux.HandleFunc("POST /v1/leases/{id}/heartbeat", s.handleHeartbeat)
+	mux.HandleFunc("POST /v1/leases/{id}/corpus", s.handleCorpus)
+	mux.HandleFunc("POST /v1/leases/{id}/log", s.handleLog)
+	mux.HandleFunc("POST /v1/leases/{id}/result", s.handleResult)
+
+	return s.authenticate(mux)
+}
+
+// authenticate rejects the requests that do not carry the shared token.
+func (s *coordinatorServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"),
+			"Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token),
+			[]byte(s.token)) != 1 {
+
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleLease leases a waiting run to the requesting agent, or answers with no
+// content if no run is waiting.
+func (s *coordinatorServer) handleLease(w http.ResponseWriter,
+	r *http.Request) {
+
+	var req LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lease := s.board.grant(req.Agent)
+	if lease == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lease); err != nil {
+		s.logger.Error("Failed to send lease", "error", err)
+	}
+}
+
+// handleBundle streams the fuzz binary, testdata and corpus of a leased run as
+// a gzip-compressed tar archive.
+func (s *coordinatorServer) handleBundle(w http.ResponseWriter,
+	r *http.Request) {
+
+	run, ok := s.board.leasedRun(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "lease is gone", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	err := writeTarGz(w, map[string]string{
+		bundleBinaryPrefix: run.binaryDir,
+		path.Join(bundleCorpusPrefix, run.task.Target): filepath.Join(
+			run.corpusDir, run.task.Target),
+	})
+	if err != nil {
+		s.logger.Error("Failed to send run bundle", "error", err)
+	}
+}
+
+// handleHeartbeat renews a lease.
+func (s *coordinatorServer) handleHeartbeat(w http.ResponseWriter,
+	r *http.Request) {
+
+	var hb Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.board.heartbeat(r.PathValue("id"), hb) {
+		http.Error(w, "lease is gone", http.StatusGone)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCorpus merges the corpus inputs uploaded by an agent, sent as a
+// gzip-compressed tar archive of the fuzz target's corpus directory, into the
+// corpus of the target.
+func (s *coordinatorServer) handleCorpus(w http.ResponseWriter,
+	r *http.Request) {
+
+	run, ok := s.board.leasedRun(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "lease is gone", http.StatusGone)
+		return
+	}
+
+	err := extractTarGz(r.Body, run.corpusDir, run.task.Target)
+	if err != nil {
+		s.logger.Error("Failed to merge corpus uploaded by agent",
+			"lease", r.PathValue("id"), "target", run.task.Target,
+			"error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLog appends the output of a leased run uploaded by an agent, sent as a
+// gzip-compressed stream, to the run log of the run.
+func (s *coordinatorServer) handleLog(w http.ResponseWriter,
+	r *http.Request) {
+
+	run, ok := s.board.leasedRun(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "lease is gone", http.StatusGone)
+		return
+	}
+
+	if err := appendRunLog(run.logPath, r.Body); err != nil {
+		s.logger.Error("Failed to archive run log uploaded by agent",
+			"lease", r.PathValue("id"), "target", run.task.Target,
+			"error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResult ends a lease with the outcome of its run.
+func (s *coordinatorServer) handleResult(w http.ResponseWriter,
+	r *http.Request) {
+
+	var res RunResult
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.board.complete(r.PathValue("id"), res) {
+		http.Error(w, "lease is gone", http.StatusGone)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startCoordinator starts serving the coordinator API on the configured
+// address until ctx is canceled.
+func startCoordinator(ctx context.Context, logger *slog.Logger, cfg *Config,
+	board *leaseBoard) error {
+
+	listener, err := net.Listen("tcp", cfg.Coordinator.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("coordinator API: %w", err)
+	}
+
+	s := &coordinatorServer{
+		logger: logger,
+		token:  cfg.Coordinator.AuthToken,
+		board:  board,
+	}
+	srv := &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(
+			context.Background(), apiShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to shut down coordinator API",
+				"error", err)
+		}
+	}()
+
+	go func() {
+		err := srv.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Coordinator API stopped", "error", err)
+		}
+	}()
+
+	logger.Info("Coordinator API listening", "address", listener.Addr())
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCoordinator starts a coordinator API backed by a new lease board and
+// returns the board together with an agent talking to it.
+func newTestCoordinator(t *testing.T,
+	leaseTimeout time.Duration) (*leaseBoard, *agent) {
+
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	board := newLeaseBoard(logger, leaseTimeout, HangLimits{}, nil)
+	s := &coordinatorServer{logger: logger, token: "secret", board: board}
+
+	srv := httptest.NewServer(s.handler())
+	t.Cleanup(srv.Close)
+
+	cfg := &Config{
+		Coordinator: Coordinator{AuthToken: "secret"},
+		Agent:       Agent{CoordinatorURL: srv.URL, Name: "agent-1"},
+	}
+	a := &agent{
+		logger: logger,
+		cfg:    cfg,
+		http:   srv.Client(),
+	}
+
+	return board, a
+}
+
+// awaitLease polls the coordinator until it hands out a lease.
+func awaitLease(t *testing.T, a *agent) *Lease {
+	t.Helper()
+
+	var lease *Lease
+	require.Eventually(t, func() bool {
+		var err error
+		lease, err = a.requestLease(context.Background())
+		require.NoError(t, err)
+		return lease != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return lease
+}
+
+// TestCoordinatorAuthentication verifies that requests without the shared
+// token are rejected.
+func TestCoordinatorAuthentication(t *testing.T) {
+	_, a := newTestCoordinator(t, time.Minute)
+
+	lease, err := a.requestLease(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, lease)
+
+	a.cfg.Coordinator.AuthToken = "wrong"
+	_, err = a.requestLease(context.Background())
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
+
+// TestCoordinatorLeasedRun verifies a complete leased run: the agent leases
+// the run, downloads its binary and corpus, uploads new corpus inputs and
+// reports a crash, whose failing input ends up in the coordinator's binary
+// directory.
+func TestCoordinatorLeasedRun(t *testing.T) {
+	board, a := newTestCoordinator(t, time.Minute)
+
+	root := t.TempDir()
+	binaryDir := filepath.Join(root, "binary")
+	corpusDir := filepath.Join(root, "corpus")
+	logPath := filepath.Join(root, "logs", "FuzzFoo.log.gz")
+	writeFiles(t, root, map[string]string{
+		"binary/FuzzFoo.test":             "binary",
+		"binary/testdata/input.txt":       "testdata",
+		"corpus/FuzzFoo/seed":             "seed",
+		"corpus/FuzzOther/unrelated-seed": "unrelated",
+	})
+
+	task := Task{
+		Package: GoPackage{Path: "parser", ModuleDir: "."},
+		Target:  "FuzzFoo",
+	}
+
+	limits := ResourceLimits{MemoryBytes: 1 << 30, CPUs: 2, Parallel: 2}
+	sandbox := SandboxOptions{Hardened: true, UsernsMode: "host"}
+	labels := map[string]string{LabelTarget: "FuzzFoo"}
+
+	type outcome struct {
+		crash *fuzzCrash
+		err   error
+	}
+	done := make(chan outcome, 1)
+	var metrics metricsRecorder
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			time.Minute)
+		defer cancel()
+
+		crash, err := board.run(ctx, task, ContainerImage, limits,
+			sandbox, labels, binaryDir, corpusDir, logPath,
+			&metrics)
+		done <- outcome{crash, err}
+	}()
+
+	lease := awaitLease(t, a)
+	assert.Equal(t, task, lease.Task)
+	assert.Equal(t, ContainerImage, lease.Image)
+	assert.Equal(t, limits, lease.Limits)
+	assert.Equal(t, sandbox, lease.Sandbox)
+	assert.Equal(t, labels, lease.Labels)
+	assert.Positive(t, lease.Timeout)
+
+	// Only the corpus of the leased target is part of the bundle.
+	runDir := t.TempDir()
+	ctx := context.Background()
+	require.NoError(t, a.downloadBundle(ctx, lease.ID, runDir))
+	assert.FileExists(t, filepath.Join(runDir, "binary", "FuzzFoo.test"))
+	assert.FileExists(t, filepath.Join(runDir, "binary", "testdata",
+		"input.txt"))
+	assert.FileExists(t, filepath.Join(runDir, "corpus", "FuzzFoo",
+		"seed"))
+	assert.NoDirExists(t, filepath.Join(runDir, "corpus", "FuzzOther"))
+
+	require.NoError(t, a.postJSON(ctx, leaseAPIPath(lease.ID,
+		"heartbeat"), Heartbeat{Status: statusFuzzing}))
+
+	writeFiles(t, runDir, map[string]string{
+		"corpus/FuzzFoo/new-input": "new",
+	})
+	require.NoError(t, a.uploadCorpus(ctx, lease, runDir))
+	assert.FileExists(t, filepath.Join(corpusDir, "FuzzFoo", "new-input"))
+
+	// The output of the run is appended to the run log.
+	writeRunLog(t, filepath.Join(runDir, AgentRunLogFile), "fuzz: run\n")
+	require.NoError(t, a.uploadRunLog(ctx, lease, runDir))
+	assert.Equal(t, "fuzz: run\n", readRunLog(t, logPath))
+
+	crasher := filepath.Join(runDir, "binary", "testdata", "fuzz",
+		"FuzzFoo", "771e938e4458e983")
+	res := RunResult{Crash: crashResult(&fuzzCrash{
+		errorLogs:          "--- FAIL: FuzzFoo\n",
+		stderrLogs:         "panic: boom\n",
+		failingInput:       "go test fuzz v1\n",
+		failingInputFile:   crasher,
+		failureFileAndLine: "foo_test.go:17",
+	}, runDir)}
+	res.Metrics = &RunMetrics{Runs: 1, Final: FuzzStats{Execs: 42}}
+	require.NoError(t, a.postJSON(ctx, leaseAPIPath(lease.ID, "result"),
+		res))
+
+	got := <-done
+	require.NoError(t, got.err)
+	require.NotNil(t, got.crash)
+	assert.Equal(t, "foo_test.go:17", got.crash.failureFileAndLine)
+	assert.Equal(t, "panic: boom\n", got.crash.stderrLogs)
+	assert.Equal(t, *res.Metrics, metrics.result())
+
+	expectedFile := filepath.Join(binaryDir, "testdata", "fuzz", "FuzzFoo",
+		"771e938e4458e983")
+	assert.Equal(t, expectedFile, got.crash.failingInputFile)
+	data, err := os.ReadFile(expectedFile)
+	require.NoError(t, err)
+	assert.Equal(t, "go test fuzz v1\n", string(data))
+
+	// The lease is over.
+	err = a.postJSON(ctx, leaseAPIPath(lease.ID, "heartbeat"),
+		Heartbeat{Status: statusFuzzing})
+	assert.ErrorIs(t, err, errLeaseGone)
+}
+
+// TestCoordinatorRequeue verifies that the run of an agent that stopped
+// sending heartbeats is leased to another agent, and that the lost agent's
+// lease is gone.
+func TestCoordinatorRequeue(t *testing.T) {
+	board, a := newTestCoordinator(t, 50*time.Millisecond)
+
+	task := Task{Package: GoPackage{Path: "tree"}, Target: "FuzzTree"}
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			time.Minute)
+		defer cancel()
+
+		_, err := board.run(ctx, task, ContainerImage,
+			ResourceLimits{}, SandboxOptions{}, nil, t.TempDir(),
+			t.TempDir(), "", &metricsRecorder{})
+		done <- err
+	}()
+
+	lost := awaitLease(t, a)
+	time.Sleep(100 * time.Millisecond)
+
+	a.cfg.Agent.Name = "agent-2"
+	requeued := awaitLease(t, a)
+	assert.NotEqual(t, lost.ID, requeued.ID)
+	assert.Equal(t, task, requeued.Task)
+
+	ctx := context.Background()
+	err := a.postJSON(ctx, leaseAPIPath(lost.ID, "heartbeat"),
+		Heartbeat{Status: statusFuzzing})
+	assert.ErrorIs(t, err, errLeaseGone)
+
+	res := RunResult{Error: "daemon unavailable", Transient: true}
+	require.NoError(t, a.postJSON(ctx, leaseAPIPath(requeued.ID,
+		"result"), res))
+
+	err = <-done
+	assert.ErrorContains(t, err, "agent agent-2: daemon unavailable")
+	assert.True(t, isTransientError(err))
+}
+
+// TestCoordinatorLateReport verifies that an agent whose download and image
+// pull took a noticeable share of the lease fuzzes only until the lease
+// expires, and that the coordinator keeps the lease open after the fuzzing
+// time for the agent to upload the corpus and report the run.
+func TestCoordinatorLateReport(t *testing.T) {
+	board, a := newTestCoordinator(t, time.Minute)
+
+	task := Task{Package: GoPackage{Path: "tree"}, Target: "FuzzTree"}
+	corpusDir := t.TempDir()
+
+	// The worker's context ends with the fuzzing time of the run, 300ms
+	// after it is queued, plus the container grace period.
+	ctx, cancel := context.WithTimeout(context.Background(),
+		300*time.Millisecond+ContainerGracePeriod)
+	defer cancel()
+
+	type outcome struct {
+		crash *fuzzCrash
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		crash, err := board.run(ctx, task, ContainerImage,
+			ResourceLimits{}, SandboxOptions{}, nil, t.TempDir(),
+			corpusDir, "", &metricsRecorder{})
+		done <- outcome{crash, err}
+	}()
+
+	lease := awaitLease(t, a)
+	assert.WithinDuration(t, time.Now().Add(lease.Timeout), lease.expires,
+		100*time.Millisecond)
+
+	// Preparing the run takes most of the lease, which leaves little
+	// fuzzing time.
+	time.Sleep(200 * time.Millisecond)
+	assert.Less(t, time.Until(lease.expires), lease.Timeout/2)
+
+	// The run ends on the agent, and the worker stops waiting, before the
+	// agent reports it.
+	time.Sleep(time.Until(lease.expires))
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	runDir := t.TempDir()
+	writeFiles(t, runDir, map[string]string{
+		"corpus/FuzzTree/new-input": "new",
+	})
+	require.NoError(t, a.uploadCorpus(context.Background(), lease,
+		runDir))
+	assert.FileExists(t, filepath.Join(corpusDir, "FuzzTree", "new-input"))
+
+	res := RunResult{Crash: &CrashResult{ErrorLogs: "--- FAIL\n"}}
+	require.NoError(t, a.postJSON(context.Background(),
+		leaseAPIPath(lease.ID, "result"), res))
+
+	got := <-done
+	require.NoError(t, got.err)
+	require.NotNil(t, got.crash)
+	assert.Equal(t, "--- FAIL\n", got.crash.errorLogs)
+}
+
+// TestExtractTarGzRejectsUnexpectedEntries verifies that archive entries
+// outside the accepted prefixes, including path traversals, are rejected.
+func TestExtractTarGzRejectsUnexpectedEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{name: "other prefix", entry: "FuzzOther/input"},
+		{name: "path traversal", entry: "FuzzFoo/../../escape"},
+		{name: "absolute path", entry: "/etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gw)
+			require.NoError(t, tw.WriteHeader(&tar.Header{
+				Name:     tt.entry,
+				Typeflag: tar.TypeReg,
+				Mode:     0644,
+				Size:     1,
+			}))
+			_, err := tw.Write([]byte("x"))
+			require.NoError(t, err)
+			require.NoError(t, tw.Close())
+			require.NoError(t, gw.Close())
+
+			err = extractTarGz(&buf, t.TempDir(), "FuzzFoo")
+			assert.ErrorContains(t, err, "unexpected archive entry")
+		})
+	}
+}
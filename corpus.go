@@ -1,292 +1,1243 @@
 package main
 
 import (
+	"bufio"
+	"container/heap"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
-// runFuzzTest builds and executes a fuzzing command for the given target.
-// Additional environment variables can be supplied through extraEnv.
-func runFuzzTest(ctx context.Context, pkgDir, corpusDir, target string,
-	fuzzIterations int, extraEnv ...string) (string, error) {
-
-	// Build and run the fuzz command.
-	// Command arguments (explanations):
-	//
-	//   -run=^%s$ -fuzz=^%s$
-	// When the -fuzz flag is provided, `go test` normally runs all unit
-	// tests before doing any fuzzing. Passing -run together with -fuzz
-	// skips the initial unit-test run so we only exercise the fuzz target.
-	//
-	//   -fuzztime=%dx
-	// Sets fuzztime to exactly the number of inputs to process.
-	// This ensures the Go fuzzing engine stops after running those inputs
-	// and does not perform any additional fuzzing mutations.
-	//
-	//   -test.fuzzcachedir=%s
-	// Use a dedicated fuzz cache directory to avoid cross-contamination
-	// with the default cache.
-	//
-	//   -test.parallel=1
-	// Restrict test-level parallelism to a single worker to prevent excess
-	// CPU use and avoid resource races during fuzzing.
-	fuzzCmd := []string{
-		"test",
-		fmt.Sprintf("-run=^%s$", target),
-		fmt.Sprintf("-fuzz=^%s$", target),
-		fmt.Sprintf("-fuzztime=%dx", fuzzIterations),
-		fmt.Sprintf("-test.fuzzcachedir=%s", corpusDir),
-		"-test.parallel=1",
-	}
-
-	// Run the go test command with given environment variables.
-	return runGoCommand(ctx, pkgDir, fuzzCmd, extraEnv...)
-}
-
-// MeasureCoverage runs a Go fuzz target using the inputs from its corpus
-// directory and f.Add and returns the best observed coverage (in coverage bits)
-//
-// It does this by:
-//  1. Reading the corpus files for the given target.
-//  2. Running `go test` with one fuzz iteration per input.
-//  3. Extracting the coverage bits from the command output.
-func MeasureCoverage(ctx context.Context, pkgDir, corpusDir, target string,
-	fuzzAddInputs int) (int, error) {
-
-	// Gather existing corpus files to size the fuzz run
-	corpusTargetDir := filepath.Join(corpusDir, target)
-	files, err := os.ReadDir(corpusTargetDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return 0, nil
-		}
-		return 0, fmt.Errorf("reading corpus dir: %w", err)
-	}
-
-	// Total number of inputs already generated:
-	//   Inputs from f.Add() + existing corpus files.
-	// This is required because the "initial coverage bits:" line is only
-	// printed after all baseline coverage inputs have been executed using
-	// `go test ... -fuzztime=%dx`.
-	fuzzIterations := fuzzAddInputs + len(files)
-
-	// Run the go test command with GODEBUG to enable fuzzdebug output.
-	//
-	// When GODEBUG=fuzzdebug=1 is set, the Go fuzzing engine prints extra
-	// diagnostic information. We look for the line printed after all inputs
-	// in the fuzz cache have been processed, for example:
-	//   DEBUG finished processing ... initial coverage bits: XXX
-	output, err := runFuzzTest(ctx, pkgDir, corpusDir, target,
-		fuzzIterations, "GODEBUG=fuzzdebug=1")
+const (
+	// CorpusMinimizeDir is the directory, inside the report directory,
+	// where the progress of the corpus minimizations is saved, so that an
+	// interrupted minimization resumes in the next cycle.
+	CorpusMinimizeDir = "minimize"
+
+	// corpusBatchSize is the number of corpus inputs whose coverage is
+	// gathered in a batch, after which the progress is saved.
+	corpusBatchSize = 64
+
+	// baselineRun matches the seed corpus entries added with f.Add. With
+	// the checked-in seeds, they make the baseline run, whose coverage
+	// every input has.
+	baselineRun = `seed#[0-9]+`
+
+	// oomKillsScript defines the oom_kills shell function of the batch
+	// scripts, which prints how many processes the OOM killer of the
+	// cgroup v2 the script runs in has killed, or 0 if that is unknown.
+	oomKillsScript = `cg=$(sed -n 's/^0:://p' /proc/self/cgroup 2>/dev/null)
+oom_kills() {
+	n=$(sed -n 's/^oom_kill //p' "/sys/fs/cgroup$cg/memory.events" \
+		2>/dev/null)
+	echo "${n:-0}"
+}
+`
+)
+
+// corpusInput is an input of the corpus of a fuzz target.
+type corpusInput struct {
+	name string
+	size int64
+}
+
+// inputCoverage is the coverage of a corpus input.
+type inputCoverage struct {
+	// Blocks are the indexes, in minimizeState.Blocks, of the code blocks
+	// the input covers.
+	Blocks []int `json:",omitempty"`
+
+	// Failed is set if the fuzz target failed on the input, whose coverage
+	// is then unknown.
+	Failed bool `json:",omitempty"`
+}
+
+// minimizeState is the progress of the minimization of a target's corpus. It
+// is saved after every batch of inputs, so that an interrupted minimization
+// only gathers the coverage of the inputs left.
+type minimizeState struct {
+	// Binary is the checksum of the coverage-instrumented test binary the
+	// coverage was gathered with. The coverage of another binary, built
+	// from other code, is discarded.
+	Binary string
+
+	// Blocks are the code blocks covered by the inputs, as named in
+	// coverage profiles (e.g. "example.com/pkg/file.go:10.2,12.16").
+	Blocks []string
+
+	// Inputs holds the coverage of the corpus inputs gathered so far, by
+	// file name.
+	Inputs map[string]inputCoverage
+
+	// Complete is set once the inputs left out of the minimized corpus
+	// were removed.
+	Complete bool
+
+	// blockIndex maps the blocks to their index in Blocks.
+	blockIndex map[string]int
+}
+
+// minimizeStatePath returns the path of the file saving the progress of the
+// minimization of the task's corpus below reportDir.
+func minimizeStatePath(reportDir string, task Task) string {
+	return filepath.Join(reportDir, CorpusMinimizeDir, task.Package.Path,
+		task.Target+".json")
+}
+
+// newMinimizeState returns the state of a corpus minimization that has not
+// gathered any coverage yet.
+func newMinimizeState() *minimizeState {
+	return &minimizeState{
+		Inputs:     make(map[string]inputCoverage),
+		blockIndex: make(map[string]int),
+	}
+}
+
+// loadMinimizeState loads the progress of a corpus minimization. A missing
+// file yields an empty state.
+func loadMinimizeState(path string) (*minimizeState, error) {
+	state := newMinimizeState()
+
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return 0, fmt.Errorf("go test failed for %q: %w ", pkgDir, err)
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read minimization state %q: "+
+			"%w", path, err)
 	}
 
-	// Parse the fuzz output to extract the initial coverage bits.
-	//
-	// Return the number of coverage bits printed by the Go fuzzing engine
-	// after it finishes processing all inputs in the fuzz cache.
-	coverageRe := regexp.MustCompile(`initial coverage bits:\s+([0-9]+)\n`)
-	matches := coverageRe.FindStringSubmatch(output)
-	if len(matches) < 2 {
-		return 0, fmt.Errorf("coverage bits not found in output:\n%s",
-			output)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid JSON in minimization state "+
+			"%q: %w", path, err)
+	}
+	if state.Inputs == nil {
+		state.Inputs = make(map[string]inputCoverage)
+	}
+	for i, block := range state.Blocks {
+		state.blockIndex[block] = i
 	}
 
-	coverage, err := strconv.Atoi(matches[1])
+	return state, nil
+}
+
+// save writes the progress of the corpus minimization to path.
+func (s *minimizeState) save(path string) error {
+	data, err := json.Marshal(s)
 	if err != nil {
-		return 0, fmt.Errorf("parsing coverage: %w", err)
+		return fmt.Errorf("failed to serialize minimization state: %w",
+			err)
 	}
 
-	return coverage, nil
+	return writeFileAtomic(strings.NewReader(string(data)), path, 0644)
 }
 
-// MinimizeCorpus prunes unnecessary seed inputs from the corpus directory
-// while preserving the maximum observed coverage. It works by iteratively
-// testing each seed input (from smallest to largest, greedily) and removing
-// those that do not contribute to improved coverage.
-func MinimizeCorpus(ctx context.Context, logger *slog.Logger, pkgDir, corpusDir,
-	target string) error {
-
-	// Remove the seed fuzz testdata directory to start fresh.
-	fuzzTestDataDir := filepath.Join(pkgDir, "testdata", "fuzz", target)
-	if err := os.RemoveAll(fuzzTestDataDir); err != nil {
-		return fmt.Errorf("removing testdata: %w", err)
+// blockIndexes returns the indexes of the given blocks in Blocks, adding the
+// blocks seen for the first time.
+func (s *minimizeState) blockIndexes(blocks []string) []int {
+	indexes := make([]int, 0, len(blocks))
+	for _, block := range blocks {
+		i, ok := s.blockIndex[block]
+		if !ok {
+			i = len(s.Blocks)
+			s.Blocks = append(s.Blocks, block)
+			s.blockIndex[block] = i
+		}
+		indexes = append(indexes, i)
 	}
 
-	// Temporary directory for the corpus cache where inputs will be added
-	// one by one to check if they increase coverage.
-	cacheDir, err := os.MkdirTemp("", "go-continuous-fuzz-cache-")
-	if err != nil {
-		return fmt.Errorf("creating temp cache dir: %w", err)
+	return indexes
+}
+
+// corpusMinimizationPending reports whether the last minimization of the
+// task's corpus was interrupted, so that it resumes before the next scheduled
+// minimization.
+func corpusMinimizationPending(reportDir string, task Task) bool {
+	state, err := loadMinimizeState(minimizeStatePath(reportDir, task))
+
+	return err == nil && state.Binary != "" && !state.Complete
+}
+
+// batchRunner runs the coverage-instrumented test binary of a fuzz target on
+// batches of its seed corpus entries, one run per entry, in containers set up
+// like the fuzz target's fuzzing runs.
+type batchRunner struct {
+	wg     *WorkerGroup
+	task   Task
+	logger *slog.Logger
+	binary string
+
+	// workDir is mounted into the containers. It holds the test binary
+	// and the workspaces the batches run in.
+	workDir string
+
+	// testdataDir is the testdata directory of the fuzz target's package
+	// in the source tree, which every workspace holds a copy of, so that
+	// the fuzz target finds the files it reads and its checked-in seeds.
+	// Unlike the copy in the fuzz binary directory, it holds no crashers
+	// of the fuzzing runs.
+	testdataDir string
+
+	// seeds are the names of the checked-in seeds of the fuzz target,
+	// which stay in the workspaces beside the inputs of the batches.
+	seeds map[string]bool
+
+	// runTimeout bounds the run of a single entry.
+	runTimeout time.Duration
+}
+
+// corpusMinimizer gathers the coverage of every input of a fuzz target's
+// corpus, with a coverage-instrumented test binary running one input at a
+// time in the fuzz target's containers, and keeps the inputs a greedy set cover
+// picks.
+type corpusMinimizer struct {
+	batchRunner
+
+	gh        *GitHubRepo
+	corpusDir string
+	statePath string
+
+	// slots lends the CPUs of idle workers to gather the coverage of
+	// several batches at once, up to parallel batches. A nil slots
+	// gathers one batch at a time.
+	slots    *semaphore.Weighted
+	parallel int
+
+	// mu guards state and the progress of the minimization.
+	mu       sync.Mutex
+	state    *minimizeState
+	gathered int
+	pending  int
+	started  time.Time
+
+	// reportMu serializes the reports of the crashes found, and guards
+	// the signatures already reported.
+	reportMu sync.Mutex
+	reported map[string]bool
+}
+
+// minimizeCorpus prunes the corpus of the task's fuzz target down to a small
+// set of inputs covering the same code. It builds the target's test binary
+// with coverage instrumentation, runs it on every corpus input in containers
+// with the limits the target is fuzzed with, in batches spread across the CPUs
+// of the idle workers, and keeps the inputs a greedy set cover picks. Inputs
+// the target crashes on are kept and reported as findings. The coverage
+// gathered is saved in the report directory after every batch, so that an
+// interrupted minimization resumes where it stopped. The inputs are measured
+// in a copy of the corpus, so that other versions of the target keep fuzzing
+// meanwhile; the inputs they add are kept.
+func (wg *WorkerGroup) minimizeCorpus(task Task, gh *GitHubRepo) error {
+	cfg := wg.cfg
+	pkg, target := task.Package.Path, task.Target
+	logger := wg.logger.With("target", target).With("package", pkg)
+
+	// The work directory is mounted into the containers, like the
+	// directory of the fuzz binary it is created in.
+	workDir := filepath.Join(task.binaryDir(cfg.Project.BinaryDir),
+		CorpusMinimizeDir)
+	if err := os.RemoveAll(workDir); err != nil {
+		return fmt.Errorf("clearing minimization directory: %w", err)
 	}
 	defer func() {
-		if err := os.RemoveAll(cacheDir); err != nil {
-			logger.Error("Failed to remove cache", "error", err)
+		if err := os.RemoveAll(workDir); err != nil {
+			logger.Error("Failed to remove minimization directory",
+				"error", err)
 		}
 	}()
 
-	cacheCorpusDir := filepath.Join(cacheDir, target)
-	if err := EnsureDirExists(cacheCorpusDir); err != nil {
-		return fmt.Errorf("creating cache corpus dir: %w", err)
+	// The corpus is copied while no other version of the target writes
+	// inputs into it, and its inputs run from the copy.
+	corpusDir := filepath.Join(cfg.Project.CorpusDir, pkg, "testdata",
+		"fuzz", target)
+	snapshotDir := filepath.Join(workDir, "corpus")
+	corpusLock := wg.corpora.get(task)
+	corpusLock.Lock()
+	err := copyData(corpusDir, snapshotDir)
+	corpusLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("corpus copy failed: %w", err)
+	}
+	inputs, err := readCorpusInputs(snapshotDir)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	testdataDir := filepath.Join(cfg.Project.SrcDir, pkg, "testdata")
+	m := &corpusMinimizer{
+		batchRunner: batchRunner{
+			wg:          wg,
+			task:        task,
+			logger:      logger,
+			binary:      target + ".cover.test",
+			workDir:     workDir,
+			testdataDir: testdataDir,
+			runTimeout:  cfg.Fuzz.InputTimeout,
+		},
+		gh:        gh,
+		corpusDir: snapshotDir,
+		statePath: minimizeStatePath(cfg.Project.ReportDir, task),
+		slots:     wg.slots,
+		parallel:  max(cfg.Fuzz.NumWorkers, 1),
+		reported:  make(map[string]bool),
 	}
 
-	// Read and sort existing corpus files by size, so we iterate from the
-	// smallest to largest input, greedily adding those that improve
-	// coverage.
-	corpusTargetDir := filepath.Join(corpusDir, target)
-	entries, err := os.ReadDir(corpusTargetDir)
+	// Build the test binary with coverage instrumentation once, rather
+	// than running 'go test' for every input. The code a fuzz target
+	// exercises mostly lives in other packages of its module, such as
+	// the parser a fuzz test package calls, so the whole module is
+	// instrumented: inputs reaching new code there are kept too.
+	binaryPath := filepath.Join(workDir, m.binary)
+	err = buildCoverBinary(wg.ctx, cfg, task, "set",
+		task.Package.ModulePath+"/...", binaryPath)
+	if err != nil {
+		return err
+	}
+	checksum, err := fileChecksum(binaryPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+		return err
+	}
+
+	if err := m.loadState(checksum, inputs); err != nil {
+		return err
+	}
+	if err := m.loadSeeds(); err != nil {
+		return err
+	}
+
+	// Every input covers what the setup of the fuzz test, the f.Add seeds
+	// and the checked-in seeds cover, so only the rest counts. Failing
+	// seeds are reported by fuzzing.
+	baselineDir, err := m.workspace("baseline")
+	if err != nil {
+		return err
+	}
+	results, err := m.runBatch(wg.ctx, baselineDir,
+		[]string{m.baselineEntry()})
+	if err != nil {
+		return fmt.Errorf("gathering baseline coverage: %w", err)
+	}
+	baseline, crash, err := m.outcome(baselineDir, 0, results[0])
+	if err != nil {
+		return fmt.Errorf("gathering baseline coverage: %w", err)
+	}
+	if crash != nil {
+		logger.Warn("Seed corpus of fuzz target fails; not minimizing "+
+			"the corpus", "kind", crash.kind)
+		return nil
+	}
+
+	if err := m.gatherCoverage(wg.ctx, inputs); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	baselineBlocks := m.state.blockIndexes(baseline)
+	keep := selectCorpus(inputs, m.state.Inputs, baselineBlocks)
+	report := &minimizeReport{
+		Time:   time.Now().UTC(),
+		Kept:   len(keep),
+		Blocks: len(m.state.Blocks),
+		Dropped: explainDrops(inputs, m.state.Inputs, baselineBlocks,
+			keep),
+	}
+	for _, input := range inputs {
+		if m.state.Inputs[input.name].Failed {
+			report.Failed++
 		}
-		return fmt.Errorf("reading corpus dir: %w", err)
 	}
+	m.mu.Unlock()
 
-	// fileInfo represents the name and size of a file, used for sorting
-	// files by their size.
-	type fileInfo struct {
-		Name string
-		Size int64
+	// Only the inputs dropped are removed from the corpus, which keeps
+	// the inputs added since it was copied.
+	err = removeCorpusInputs(corpusLock, corpusDir, report.Dropped)
+	if err != nil {
+		return err
 	}
 
-	// Collect file information for sorting by size.
-	var files []fileInfo
+	reasons := make(map[dropReason]int)
+	for _, drop := range report.Dropped {
+		reasons[drop.Reason]++
+		logger.Debug("Removed corpus input", "input", drop.Name,
+			"size", drop.Size, "reason", drop.Reason, "coveredBy",
+			drop.CoveredBy)
+	}
+
+	err = report.save(minimizeReportPath(cfg.Project.ReportDir, task))
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.state.Complete = true
+	err = m.state.save(m.statePath)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("corpus minimization complete", "removedCount",
+		len(report.Dropped), "keptCount", report.Kept, "failedCount",
+		report.Failed, "removedBaseline", reasons[dropBaseline],
+		"removedCovered", reasons[dropCovered], "coveredBlocks",
+		report.Blocks)
+
+	return nil
+}
+
+// removeCorpusInputs removes the dropped inputs from the corpus directory dir,
+// while no other version of the target writes inputs into it.
+func removeCorpusInputs(corpusLock *sync.RWMutex, dir string,
+	dropped []droppedInput) error {
+
+	corpusLock.Lock()
+	defer corpusLock.Unlock()
+
+	for _, drop := range dropped {
+		err := os.Remove(filepath.Join(dir, drop.Name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing corpus input: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readCorpusInputs returns the inputs of the corpus directory dir, from the
+// smallest to the largest. A missing directory has no inputs.
+func readCorpusInputs(dir string) ([]corpusInput, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading corpus dir: %w", err)
+	}
+
+	var inputs []corpusInput
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if !entry.Type().IsRegular() {
 			continue
 		}
 		info, err := entry.Info()
 		if err != nil {
-			return fmt.Errorf("getting file info for %s: %w",
+			return nil, fmt.Errorf("getting file info for %s: %w",
 				entry.Name(), err)
 		}
-		files = append(files, fileInfo{
-			Name: entry.Name(),
-			Size: info.Size(),
+		inputs = append(inputs, corpusInput{
+			name: entry.Name(),
+			size: info.Size(),
 		})
 	}
 
-	// Sort files from smallest to largest by size.
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Size < files[j].Size
+	// Sort from the smallest to the largest, so that the set cover keeps
+	// the smallest of the inputs covering the same code.
+	sort.Slice(inputs, func(i, j int) bool {
+		if inputs[i].size != inputs[j].size {
+			return inputs[i].size < inputs[j].size
+		}
+		return inputs[i].name < inputs[j].name
 	})
 
-	// Calculate how many inputs were provided via f.Add() calls. This is
-	// necessary because the "initial coverage bits:" line is only printed
-	// after all baseline coverage inputs have been executed. Therefore, we
-	// need to include the f.Add inputs along with the corpus files' inputs
-	// when calculating the coverage bits.
-	fuzzAddInputs, err := calculateFuzzAddInputs(ctx, logger, pkgDir,
-		corpusDir, target)
+	return inputs, nil
+}
+
+// fileChecksum returns the hex-encoded SHA-256 checksum of the file at path.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to calculate f.Add inputs: %w", err)
+		return "", fmt.Errorf("opening %q: %w", path, err)
 	}
+	defer f.Close()
 
-	bestCoverage := 0
-	removedCount := 0
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading %q: %w", path, err)
+	}
 
-	// Iterate through each corpus file, measure its impact on coverage,
-	// and remove it if it does not improve or reduces the coverage.
-	for _, file := range files {
-		srcPath := filepath.Join(corpusTargetDir, file.Name)
-		dstPath := filepath.Join(cacheCorpusDir, file.Name)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadState loads the progress of an interrupted minimization of the corpus,
+// unless it was gathered with another binary than the one with the given
+// checksum, and forgets the inputs no longer in the corpus.
+func (m *corpusMinimizer) loadState(checksum string,
+	inputs []corpusInput) error {
+
+	state, err := loadMinimizeState(m.statePath)
+	if err != nil {
+		return err
+	}
+	if state.Binary != checksum {
+		state = newMinimizeState()
+		state.Binary = checksum
+	}
+
+	names := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		names[input.name] = true
+	}
+	for name := range state.Inputs {
+		if !names[name] {
+			delete(state.Inputs, name)
+		}
+	}
+	if !state.Complete && len(state.Inputs) > 0 {
+		m.logger.Info("Resuming corpus minimization", "gathered",
+			len(state.Inputs), "total", len(inputs))
+	}
+	state.Complete = false
+	m.state = state
+
+	return state.save(m.statePath)
+}
+
+// gatherCoverage gathers the coverage of the inputs not gathered yet, in
+// batches. The batches run one at a time on the worker minimizing the corpus,
+// and at once on the CPUs of other workers while they are idle.
+func (m *corpusMinimizer) gatherCoverage(ctx context.Context,
+	inputs []corpusInput) error {
+
+	var batches [][]corpusInput
+	var batch []corpusInput
+	for _, input := range inputs {
+		if _, ok := m.state.Inputs[input.name]; ok {
+			continue
+		}
+		batch = append(batch, input)
+		if len(batch) == corpusBatchSize {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		m.pending++
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	queue := make(chan []corpusInput, len(batches))
+	for _, batch := range batches {
+		queue <- batch
+	}
+	close(queue)
+
+	m.started = time.Now()
+	g, gctx := errgroup.WithContext(ctx)
+
+	// Other runners only wait for a free CPU while batches are left.
+	acquireCtx, drained := context.WithCancel(gctx)
+	defer drained()
 
-		// Copy file to temporary corpus directory.
-		if err := copyData(srcPath, dstPath); err != nil {
-			return fmt.Errorf("copy %q to cache: %w", srcPath, err)
+	for runner := 0; runner < m.parallel; runner++ {
+		lend := runner > 0 && m.slots != nil
+		if runner > 0 && !lend {
+			break
 		}
 
-		// Measure coverage with the current set in the temporary corpus
-		// directory.
-		newCoverage, err := MeasureCoverage(ctx, pkgDir, cacheDir,
-			target, fuzzAddInputs)
+		g.Go(func() error {
+			dir, err := m.workspace(fmt.Sprintf("runner%d", runner))
+			if err != nil {
+				return err
+			}
+
+			for {
+				if lend {
+					err := m.slots.Acquire(acquireCtx, 1000)
+					if err != nil {
+						return gctx.Err()
+					}
+				}
+				batch, ok := <-queue
+				if !ok {
+					if lend {
+						m.slots.Release(1000)
+					}
+					drained()
+					return nil
+				}
+
+				err := m.gatherBatch(gctx, dir, batch)
+				if lend {
+					m.slots.Release(1000)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		})
+	}
+
+	return g.Wait()
+}
+
+// gatherBatch gathers the coverage of a batch of inputs in the workspace dir,
+// one input per run of the test binary, and saves it. The crashes of the fuzz
+// target on the inputs are reported before the inputs are saved as failed.
+func (m *corpusMinimizer) gatherBatch(ctx context.Context, dir string,
+	batch []corpusInput) error {
+
+	names := make([]string, len(batch))
+	for i, input := range batch {
+		names[i] = input.name
+	}
+	runs, err := m.stage(dir, m.corpusDir, names)
+	if err != nil {
+		return err
+	}
+
+	results, err := m.runBatch(ctx, dir, runs)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	coverage := make(map[string][]string, len(batch))
+	failed := make(map[string]bool)
+	for i, input := range batch {
+		blocks, crash, err := m.outcome(dir, i, results[i])
+		if err != nil {
+			return err
+		}
+		if crash == nil {
+			coverage[input.name] = blocks
+			continue
+		}
+
+		m.logger.Warn("Fuzz target fails on corpus input; keeping it",
+			"input", input.name, "kind", crash.kind)
+		failed[input.name] = true
+
+		data, err := os.ReadFile(filepath.Join(m.corpusDir,
+			input.name))
+		if err != nil {
+			return fmt.Errorf("reading corpus input: %w", err)
+		}
+		crash.failingInput = string(data)
+		if err := m.report(crash); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, input := range batch {
+		m.state.Inputs[input.name] = inputCoverage{
+			Blocks: m.state.blockIndexes(coverage[input.name]),
+			Failed: failed[input.name],
+		}
+	}
+	if err := m.state.save(m.statePath); err != nil {
+		return err
+	}
+
+	m.gathered += len(batch)
+	elapsed := time.Since(m.started)
+	remaining := elapsed / time.Duration(m.gathered) *
+		time.Duration(m.pending-m.gathered)
+	m.logger.Info("Corpus minimization progress", "gathered", m.gathered,
+		"pending", m.pending, "elapsed", elapsed.Round(time.Second),
+		"remaining", remaining.Round(time.Second))
+
+	return nil
+}
+
+// report reports a crash of the fuzz target on a corpus input as a finding,
+// once per signature.
+func (m *corpusMinimizer) report(crash *fuzzCrash) error {
+	m.reportMu.Lock()
+	defer m.reportMu.Unlock()
+
+	signature := crash.signature(signatureOptions(&m.wg.cfg.Fuzz,
+		m.wg.modulePaths))
+	if m.reported[signature] {
+		return nil
+	}
+	m.reported[signature] = true
+
+	return m.wg.reportFinding(m.task, m.gh, crash, "corpus minimization")
+}
+
+// loadSeeds reads the names of the checked-in seeds of the fuzz target, from
+// the testdata directory of its package.
+func (r *batchRunner) loadSeeds() error {
+	seeds, err := readCorpusInputs(filepath.Join(r.testdataDir, "fuzz",
+		r.task.Target))
+	if err != nil {
+		return err
+	}
+
+	r.seeds = make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		r.seeds[seed.name] = true
+	}
+
+	return nil
+}
+
+// workspace creates a directory, named name in the work directory, holding a
+// copy of the testdata directory of the fuzz target's package, whose seed
+// corpus of the fuzz target holds the inputs of a batch beside the checked-in
+// seeds, and the output of the runs of the batch.
+func (r *batchRunner) workspace(name string) (string, error) {
+	dir := filepath.Join(r.workDir, name)
+	err := copyData(r.testdataDir, filepath.Join(dir, "testdata"))
+	if err != nil {
+		return "", fmt.Errorf("copying testdata directory: %w", err)
+	}
+	if err := EnsureDirExists(r.seedDir(dir)); err != nil {
+		return "", fmt.Errorf("creating workspace: %w", err)
+	}
+
+	return dir, nil
+}
+
+// seedDir returns the seed corpus directory of the fuzz target in the
+// workspace dir.
+func (r *batchRunner) seedDir(dir string) string {
+	return filepath.Join(dir, "testdata", "fuzz", r.task.Target)
+}
+
+// stage replaces the inputs of the last batch in the seed corpus of the
+// workspace dir with the named inputs of the corpus directory corpusDir, and
+// returns the seed corpus entries running them. An empty name stands for the
+// baseline run of the f.Add and checked-in seeds. The checked-in seeds stay in
+// place; a corpus input named like one of them has the same contents.
+func (r *batchRunner) stage(dir, corpusDir string, names []string) ([]string,
+	error) {
+
+	seedDir := r.seedDir(dir)
+	files, err := os.ReadDir(seedDir)
+	if err != nil {
+		return nil, fmt.Errorf("clearing workspace: %w", err)
+	}
+	for _, file := range files {
+		if r.seeds[file.Name()] {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(seedDir, file.Name()))
 		if err != nil {
-			return fmt.Errorf("measuring base coverage: %w", err)
+			return nil, fmt.Errorf("clearing workspace: %w", err)
 		}
+	}
 
-		if newCoverage > bestCoverage {
-			bestCoverage = newCoverage
+	entries := make([]string, len(names))
+	for i, name := range names {
+		if name == "" {
+			entries[i] = r.baselineEntry()
 			continue
 		}
+		err := copyData(filepath.Join(corpusDir, name),
+			filepath.Join(seedDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("copying corpus input: %w", err)
+		}
+		entries[i] = regexp.QuoteMeta(name)
+	}
+
+	return entries, nil
+}
+
+// baselineEntry returns the seed corpus entry matching the f.Add seeds and the
+// checked-in seeds of the fuzz target.
+func (r *batchRunner) baselineEntry() string {
+	alternatives := []string{baselineRun}
+	for _, name := range slices.Sorted(maps.Keys(r.seeds)) {
+		alternatives = append(alternatives, regexp.QuoteMeta(name))
+	}
+
+	return "(" + strings.Join(alternatives, "|") + ")"
+}
+
+// runBatch runs the test binary in the workspace dir once for each of the
+// given seed corpus entries of the fuzz target, which are regular expressions
+// matching their names, and returns the exit statuses of the runs. The runs of
+// a batch share a container, which a shell script runs them in one after
+// another, each with its own coverage profile and output files. A run is
+// reported as killed for exceeding the memory limit if the OOM killer of the
+// container's cgroup killed a process while it ran.
+func (r *batchRunner) runBatch(ctx context.Context, dir string,
+	entries []string) ([]ExitStatus, error) {
+
+	outDir := filepath.Join(dir, "cover")
+	if err := os.RemoveAll(outDir); err != nil {
+		return nil, fmt.Errorf("clearing workspace: %w", err)
+	}
+	if err := EnsureDirExists(outDir); err != nil {
+		return nil, fmt.Errorf("creating workspace: %w", err)
+	}
+
+	var script strings.Builder
+	fmt.Fprintf(&script, "cd %s || exit 1\n",
+		shellQuote(filepath.Base(dir)))
+	script.WriteString(oomKillsScript)
+	fmt.Fprintf(&script, "run() {\n\tbefore=$(oom_kills)\n"+
+		"\t../%s -test.run=\"$2\" -test.coverprofile=\"cover/$1.out\" "+
+		"-test.parallel=1 -test.timeout=%s >\"cover/$1.stdout\" "+
+		"2>\"cover/$1.stderr\"\n\tcode=$?\n\techo \"$1 $code "+
+		"$(($(oom_kills) - before))\" >>cover/status\n}\n",
+		shellQuote(r.binary), r.runTimeout)
+	for i, entry := range entries {
+		fmt.Fprintf(&script, "run %d %s\n", i, shellQuote(fmt.Sprintf(
+			"^%s$/^%s$", regexp.QuoteMeta(r.task.Target), entry)))
+	}
+
+	scriptName := filepath.Base(dir) + ".sh"
+	err := os.WriteFile(filepath.Join(r.workDir, scriptName),
+		[]byte(script.String()), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("writing batch script: %w", err)
+	}
 
-		if newCoverage < bestCoverage {
-			logger.Warn("nondeterministic fuzz target: coverage "+
-				"decreased", "file", file.Name, "oldCoverage",
-				bestCoverage, "newCoverage", newCoverage)
+	// Every run is bounded by its test timeout; the container is bounded
+	// too, in case a run does not stop at it.
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(len(entries))*
+		r.runTimeout+ContainerGracePeriod)
+	defer cancel()
+
+	_, err = runContainer(r.wg.sandboxContainer(ctx, r.task, r.workDir,
+		[]string{"sh", scriptName}), r.task)
+	if err != nil {
+		return nil, fmt.Errorf("coverage batch failed: %w", err)
+	}
+
+	return readBatchStatus(filepath.Join(outDir, "status"), len(entries))
+}
+
+// readBatchStatus reads the exit statuses of the n runs of a batch from the
+// status file the batch script writes: the index of every run, its exit code
+// and the number of processes the OOM killer killed while it ran.
+func readBatchStatus(path string, n int) ([]ExitStatus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading batch status: %w", err)
+	}
+
+	statuses := make([]ExitStatus, n)
+	done := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(data)),
+		"\n") {
+
+		var i, code, oomKills int
+		_, err := fmt.Sscanf(line, "%d %d %d", &i, &code, &oomKills)
+		if err != nil || i < 0 || i >= n {
+			return nil, fmt.Errorf("invalid batch status line %q",
+				line)
 		}
+		statuses[i] = ExitStatus{Code: code, OOMKilled: oomKills > 0}
+		done++
+	}
+	if done != n {
+		return nil, fmt.Errorf("batch finished %d of %d runs", done, n)
+	}
+
+	return statuses, nil
+}
 
-		// Remove the file from both the source and cache directories
-		// since it did not improve coverage or caused a coverage
-		// regression.
-		if err := os.Remove(srcPath); err != nil {
-			return fmt.Errorf("remove %q: %w", srcPath, err)
+// outcome returns the code blocks the i-th run of the last batch in the
+// workspace dir covered, or the crash of the fuzz target if the run exited
+// with the given non-zero status. A run without a failure report of the
+// testing package crashed the test binary, or ran out of memory.
+func (r *batchRunner) outcome(dir string, i int, status ExitStatus) (
+	[]string, *fuzzCrash, error) {
+
+	outPath := filepath.Join(dir, "cover", strconv.Itoa(i))
+	if status.Code == 0 {
+		f, err := os.Open(outPath + ".out")
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening coverage "+
+				"profile: %w", err)
 		}
-		if err := os.Remove(dstPath); err != nil {
-			return fmt.Errorf("remove %q: %w", dstPath, err)
+		defer f.Close()
+
+		blocks, err := parseCoverProfile(f)
+		return blocks, nil, err
+	}
+
+	stdout, err := os.Open(outPath + ".stdout")
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening run output: %w", err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Open(outPath + ".stderr")
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening run output: %w", err)
+	}
+	defer stderr.Close()
+
+	processor := NewFuzzOutputProcessor(r.logger, filepath.Join(dir,
+		"testdata", "fuzz"))
+	processor.outputLevel = slog.LevelDebug
+	processor.redactor = configRedactor(r.wg.cfg)
+	crash, err := processor.processOutput(stdout, stderr)
+	if err != nil || crash != nil {
+		return nil, crash, err
+	}
+
+	out, errOut := processor.recentOutput()
+	kind := crashKindFailure
+	if ranOutOfMemory(status, out+errOut) {
+		kind = crashKindOOM
+	}
+
+	return nil, &fuzzCrash{
+		kind: kind,
+		errorLogs: out + fmt.Sprintf("test binary exited with "+
+			"status %d\n", status.Code),
+		stderrLogs: errOut,
+	}, nil
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseCoverProfile returns the code blocks a coverage profile shows as
+// covered, each once.
+func parseCoverProfile(r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	var blocks []string
+
+	err := scanCoverProfile(r, func(block string, _ int, count int64) {
+		if count == 0 || seen[block] {
+			return
 		}
-		removedCount++
+		seen[block] = true
+		blocks = append(blocks, block)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// scanCoverProfile calls fn with every code block of a coverage profile, its
+// number of statements and how many times it ran, or 1 if it ran in the set
+// mode.
+func scanCoverProfile(r io.Reader,
+	fn func(block string, statements int, count int64)) error {
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		// Lines are "<file>:<start>,<end> <statements> <count>".
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid coverage profile line %q",
+				line)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid coverage profile line %q: "+
+				"%w", line, err)
+		}
+		count, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid coverage profile line %q: "+
+				"%w", line, err)
+		}
+		fn(fields[0], statements, count)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading coverage profile: %w", err)
 	}
 
-	logger.Info("corpus minimization complete", "removedCount",
-		removedCount, "finalCoverage", bestCoverage)
 	return nil
 }
 
-// calculateFuzzAddInputs runs `go test` with fuzzing enabled to determine
-// how many inputs were added via f.Add() calls in the fuzz target.
-//
-// It does this by:
-//  1. Running the fuzz target once to collect the total baseline inputs.
-//  2. Counting the number of existing corpus files for that target.
-//  3. Subtracting the existing corpus files from the total baseline inputs.
-func calculateFuzzAddInputs(ctx context.Context, logger *slog.Logger, pkgDir,
-	corpusDir, target string) (int, error) {
+// coverCandidate is a corpus input in the queue of the greedy set cover, with
+// the number of blocks it covers beyond those covered when it was queued.
+type coverCandidate struct {
+	index int
+	gain  int
+}
+
+// coverQueue is a max-heap of candidates by gain, the smallest input first on
+// ties, which the inputs' order by size gives.
+type coverQueue []coverCandidate
 
-	// Run the fuzz target once to collect baseline inputs.
-	output, err := runFuzzTest(ctx, pkgDir, corpusDir, target, 1)
-	if err != nil {
-		return 0, fmt.Errorf("go test failed for %q: %w ", pkgDir, err)
+func (q coverQueue) Len() int { return len(q) }
+
+func (q coverQueue) Less(i, j int) bool { return q[i].before(q[j]) }
+
+func (q coverQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *coverQueue) Push(x any) { *q = append(*q, x.(coverCandidate)) }
+
+func (q *coverQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return c
+}
+
+// before reports whether c is picked before o.
+func (c coverCandidate) before(o coverCandidate) bool {
+	if c.gain != o.gain {
+		return c.gain > o.gain
+	}
+
+	return c.index < o.index
+}
+
+// selectCorpus returns the names of the inputs to keep: those the fuzz target
+// failed on, and a small set of the others covering every block they cover
+// beyond the baseline. The set is picked greedily, the input covering the most
+// blocks not covered yet first, the smallest on ties. Since the gain of an
+// input only shrinks as others are picked, gains are recomputed lazily.
+func selectCorpus(inputs []corpusInput, coverage map[string]inputCoverage,
+	baseline []int) map[string]bool {
+
+	keep := make(map[string]bool)
+	covered := make(map[int]bool)
+	for _, block := range baseline {
+		covered[block] = true
 	}
 
-	// Parse the fuzz output to extract the total baseline inputs.
-	//
-	// Returns the number of baseline coverage inputs reported by the Go
-	// fuzzing engine while processing inputs from the fuzz cache.
-	coverageRe := regexp.MustCompile(
-		`gathering baseline coverage:\s+\d+/(\d+)`)
-	matches := coverageRe.FindStringSubmatch(output)
-	if len(matches) < 2 {
-		return 0, fmt.Errorf("baseline inputs not found in output:\n%s",
-			output)
+	gain := func(index int) int {
+		n := 0
+		for _, block := range coverage[inputs[index].name].Blocks {
+			if !covered[block] {
+				n++
+			}
+		}
+		return n
+	}
+
+	queue := &coverQueue{}
+	for i, input := range inputs {
+		if coverage[input.name].Failed {
+			keep[input.name] = true
+			continue
+		}
+		*queue = append(*queue, coverCandidate{index: i, gain: gain(i)})
 	}
+	heap.Init(queue)
+
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(coverCandidate)
+		c.gain = gain(c.index)
+		if c.gain == 0 {
+			continue
+		}
+		if queue.Len() > 0 && (*queue)[0].before(c) {
+			heap.Push(queue, c)
+			continue
+		}
+
+		keep[inputs[c.index].name] = true
+		for _, block := range coverage[inputs[c.index].name].Blocks {
+			covered[block] = true
+		}
+	}
+
+	return keep
+}
+
+// dropReason explains why an input was removed from a minimized corpus.
+type dropReason string
+
+const (
+	// dropBaseline drops an input covering no block beyond those the
+	// setup of the fuzz test and the f.Add seeds cover.
+	dropBaseline dropReason = "baseline"
+
+	// dropCovered drops an input whose blocks are all covered by the
+	// inputs kept.
+	dropCovered dropReason = "covered"
+)
+
+// droppedInput is an input removed from a minimized corpus.
+type droppedInput struct {
+	Name   string
+	Size   int64
+	Reason dropReason
+
+	// CoveredBy are inputs kept that, together, cover the blocks of a
+	// dropped input beyond the baseline.
+	CoveredBy []string `json:",omitempty"`
+}
+
+// minimizeReport lists the inputs the last minimization of a target's corpus
+// removed, and why.
+type minimizeReport struct {
+	Time    time.Time
+	Kept    int
+	Failed  int
+	Blocks  int
+	Dropped []droppedInput
+}
+
+// minimizeReportPath returns the path, below reportDir, of the report of the
+// last minimization of the task's corpus.
+func minimizeReportPath(reportDir string, task Task) string {
+	return filepath.Join(reportDir, CorpusMinimizeDir, task.Package.Path,
+		task.Target+".report.json")
+}
 
-	totalBaselineInputs, err := strconv.Atoi(matches[1])
+// save writes the minimization report to path.
+func (r *minimizeReport) save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
 	if err != nil {
-		return 0, fmt.Errorf("parsing baseline inputs: %w", err)
+		return fmt.Errorf("failed to serialize minimization report: %w",
+			err)
 	}
 
-	// Count existing corpus files for this target.
-	corpusFileCount := 0
-	corpusTargetDir := filepath.Join(corpusDir, target)
-	files, err := os.ReadDir(corpusTargetDir)
+	return writeFileAtomic(strings.NewReader(string(data)), path, 0644)
+}
+
+// explainDrops returns the inputs left out of keep, with why: they cover
+// nothing beyond the baseline, or the inputs kept cover all they cover. The
+// inputs kept that cover the blocks of a dropped input are picked greedily,
+// the one covering most of its blocks first, so that few are listed.
+func explainDrops(inputs []corpusInput, coverage map[string]inputCoverage,
+	baseline []int, keep map[string]bool) []droppedInput {
+
+	inBaseline := make(map[int]bool, len(baseline))
+	for _, block := range baseline {
+		inBaseline[block] = true
+	}
+
+	// keptBy lists the inputs kept covering each block.
+	keptBy := make(map[int][]string)
+	for _, input := range inputs {
+		if !keep[input.name] {
+			continue
+		}
+		for _, block := range coverage[input.name].Blocks {
+			keptBy[block] = append(keptBy[block], input.name)
+		}
+	}
+
+	var dropped []droppedInput
+	for _, input := range inputs {
+		if keep[input.name] {
+			continue
+		}
+
+		left := make(map[int]bool)
+		for _, block := range coverage[input.name].Blocks {
+			if !inBaseline[block] {
+				left[block] = true
+			}
+		}
+		drop := droppedInput{
+			Name:   input.name,
+			Size:   input.size,
+			Reason: dropBaseline,
+		}
+		if len(left) > 0 {
+			drop.Reason = dropCovered
+		}
+
+		for len(left) > 0 {
+			gains := make(map[string]int)
+			best := ""
+			for block := range left {
+				for _, name := range keptBy[block] {
+					gains[name]++
+					if gains[name] > gains[best] ||
+						gains[name] == gains[best] &&
+							name < best {
+
+						best = name
+					}
+				}
+			}
+
+			// The set cover keeps every block covered; a block
+			// left uncovered only comes from inconsistent data.
+			if best == "" {
+				break
+			}
+
+			drop.CoveredBy = append(drop.CoveredBy, best)
+			for _, block := range coverage[best].Blocks {
+				delete(left, block)
+			}
+		}
+
+		dropped = append(dropped, drop)
+	}
+
+	return dropped
+}
+
+// recentCorpusInputs returns the contents of up to n inputs of the corpus
+// directory dir that were written at or after since, newest first. A missing
+// directory has no inputs.
+func recentCorpusInputs(dir string, since time.Time, n int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return 0, fmt.Errorf("reading corpus dir: %w", err)
+		return nil, fmt.Errorf("reading corpus directory: %w", err)
+	}
+
+	type input struct {
+		path    string
+		modTime time.Time
+	}
+	var inputs []input
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
 		}
-	} else {
-		corpusFileCount = len(files)
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("reading corpus input: %w", err)
+		}
+		if info.ModTime().Before(since) {
+			continue
+		}
+		inputs = append(inputs, input{
+			path:    filepath.Join(dir, entry.Name()),
+			modTime: info.ModTime(),
+		})
 	}
 
-	// Inputs from f.Add() = total baseline inputs - existing corpus files
-	addedInputs := totalBaselineInputs - corpusFileCount
-	logger.Info("calculated inputs added via f.Add()", "count", addedInputs)
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].modTime.After(inputs[j].modTime)
+	})
+
+	contents := make([]string, 0, min(n, len(inputs)))
+	for _, in := range inputs[:min(n, len(inputs))] {
+		data, err := os.ReadFile(in.path)
+		if err != nil {
+			return nil, fmt.Errorf("reading corpus input: %w", err)
+		}
+		contents = append(contents, string(data))
+	}
 
-	return addedInputs, nil
+	return contents, nil
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseCoverProfile verifies that the covered blocks of a coverage profile
+// are returned once each, and that uncovered blocks are left out.
+func TestParseCoverProfile(t *testing.T) {
+	blocks, err := parseCoverProfile(strings.NewReader(
+		"mode: set\n" +
+			"example.com/p/a.go:3.2,5.16 2 1\n" +
+			"example.com/p/a.go:6.2,6.10 1 0\n" +
+			"example.com/p/b.go:1.1,2.2 1 1\n" +
+			"example.com/p/a.go:3.2,5.16 2 1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com/p/a.go:3.2,5.16",
+		"example.com/p/b.go:1.1,2.2"}, blocks)
+
+	_, err = parseCoverProfile(strings.NewReader("mode: set\nbroken\n"))
+	assert.Error(t, err)
+}
+
+// TestSelectCorpus verifies that the greedy set cover keeps the inputs covering
+// the most new blocks, the smallest on ties, ignores the blocks of the
+// baseline, and keeps the inputs the fuzz target failed on.
+func TestSelectCorpus(t *testing.T) {
+	inputs := []corpusInput{
+		{name: "small", size: 1},
+		{name: "same", size: 2},
+		{name: "big", size: 3},
+		{name: "baseline", size: 4},
+		{name: "unique", size: 5},
+		{name: "failed", size: 6},
+	}
+	coverage := map[string]inputCoverage{
+		"small":    {Blocks: []int{0, 1, 2}},
+		"same":     {Blocks: []int{0, 1, 2}},
+		"big":      {Blocks: []int{0, 1, 2, 3, 4}},
+		"baseline": {Blocks: []int{0}},
+		"unique":   {Blocks: []int{0, 5}},
+		"failed":   {Failed: true},
+	}
+
+	keep := selectCorpus(inputs, coverage, []int{0})
+	assert.Equal(t, map[string]bool{
+		"big":    true,
+		"unique": true,
+		"failed": true,
+	}, keep)
+
+	// Without the biggest input, the smallest of the equal ones stays.
+	delete(coverage, "big")
+	keep = selectCorpus(append(inputs[:2:2], inputs[3:]...), coverage,
+		[]int{0})
+	assert.Equal(t, map[string]bool{
+		"small":  true,
+		"unique": true,
+		"failed": true,
+	}, keep)
+}
+
+// TestExplainDrops verifies that the inputs left out of a minimized corpus are
+// explained by the baseline or by the few inputs kept that cover their blocks.
+func TestExplainDrops(t *testing.T) {
+	inputs := []corpusInput{
+		{name: "base", size: 1},
+		{name: "part", size: 2},
+		{name: "spread", size: 3},
+		{name: "left", size: 4},
+		{name: "right", size: 5},
+		{name: "failed", size: 6},
+	}
+	coverage := map[string]inputCoverage{
+		"base":   {Blocks: []int{0}},
+		"part":   {Blocks: []int{0, 1}},
+		"spread": {Blocks: []int{1, 2, 3, 4}},
+		"left":   {Blocks: []int{1, 2, 3}},
+		"right":  {Blocks: []int{3, 4}},
+		"failed": {Failed: true},
+	}
+	keep := map[string]bool{"left": true, "right": true, "failed": true}
+
+	dropped := explainDrops(inputs, coverage, []int{0}, keep)
+	assert.Equal(t, []droppedInput{
+		{Name: "base", Size: 1, Reason: dropBaseline},
+		{Name: "part", Size: 2, Reason: dropCovered,
+			CoveredBy: []string{"left"}},
+		{Name: "spread", Size: 3, Reason: dropCovered,
+			CoveredBy: []string{"left", "right"}},
+	}, dropped)
+}
+
+// TestReadBatchStatus verifies that the exit statuses of the runs of a batch
+// are read back from its status file, which must list every run, and that only
+// runs during which the OOM killer struck count as killed for their memory.
+func TestReadBatchStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status")
+	require.NoError(t, os.WriteFile(path,
+		[]byte("0 0 0\n2 137 1\n1 2 0\n3 137 0\n"), 0644))
+
+	statuses, err := readBatchStatus(path, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []ExitStatus{{Code: 0}, {Code: 2},
+		{Code: 137, OOMKilled: true}, {Code: 137}}, statuses)
+
+	_, err = readBatchStatus(path, 5)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("0 0 0\n5 1 0\n"),
+		0644))
+	_, err = readBatchStatus(path, 2)
+	assert.Error(t, err)
+
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+// TestMinimizeState verifies that the progress of a corpus minimization is
+// saved and loaded back, and that an interrupted minimization is pending.
+func TestMinimizeState(t *testing.T) {
+	reportDir := t.TempDir()
+	task := Task{Package: GoPackage{Path: "parser"}, Target: "FuzzFoo"}
+	path := minimizeStatePath(reportDir, task)
+	assert.Equal(t, filepath.Join(reportDir, CorpusMinimizeDir, "parser",
+		"FuzzFoo.json"), path)
+	assert.False(t, corpusMinimizationPending(reportDir, task))
+
+	state, err := loadMinimizeState(path)
+	require.NoError(t, err)
+	state.Binary = "abc"
+	state.Inputs["in1"] = inputCoverage{
+		Blocks: state.blockIndexes([]string{"a.go:1.1,2.2",
+			"b.go:1.1,2.2"}),
+	}
+	state.Inputs["in2"] = inputCoverage{
+		Blocks: state.blockIndexes([]string{"b.go:1.1,2.2"}),
+	}
+	require.NoError(t, state.save(path))
+	assert.True(t, corpusMinimizationPending(reportDir, task))
+
+	loaded, err := loadMinimizeState(path)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, loaded.Inputs["in1"].Blocks)
+	assert.Equal(t, []int{1}, loaded.Inputs["in2"].Blocks)
+	assert.Equal(t, []int{1, 2}, loaded.blockIndexes([]string{
+		"b.go:1.1,2.2", "c.go:1.1,2.2"}))
+
+	loaded.Complete = true
+	require.NoError(t, loaded.save(path))
+	assert.False(t, corpusMinimizationPending(reportDir, task))
+}
+
+// TestBatchRunnerTestdata verifies that the runs of a batch find the testdata
+// directory of the fuzz target's package, and that the baseline run runs the
+// checked-in seeds of the fuzz target beside the f.Add seeds, while the run of
+// a corpus input only runs that input.
+func TestBatchRunnerTestdata(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("coverage binaries are built for linux/amd64")
+	}
+
+	srcDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		"go.mod": "module example.com/fix\n\ngo 1.24\n",
+		"fix.go": "package fix\n\n" +
+			"func Check(data []byte) bool {\n" +
+			"\tif string(data) == \"checked in\" {\n" +
+			"\t\treturn true\n" +
+			"\t}\n" +
+			"\treturn false\n" +
+			"}\n",
+		"fix_test.go": "package fix\n\n" +
+			"import (\n\t\"os\"\n\t\"testing\"\n)\n\n" +
+			"func FuzzFix(f *testing.F) {\n" +
+			"\tdata, err := os.ReadFile(\"testdata/fixture\")\n" +
+			"\tif err != nil {\n" +
+			"\t\tf.Fatal(err)\n" +
+			"\t}\n" +
+			"\tf.Add(data)\n" +
+			"\tf.Fuzz(func(t *testing.T, data []byte) {\n" +
+			"\t\tCheck(data)\n" +
+			"\t})\n" +
+			"}\n",
+		"testdata/fixture": "fixture",
+		"testdata/fuzz/FuzzFix/checked-in": "go test fuzz v1\n" +
+			"[]byte(\"checked in\")\n",
+		"corpus/input": "go test fuzz v1\n[]byte(\"input\")\n",
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner, err := newProcessRunner(logger, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, runner.Close()) })
+
+	cfg := &Config{Project: Project{SrcDir: srcDir}}
+	wg := &WorkerGroup{
+		ctx:         context.Background(),
+		logger:      logger,
+		runner:      runner,
+		cfg:         cfg,
+		cycleReport: newCycleReport(nil),
+	}
+	task := Task{
+		Package: GoPackage{Path: ".", ModuleDir: ".",
+			ModulePath: "example.com/fix"},
+		Target: "FuzzFix",
+	}
+	r := &batchRunner{
+		wg:          wg,
+		task:        task,
+		logger:      logger,
+		binary:      "FuzzFix.cover.test",
+		workDir:     t.TempDir(),
+		testdataDir: filepath.Join(srcDir, "testdata"),
+		runTimeout:  time.Minute,
+	}
+	require.NoError(t, buildCoverBinary(wg.ctx, cfg, task, "set", "",
+		filepath.Join(r.workDir, r.binary)))
+	require.NoError(t, r.loadSeeds())
+
+	dir, err := r.workspace("runner")
+	require.NoError(t, err)
+	entries, err := r.stage(dir, filepath.Join(srcDir, "corpus"),
+		[]string{"", "input"})
+	require.NoError(t, err)
+
+	statuses, err := r.runBatch(wg.ctx, dir, entries)
+	require.NoError(t, err)
+	require.Equal(t, []ExitStatus{{}, {}}, statuses)
+
+	// Only the checked-in seed covers the block returning true.
+	checkedIn := func(block string) bool {
+		return strings.HasPrefix(block, "example.com/fix/fix.go:5.")
+	}
+	baseline, crash, err := r.outcome(dir, 0, statuses[0])
+	require.NoError(t, err)
+	assert.Nil(t, crash)
+	assert.True(t, slices.ContainsFunc(baseline, checkedIn))
+
+	input, crash, err := r.outcome(dir, 1, statuses[1])
+	require.NoError(t, err)
+	assert.Nil(t, crash)
+	assert.NotEmpty(t, input)
+	assert.False(t, slices.ContainsFunc(input, checkedIn))
+
+	// The next batch replaces the corpus inputs, but keeps the checked-in
+	// seeds.
+	_, err = r.stage(dir, filepath.Join(srcDir, "corpus"), nil)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(r.seedDir(dir), "input"))
+	assert.FileExists(t, filepath.Join(r.seedDir(dir), "checked-in"))
+}
+
+// TestRemoveCorpusInputs verifies that only the dropped inputs are removed
+// from the corpus, so that inputs added while it was minimized are kept, and
+// that dropped inputs already gone are no error.
+func TestRemoveCorpusInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"dropped": "dropped",
+		"kept":    "kept",
+		"added":   "added",
+	})
+
+	var corpusLock sync.RWMutex
+	err := removeCorpusInputs(&corpusLock, dir, []droppedInput{
+		{Name: "dropped"}, {Name: "gone"},
+	})
+	require.NoError(t, err)
+
+	inputs, err := readCorpusInputs(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []corpusInput{{name: "kept", size: 4},
+		{name: "added", size: 5}}, inputs)
+}
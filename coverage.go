@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// coverageDir is the directory, inside the binary directory of a task, where
+// the coverage of its fuzz target's corpus is measured.
+const coverageDir = "coverage"
+
+// buildCoverBinary builds the test binary of the task's package with coverage
+// instrumentation in the given mode at binaryPath, on the host, for the
+// containers the fuzz target runs in. The packages matching the coverPkg
+// pattern are instrumented, or only the task's package if it is empty.
+// Building does not run project code.
+func buildCoverBinary(ctx context.Context, cfg *Config, task Task, mode,
+	coverPkg, binaryPath string) error {
+
+	args := []string{"test", "-c", "-cover", "-covermode=" + mode}
+	if coverPkg != "" {
+		args = append(args, "-coverpkg="+coverPkg)
+	}
+	args = append(args, "-o", binaryPath, task.Package.RelPath())
+
+	env := append(goEnv(cfg, task.GoVersion), "GOOS=linux", "GOARCH=amd64")
+	_, err := runGoCommand(ctx, task.Package.moduleRootPath(
+		cfg.Project.SrcDir), args, env...)
+	if err != nil {
+		return fmt.Errorf("building coverage binary: %w", err)
+	}
+
+	return nil
+}
+
+// sandboxContainer returns the container running cmd in workDir for the task,
+// with the image, resource limits and sandbox its fuzz target is fuzzed with.
+// The output of the run is only logged at the debug level.
+func (wg *WorkerGroup) sandboxContainer(ctx context.Context, task Task,
+	workDir string, cmd []string) *Container {
+
+	cfg := wg.cfg
+	pkg, target := task.Package.Path, task.Target
+
+	return &Container{
+		ctx:            ctx,
+		logger:         wg.logger,
+		runner:         wg.runner,
+		image:          targetImage(&cfg.Fuzz, task),
+		fuzzBinaryPath: workDir,
+		hostCorpusPath: filepath.Join(cfg.Project.CorpusDir, pkg,
+			"testdata", "fuzz"),
+		cmd:     cmd,
+		limits:  resourceLimits(&cfg.Fuzz, pkg, target),
+		sandbox: sandboxOptions(&cfg.Fuzz, pkg, target),
+		labels: withOwnerLabels(cfg, taskLabels(cfg, task,
+			wg.cycleReport.CycleID)),
+		quiet:    true,
+		redactor: configRedactor(cfg),
+	}
+}
+
+// measureCoverage runs the task's fuzz target on its f.Add seeds and on every
+// input of its corpus with a coverage-instrumented test binary, one run per
+// input, in batches of runs in containers like the fuzzing runs, and returns
+// the path of the coverage profile merging those of the runs. Every run is
+// bounded by the input timeout, while a batch that does not finish in time
+// fails the measurement. The crashes of the runs are reported as findings of
+// the target, once per signature, and the inputs crashed on are left out of the
+// profile, so that a crasher kept in the corpus does not keep the coverage
+// report from being updated. If no run succeeded, the returned path is empty.
+func (wg *WorkerGroup) measureCoverage(task Task, gh *GitHubRepo) (string,
+	error) {
+
+	cfg, target := wg.cfg, task.Target
+	dir := filepath.Join(task.binaryDir(cfg.Project.BinaryDir), coverageDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("clearing coverage directory: %w", err)
+	}
+
+	testdataDir := filepath.Join(cfg.Project.SrcDir, task.Package.Path,
+		"testdata")
+	r := &batchRunner{
+		wg:          wg,
+		task:        task,
+		logger:      wg.logger,
+		binary:      target + ".cover.test",
+		workDir:     dir,
+		testdataDir: testdataDir,
+		runTimeout:  cfg.Fuzz.InputTimeout,
+	}
+	if err := r.loadSeeds(); err != nil {
+		return "", err
+	}
+	err := buildCoverBinary(wg.ctx, cfg, task, "count", "",
+		filepath.Join(dir, r.binary))
+	if err != nil {
+		return "", err
+	}
+
+	// The corpus is copied while no other version of the target writes
+	// inputs into it, and its inputs run from the copy.
+	corpusDir := filepath.Join(dir, "corpus")
+	corpusLock := wg.corpora.get(task)
+	corpusLock.Lock()
+	err = copyData(filepath.Join(cfg.Project.CorpusDir, task.Package.Path,
+		"testdata", "fuzz", target), corpusDir)
+	corpusLock.Unlock()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("corpus copy failed: %w", err)
+	}
+	inputs, err := readCorpusInputs(corpusDir)
+	if err != nil {
+		return "", err
+	}
+
+	workspace, err := r.workspace("runner")
+	if err != nil {
+		return "", err
+	}
+
+	// The f.Add and checked-in seeds run first, in a run of their own; the
+	// name of every other run is the name of its corpus input.
+	names := []string{""}
+	for _, input := range inputs {
+		names = append(names, input.name)
+	}
+
+	profile := newCoverProfile()
+	reported := make(map[string]bool)
+	ran, failed := 0, 0
+	for start := 0; start < len(names); start += corpusBatchSize {
+		batch := names[start:min(start+corpusBatchSize, len(names))]
+
+		entries, err := r.stage(workspace, corpusDir, batch)
+		if err != nil {
+			return "", err
+		}
+
+		statuses, err := r.runBatch(wg.ctx, workspace, entries)
+		if wg.ctx.Err() != nil {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("coverage run failed: %w", err)
+		}
+
+		for i, name := range batch {
+			outPath := filepath.Join(workspace, "cover",
+				strconv.Itoa(i))
+			if statuses[i].Code == 0 {
+				err := profile.merge(outPath + ".out")
+				if err != nil {
+					return "", err
+				}
+				ran++
+				continue
+			}
+
+			_, crash, err := r.outcome(workspace, i, statuses[i])
+			if err != nil {
+				return "", err
+			}
+			failed++
+
+			if name != "" {
+				data, err := os.ReadFile(filepath.Join(
+					corpusDir, name))
+				if err != nil {
+					return "", fmt.Errorf("reading corpus "+
+						"input: %w", err)
+				}
+				crash.failingInput = string(data)
+			}
+
+			signature := crash.signature(signatureOptions(
+				&cfg.Fuzz, wg.modulePaths))
+			if reported[signature] {
+				continue
+			}
+			reported[signature] = true
+
+			err = wg.reportFinding(task, gh, crash, "coverage run")
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	wg.logger.Info("Measured corpus coverage", "package",
+		task.Package.Path, "target", target, "inputs", len(inputs),
+		"failed", failed)
+	if ran == 0 {
+		return "", nil
+	}
+
+	profilePath := filepath.Join(dir, target+".cover.out")
+	if err := profile.write(profilePath); err != nil {
+		return "", err
+	}
+
+	return profilePath, nil
+}
+
+// coverProfile merges the coverage profiles of the runs of a test binary built
+// in the count mode, summing the counts of every code block.
+type coverProfile struct {
+	blocks     []string
+	statements map[string]int
+	counts     map[string]int64
+}
+
+// newCoverProfile returns an empty merged coverage profile.
+func newCoverProfile() *coverProfile {
+	return &coverProfile{
+		statements: make(map[string]int),
+		counts:     make(map[string]int64),
+	}
+}
+
+// merge adds the coverage profile at path to the merged profile.
+func (p *coverProfile) merge(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening coverage profile: %w", err)
+	}
+	defer f.Close()
+
+	return scanCoverProfile(f, func(block string, n int, count int64) {
+		if _, ok := p.statements[block]; !ok {
+			p.blocks = append(p.blocks, block)
+			p.statements[block] = n
+		}
+		p.counts[block] += count
+	})
+}
+
+// write writes the merged profile to path, in the count mode.
+func (p *coverProfile) write(path string) error {
+	var b strings.Builder
+	b.WriteString("mode: count\n")
+	for _, block := range p.blocks {
+		fmt.Fprintf(&b, "%s %d %d\n", block, p.statements[block],
+			p.counts[block])
+	}
+
+	err := os.WriteFile(path, []byte(b.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("writing coverage profile: %w", err)
+	}
+
+	return nil
+}
+
+// reportFinding reports a crash of the task's fuzz target found outside of
+// fuzzing, during the given kind of run, as the crashes found by fuzzing are:
+// unless an issue exists for it, its failing input is minimized and it is filed
+// as an issue, and it is recorded in the cycle report.
+func (wg *WorkerGroup) reportFinding(task Task, gh *GitHubRepo,
+	crash *fuzzCrash, run string) error {
+
+	signature := crash.signature(signatureOptions(&wg.cfg.Fuzz,
+		wg.modulePaths))
+	wg.logger.Warn("Fuzz target crashed outside of fuzzing", "package",
+		task.Package.Path, "target", task.Target, "run", run, "kind",
+		crash.kind, "signature", signature)
+
+	if err := wg.reportCrash(task, gh, crash); err != nil {
+		return fmt.Errorf("handling crash of %s: %w", run, err)
+	}
+	wg.cycleReport.addCrashes(task, []string{signature})
+
+	return nil
+}
+
+// coverProfilePercent returns the percentage of the statements a coverage
+// profile shows as covered, formatted as 'go test -cover' prints it. Blocks
+// listed more than once count once, as covered if any of them is.
+func coverProfilePercent(profilePath string) (string, error) {
+	f, err := os.Open(profilePath)
+	if err != nil {
+		return "", fmt.Errorf("opening coverage profile: %w", err)
+	}
+	defer f.Close()
+
+	statements := make(map[string]int)
+	covered := make(map[string]bool)
+	err = scanCoverProfile(f, func(block string, n int, count int64) {
+		statements[block] = n
+		covered[block] = covered[block] || count > 0
+	})
+	if err != nil {
+		return "", err
+	}
+
+	total, hit := 0, 0
+	for block, n := range statements {
+		total += n
+		if covered[block] {
+			hit += n
+		}
+	}
+	if total == 0 {
+		return "0.0", nil
+	}
+
+	return fmt.Sprintf("%.1f", 100*float64(hit)/float64(total)), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCoverProfilePercent verifies that the coverage of a profile is the share
+// of covered statements, with blocks listed several times counted once.
+func TestCoverProfilePercent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cover.out")
+	require.NoError(t, os.WriteFile(path, []byte("mode: count\n"+
+		"example.com/p/a.go:3.2,5.16 2 0\n"+
+		"example.com/p/a.go:6.2,6.10 1 7\n"+
+		"example.com/p/a.go:3.2,5.16 2 1\n"+
+		"example.com/p/b.go:1.1,2.2 3 0\n"), 0644))
+
+	pct, err := coverProfilePercent(path)
+	require.NoError(t, err)
+	assert.Equal(t, "50.0", pct)
+
+	require.NoError(t, os.WriteFile(path, []byte("mode: count\n"), 0644))
+	pct, err = coverProfilePercent(path)
+	require.NoError(t, err)
+	assert.Equal(t, "0.0", pct)
+}
+
+// TestCoverProfileMerge verifies that the profiles of several runs are merged
+// into one count mode profile, summing the counts of every block.
+func TestCoverProfileMerge(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "0.out")
+	require.NoError(t, os.WriteFile(first, []byte("mode: count\n"+
+		"example.com/p/a.go:3.2,5.16 2 0\n"+
+		"example.com/p/a.go:6.2,6.10 1 7\n"), 0644))
+	second := filepath.Join(dir, "1.out")
+	require.NoError(t, os.WriteFile(second, []byte("mode: count\n"+
+		"example.com/p/a.go:6.2,6.10 1 3\n"+
+		"example.com/p/b.go:1.1,2.2 3 1\n"), 0644))
+
+	profile := newCoverProfile()
+	require.NoError(t, profile.merge(first))
+	require.NoError(t, profile.merge(second))
+	assert.Error(t, profile.merge(filepath.Join(dir, "missing.out")))
+
+	merged := filepath.Join(dir, "cover.out")
+	require.NoError(t, profile.write(merged))
+	data, err := os.ReadFile(merged)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: count\n"+
+		"example.com/p/a.go:3.2,5.16 2 0\n"+
+		"example.com/p/a.go:6.2,6.10 1 10\n"+
+		"example.com/p/b.go:1.1,2.2 3 1\n", string(data))
+
+	pct, err := coverProfilePercent(merged)
+	require.NoError(t, err)
+	assert.Equal(t, "66.7", pct)
+}
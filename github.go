@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/docker/docker/client"
 	"github.com/google/go-github/v72/github"
 	"golang.org/x/oauth2"
 )
@@ -20,15 +19,26 @@ type GitHubRepo struct {
 	ctx    context.Context
 	logger *slog.Logger
 	client *github.Client
-	cli    *client.Client
+	runner Runner
 	cfg    *Config
 	owner  string
 	repo   string
+
+	// cycleID is the ID of the fuzzing cycle the issues are verified in,
+	// which labels the verification containers.
+	cycleID string
+
+	// redactor removes the secrets from the issue bodies and comments.
+	redactor *redactor
+
+	// modulePaths are the paths of the modules of the fuzzed project,
+	// whose frames identify the crashes.
+	modulePaths []string
 }
 
 // NewGitHubRepo constructs a GitHubRepo instance by parsing the repository URL.
 // It extracts the owner, repository name, and token for authentication.
-func NewGitHubRepo(ctx context.Context, logger *slog.Logger, cli *client.Client,
+func NewGitHubRepo(ctx context.Context, logger *slog.Logger, runner Runner,
 	cfg *Config) (*GitHubRepo, error) {
 
 	u, err := url.Parse(cfg.Fuzz.CrashRepo)
@@ -48,13 +58,14 @@ func NewGitHubRepo(ctx context.Context, logger *slog.Logger, cli *client.Client,
 	}
 
 	return &GitHubRepo{
-		ctx:    ctx,
-		logger: logger,
-		client: createGitHubClient(ctx, token),
-		cli:    cli,
-		cfg:    cfg,
-		owner:  owner,
-		repo:   repo,
+		ctx:      ctx,
+		logger:   logger,
+		client:   createGitHubClient(ctx, token),
+		runner:   runner,
+		cfg:      cfg,
+		owner:    owner,
+		repo:     repo,
+		redactor: configRedactor(cfg),
 	}, nil
 }
 
@@ -108,6 +119,35 @@ func (gh *GitHubRepo) listOpenIssues(title string) ([]*github.Issue, error) {
 	return results.Issues, nil
 }
 
+// listOpenCrashIssueTitles returns the titles of all open crash issues created
+// by go-continuous-fuzz in the repository, following result pagination.
+func (gh *GitHubRepo) listOpenCrashIssueTitles() ([]string, error) {
+	query := fmt.Sprintf(`repo:%s/%s is:issue is:open "Fuzzing crash in" `+
+		`in:title`, gh.owner, gh.repo)
+	opts := &github.SearchOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var titles []string
+	for {
+		results, resp, err := gh.client.Search.Issues(gh.ctx, query,
+			opts)
+		if err != nil {
+			return nil, fmt.Errorf("searching open crash issues: "+
+				"%w", err)
+		}
+
+		for _, issue := range results.Issues {
+			titles = append(titles, issue.GetTitle())
+		}
+
+		if resp.NextPage == 0 {
+			return titles, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
 // issueExists checks whether an issue with the exact title already exists.
 func (gh *GitHubRepo) issueExists(title string) (bool, error) {
 	gh.logger.Info("Searching for existing issue", "owner", gh.owner,
@@ -128,12 +168,15 @@ func (gh *GitHubRepo) issueExists(title string) (bool, error) {
 	return false, nil
 }
 
-// createIssue opens a new GitHub issue with the given title and body.
-func (gh *GitHubRepo) createIssue(title, body string) error {
+// createIssue opens a new GitHub issue with the given title, body and labels.
+func (gh *GitHubRepo) createIssue(title, body string, labels []string) error {
 	gh.logger.Info("Creating new issue", "owner", gh.owner, "repo", gh.repo,
 		"title", title)
 
 	req := &github.IssueRequest{Title: &title, Body: &body}
+	if len(labels) > 0 {
+		req.Labels = &labels
+	}
 	issue, _, err := gh.client.Issues.Create(gh.ctx, gh.owner, gh.repo, req)
 	if err != nil {
 		gh.logger.Error("Issue creation failed", "err", err)
@@ -173,33 +216,133 @@ func (gh *GitHubRepo) closeIssue(number int) error {
 	return nil
 }
 
-// handleCrash posts a GitHub issue for a new fuzz crash if one does not exist.
-// It computes a unique crash signature, formats a report, and avoids duplicates
-// by checking for an existing issue with the same title.
-func (gh *GitHubRepo) handleCrash(pkg, target string, fc fuzzCrash) error {
-	// Compute a short signature hash for the crash to help with
-	// deduplication.
-	crashHash := ComputeSHA256Short(fc.failureFileAndLine)
-
-	// Compose issue title and body
-	title := fmt.Sprintf("[fuzz/%s] Fuzzing crash in %s/%s", crashHash, pkg,
-		target)
-	body := formatCrashReport(fc.errorLogs, fc.failingInput)
-
-	// Check for existing issue to prevent duplicates
-	exists, err := gh.issueExists(title)
-	if err != nil {
-		return fmt.Errorf("checking existing GitHub issues: %w", err)
+// goVersionTag returns the title tag identifying the Go version of the task
+// when a fuzzing matrix is configured, so that crashes that only occur with
+// some Go versions are reported, and verified, per version. Without a matrix
+// it returns an empty string.
+func (gh *GitHubRepo) goVersionTag(task Task) string {
+	if !isGoMatrix(gh.cfg) {
+		return ""
+	}
+
+	return fmt.Sprintf(" [go%s]", task.GoVersion)
+}
+
+// crashTitle returns the title of the issue of a crash of the task with the
+// given identity. Classified crashes are tagged with their kind.
+func (gh *GitHubRepo) crashTitle(task Task, id crashID) string {
+	var kindTag string
+	if id.kind.label() != "" {
+		kindTag = fmt.Sprintf(" [%s]", id.kind)
+	}
+
+	return fmt.Sprintf("[fuzz/%s]%s Fuzzing crash in %s/%s%s",
+		id.signature, kindTag, task.Package.Path, task.Target,
+		gh.goVersionTag(task))
+}
+
+// crashReported reports whether an issue is open for the crash of the task,
+// under its title or under a title an earlier version of go-continuous-fuzz
+// gave it, so that the crashes reported before an upgrade are not filed again.
+func (gh *GitHubRepo) crashReported(task Task, fc fuzzCrash) (bool, error) {
+	signature := fc.signature(signatureOptions(&gh.cfg.Fuzz,
+		gh.modulePaths))
+	ids := append([]crashID{{signature: signature, kind: fc.kind}},
+		fc.legacyIDs()...)
+
+	checked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		title := gh.crashTitle(task, id)
+		if checked[title] {
+			continue
+		}
+		checked[title] = true
+
+		exists, err := gh.issueExists(title)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
+
+// fileCrash posts a GitHub issue for a new fuzz crash, which the caller found
+// not to be reported with crashReported. It stores the inputs of the crash and
+// formats its report. Classified crashes are tagged with their kind in the
+// title, labeled, and described at the top of the report. Secrets are redacted
+// from the logs of the report, which notes how many were; the inputs are shown
+// as is. The logs are truncated so that the report fits in an issue.
+func (gh *GitHubRepo) fileCrash(task Task, fc fuzzCrash) error {
+	// Compute a short signature hash for the crash to identify it.
+	crashHash := fc.signature(signatureOptions(&gh.cfg.Fuzz,
+		gh.modulePaths))
+
+	// Redact the secrets the output of the run may hold, such as
+	// credentials echoed by the fuzz target. The inputs are left alone,
+	// so that the issue can be verified with its failing testcase.
+	fc, redactions := gh.redactor.redactCrashLogs(fc)
+	if redactions > 0 {
+		gh.logger.Info("Redacted secrets from crash report",
+			"signature", crashHash, "redactions", redactions)
+	}
+
+	// Store the full failing input with the corpus, since the issue shows
+	// at most its first bytes. The corpus is not published with the
+	// reports, so the input is kept as is.
+	corpusDir := gh.cfg.Project.CorpusDir
+	for _, input := range []string{fc.failingInput, fc.originalInput} {
+		if input == "" {
+			continue
+		}
+		if err := storeCrashInput(corpusDir, input); err != nil {
+			return err
+		}
+	}
+
+	var labels []string
+	if label := fc.kind.label(); label != "" {
+		labels = []string{label}
 	}
 
-	if exists {
-		gh.logger.Info("Fuzz crash already reported", "signature",
-			crashHash)
-		return nil
+	// Compose issue title and body. Runs killed before the fuzzer wrote
+	// the failing input report the inputs it added last instead, and no
+	// failing testcase to verify the issue with.
+	title := gh.crashTitle(task, crashID{signature: crashHash,
+		kind: fc.kind})
+	compose := func(errorLogs, stderrLogs string) string {
+		body := formatCrashReport(errorLogs, stderrLogs,
+			fc.failingInput)
+		killed := fc.kind == crashKindOOM || fc.kind == crashKindHang
+		if killed && fc.failingInput == "" {
+			body = formatKilledRunReport(errorLogs, stderrLogs,
+				fc.recentInputs)
+		}
+		body = formatCrashKind(fc.kind, fc.detail) + body
+		if fc.logPath != "" {
+			body = addRunLogLink(body, runLogURL(gh.cfg,
+				fc.logPath))
+		}
+		if fc.failingInput != "" {
+			body = addReportSection(body,
+				formatStoredInput(fc.failingInput))
+		}
+		if fc.originalInput != "" {
+			body = addReportSection(body,
+				formatOriginalInput(fc.originalInput))
+		}
+
+		return addReportSection(body, formatRedactions(redactions))
 	}
 
+	// Fit the logs into what is left of the size limit of an issue body
+	// once the other sections are laid out.
+	errorLogs, stderrLogs := fitLogs(fc.errorLogs, fc.stderrLogs,
+		maxIssueBodyLen-len(compose("", "")))
+	body := compose(errorLogs, stderrLogs)
+
 	// Create a new issue for this crash
-	if err = gh.createIssue(title, body); err != nil {
+	if err := gh.createIssue(title, body, labels); err != nil {
 		return fmt.Errorf("creating GitHub issue: %w", err)
 	}
 
@@ -208,9 +351,11 @@ func (gh *GitHubRepo) handleCrash(pkg, target string, fc fuzzCrash) error {
 
 // verifyAndCloseResolvedIssues checks open issues for a fuzz target, attempts
 // to reproduce them, and closes those that are no longer reproducible.
-func (gh *GitHubRepo) verifyAndCloseResolvedIssues(pkg, target string) error {
+func (gh *GitHubRepo) verifyAndCloseResolvedIssues(task Task) error {
 	gh.logger.Info("Verifying open GitHub issues for fuzz target")
 
+	pkg, target := task.Package.Path, task.Target
+
 	// Listing GitHub issues with the exact same title
 	title := fmt.Sprintf("Fuzzing crash in %s/%s", pkg, target)
 	issues, err := gh.listOpenIssues(title)
@@ -218,9 +363,18 @@ func (gh *GitHubRepo) verifyAndCloseResolvedIssues(pkg, target string) error {
 		return err
 	}
 
+	versionTag := gh.goVersionTag(task)
 	for _, issue := range issues {
+		// In a fuzzing matrix, only verify the issues reported for the
+		// Go version of this task.
+		if versionTag != "" &&
+			!strings.HasSuffix(issue.GetTitle(), versionTag) {
+
+			continue
+		}
+
 		// Parse the failing input from the issue body
-		failingInput, err := parseIssueBody(*issue.Body)
+		issueInput, err := parseIssueBody(*issue.Body)
 		if err != nil {
 			gh.logger.Info("No failing testcase found in body; "+
 				"skipping issue, possibly an unrelated issue "+
@@ -231,6 +385,7 @@ func (gh *GitHubRepo) verifyAndCloseResolvedIssues(pkg, target string) error {
 
 		// If the crash is due to a seed corpus input added via f.Add,
 		// this issue cannot be automatically verified and closed.
+		failingInput := issueInput.data
 		if failingInput == seedCorpusErrMsg {
 			gh.logger.Info("Seed corpus crash detected; manual "+
 				"verification required", "url",
@@ -238,9 +393,36 @@ func (gh *GitHubRepo) verifyAndCloseResolvedIssues(pkg, target string) error {
 			continue
 		}
 
+		// A failing input that is truncated, or had secrets redacted by
+		// an earlier version, no longer reproduces the crash, so it
+		// would be closed wrongly. Verify the full input stored with
+		// the reports instead, checked against its checksum.
+		if !issueInput.complete() {
+			failingInput, err = loadCrashInput(
+				gh.cfg.Project.CorpusDir, issueInput.checksum)
+			if err != nil {
+				gh.logger.Info("Full failing input "+
+					"unavailable; manual verification "+
+					"required", "url",
+					issue.GetHTMLURL(), "sha256",
+					issueInput.checksum, "error", err)
+				continue
+			}
+		}
+
+		// Issues reported before inputs carried a checksum cannot be
+		// checked for redacted secrets other than by their text.
+		if issueInput.checksum == "" &&
+			strings.Contains(failingInput, redactedText) {
+
+			gh.logger.Info("Failing input has redacted secrets; "+
+				"manual verification required", "url",
+				issue.GetHTMLURL())
+			continue
+		}
+
 		// Prepare directory and file for failing input
-		fuzzBinaryPath := filepath.Join(gh.cfg.Project.BinaryDir, pkg,
-			target)
+		fuzzBinaryPath := task.binaryDir(gh.cfg.Project.BinaryDir)
 		failingDir := filepath.Join(fuzzBinaryPath, "testdata", "fuzz",
 			target)
 		if err := EnsureDirExists(failingDir); err != nil {
@@ -268,11 +450,14 @@ func (gh *GitHubRepo) verifyAndCloseResolvedIssues(pkg, target string) error {
 		// container. This allows us to enforce fixed resource limits
 		// and prevent interference with other workers, for example, if
 		// one worker encounters an out-of-memory error.
-		err = gh.reproduceIssue(pkg, target, testCmd, issue)
+		closed, err := gh.reproduceIssue(task, testCmd, issue)
 		if err != nil {
 			return fmt.Errorf("reproducing issue %d: %w",
 				issue.GetNumber(), err)
 		}
+		if closed {
+			gh.pruneCrashInputs(issue, issues)
+		}
 
 		// After verification, remove the failing input file to clean up
 		// and avoid leaving any potentially problematic test data.
@@ -287,47 +472,91 @@ func (gh *GitHubRepo) verifyAndCloseResolvedIssues(pkg, target string) error {
 // reproduceIssue attempts to reproduce a reported fuzzing issue for a given
 // package and target. It runs the fuzz test inside a Docker container using the
 // provided test command. If the issue is no longer reproducible, the associated
-// GitHub issue will be closed automatically.
-func (gh *GitHubRepo) reproduceIssue(pkg, target string, testCmd []string,
-	issue *github.Issue) error {
+// GitHub issue will be closed automatically, and reproduceIssue reports that
+// it was.
+func (gh *GitHubRepo) reproduceIssue(task Task, testCmd []string,
+	issue *github.Issue) (bool, error) {
 
-	// Fuzzing container setup for the issue verification.
+	pkg, target := task.Package.Path, task.Target
+
+	// Fuzzing container setup for the issue verification, with the
+	// resources and security settings the target is fuzzed with.
 	c := &Container{
-		ctx:    gh.ctx,
-		logger: gh.logger,
-		cli:    gh.cli,
-		fuzzBinaryPath: filepath.Join(gh.cfg.Project.BinaryDir, pkg,
-			target),
+		ctx:            gh.ctx,
+		logger:         gh.logger,
+		runner:         gh.runner,
+		image:          targetImage(&gh.cfg.Fuzz, task),
+		fuzzBinaryPath: task.binaryDir(gh.cfg.Project.BinaryDir),
 		hostCorpusPath: filepath.Join(gh.cfg.Project.CorpusDir, pkg,
 			"testdata", "fuzz"),
-		cmd: testCmd,
+		cmd:     testCmd,
+		limits:  resourceLimits(&gh.cfg.Fuzz, pkg, target),
+		sandbox: sandboxOptions(&gh.cfg.Fuzz, pkg, target),
+		labels: withOwnerLabels(gh.cfg, taskLabels(gh.cfg, task,
+			gh.cycleID)),
 	}
 
 	// Start the container for issue verification.
 	containerID, err := c.Start()
 	if err != nil {
-		return fmt.Errorf("failed to start verification container "+
-			"for %s/%s: %w", pkg, target, err)
+		return false, fmt.Errorf("failed to start verification "+
+			"container for %s/%s: %w", pkg, target, err)
 	}
 	defer c.Stop(containerID)
 
 	// After running the fuzzing container for this issue, if it crashes
-	// again (Wait returns an error), the crash is still reproducible and
-	// the GitHub issue is kept open. If the container exits cleanly, the
-	// crash is no longer reproducible and the corresponding GitHub issue
-	// is closed.
-	if err := c.Wait(containerID); err != nil {
+	// again (it exits with a non-zero status or runs out of memory), the
+	// crash is still reproducible and the GitHub issue is kept open. If the
+	// container exits cleanly, the crash is no longer reproducible and the
+	// corresponding GitHub issue is closed.
+	status, err := c.Wait(containerID)
+	if err == nil && gh.ctx.Err() != nil {
+		return false, gh.ctx.Err()
+	}
+	if err != nil || status.Code != 0 || status.OOMKilled {
 		gh.logger.Info("Crash still reproducible; keeping GitHub "+
 			"issue open", "url", issue.GetHTMLURL())
-	} else {
-		gh.logger.Info("Crash no longer reproducible; closing "+
-			"associated GitHub issue", "url", issue.GetHTMLURL())
 
-		// Close the issue if the crash is resolved
-		if err := gh.closeIssue(issue.GetNumber()); err != nil {
-			return fmt.Errorf("closing issue: %w", err)
+		return false, nil
+	}
+
+	gh.logger.Info("Crash no longer reproducible; closing associated "+
+		"GitHub issue", "url", issue.GetHTMLURL())
+
+	// Close the issue if the crash is resolved
+	if err := gh.closeIssue(issue.GetNumber()); err != nil {
+		return false, fmt.Errorf("closing issue: %w", err)
+	}
+
+	return true, nil
+}
+
+// pruneCrashInputs removes the inputs stored for the crash of a closed issue,
+// unless another of the open issues of its fuzz target lists them too. Stored
+// inputs only take up space, so failing to remove them is only logged.
+func (gh *GitHubRepo) pruneCrashInputs(closed *github.Issue,
+	issues []*github.Issue) {
+
+	listed := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.GetNumber() == closed.GetNumber() {
+			continue
+		}
+		for _, checksum := range storedInputChecksums(issue.GetBody()) {
+			listed[checksum] = true
 		}
 	}
 
-	return nil
+	for _, checksum := range storedInputChecksums(closed.GetBody()) {
+		if listed[checksum] {
+			continue
+		}
+
+		err := removeCrashInput(gh.cfg.Project.CorpusDir, checksum)
+		if err != nil {
+			gh.logger.Error("Failed to prune stored crash input",
+				"url", closed.GetHTMLURL(), "sha256", checksum,
+				"error", err)
+		}
+	}
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// hangCheckInterval is how often the progress of a fuzzing run is
+	// checked.
+	hangCheckInterval = time.Second
+
+	// hungWorkerMarker is printed by the fuzzer when one of its worker
+	// processes stopped responding or exited unexpectedly.
+	hungWorkerMarker = "fuzzing process hung or terminated unexpectedly"
+
+	// testTimeoutMarker starts the panic of the testing package when a
+	// test binary runs longer than its -test.timeout, which lists the
+	// running tests and dumps the goroutines.
+	testTimeoutMarker = "panic: test timed out after"
+
+	// maxDumpBytes bounds the output kept after a hang was detected,
+	// which holds the goroutine dump of the run, so that it fits into a
+	// GitHub issue.
+	maxDumpBytes = 32 << 10
+)
+
+// progressLineRegex matches the progress lines the fuzzer prints every few
+// seconds, capturing the number of executions, or of completed inputs while it
+// warms up. Lines of a crasher being minimized carry no count.
+//
+// It matches lines like:
+//
+//	"fuzz: elapsed: 3s, execs: 1024 (341/sec), new interesting: 2 ..."
+//	"fuzz: elapsed: 0s, gathering baseline coverage: 3/9 completed"
+//	"fuzz: elapsed: 6s, minimizing"
+var progressLineRegex = regexp.MustCompile(
+	`^fuzz: elapsed: \S+, (?:execs: (\d+)|` +
+		`(?:gathering baseline coverage|testing seed corpus): ` +
+		`(\d+)/\d+ completed|minimizing)`,
+)
+
+// HangLimits bounds how long a fuzzing run may go without progress before it
+// is reported as hung. Zero durations disable the corresponding check.
+type HangLimits struct {
+	// ProgressTimeout is the longest time without progress lines.
+	ProgressTimeout time.Duration
+
+	// StallTimeout is the longest time the execution count may stall. An
+	// input running too long stalls it, unless other fuzzing workers keep
+	// making progress.
+	StallTimeout time.Duration
+}
+
+// enabled reports whether any hang check is enabled.
+func (h HangLimits) enabled() bool {
+	return h.ProgressTimeout > 0 || h.StallTimeout > 0
+}
+
+// hangLimits returns the hang limits of the fuzzing runs.
+func hangLimits(fuzz *Fuzz) HangLimits {
+	return HangLimits{
+		ProgressTimeout: fuzz.ProgressTimeout,
+		StallTimeout:    fuzz.StallTimeout,
+	}
+}
+
+// progressWatchdog tracks the progress lines of a fuzzing run to detect hangs.
+// It is safe for concurrent use.
+type progressWatchdog struct {
+	limits HangLimits
+
+	mu sync.Mutex
+
+	// lastProgress is when the last progress line was seen.
+	lastProgress time.Time
+
+	// count is the last execution count seen, and lastCount when it
+	// last changed.
+	count     int64
+	lastCount time.Time
+
+	// reason describes the hang, once one was detected.
+	reason string
+}
+
+// newProgressWatchdog returns a watchdog for a run started at start.
+func newProgressWatchdog(limits HangLimits,
+	start time.Time) *progressWatchdog {
+
+	return &progressWatchdog{
+		limits:       limits,
+		lastProgress: start,
+		count:        -1,
+		lastCount:    start,
+	}
+}
+
+// observe records the progress shown by an output line of the run.
+func (w *progressWatchdog) observe(line string, now time.Time) {
+	matches := progressLineRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastProgress = now
+
+	countStr := matches[1] + matches[2]
+	if countStr == "" {
+		// Minimizing a crasher runs many inputs without counting
+		// them, and is bounded by the fuzzer itself.
+		w.lastCount = now
+		return
+	}
+
+	count, err := strconv.ParseInt(countStr, 10, 64)
+	if err == nil && count != w.count {
+		w.count = count
+		w.lastCount = now
+	}
+}
+
+// check reports whether the run hung as of now. It reports a hang only once,
+// and records its reason.
+func (w *progressWatchdog) check(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.reason != "" {
+		return false
+	}
+
+	switch {
+	case w.limits.ProgressTimeout > 0 &&
+		now.Sub(w.lastProgress) >= w.limits.ProgressTimeout:
+
+		w.reason = fmt.Sprintf("no fuzzer progress for %s",
+			now.Sub(w.lastProgress).Round(time.Second))
+
+	case w.limits.StallTimeout > 0 &&
+		now.Sub(w.lastCount) >= w.limits.StallTimeout:
+
+		w.reason = fmt.Sprintf("execution count stuck at %d for %s, "+
+			"exceeding the stall timeout of %s", w.count,
+			now.Sub(w.lastCount).Round(time.Second),
+			w.limits.StallTimeout)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// hung returns the reason of the hang detected, if any.
+func (w *progressWatchdog) hung() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.reason, w.reason != ""
+}
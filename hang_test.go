@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProgressWatchdog verifies that the watchdog reports a run as hung when
+// it prints no progress, or its execution count stalls, for longer than the
+// configured limits.
+func TestProgressWatchdog(t *testing.T) {
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	type line struct {
+		after time.Duration
+		text  string
+	}
+
+	tests := []struct {
+		name   string
+		limits HangLimits
+		lines  []line
+		now    time.Duration
+		hung   bool
+	}{
+		{
+			name:   "no output",
+			limits: HangLimits{ProgressTimeout: time.Minute},
+			now:    time.Minute,
+			hung:   true,
+		},
+		{
+			name:   "recent progress",
+			limits: HangLimits{ProgressTimeout: time.Minute},
+			lines: []line{{
+				after: 30 * time.Second,
+				text: "fuzz: elapsed: 30s, execs: 10 " +
+					"(1/sec), new interesting: 0",
+			}},
+			now: time.Minute,
+		},
+		{
+			name:   "unrelated output",
+			limits: HangLimits{ProgressTimeout: time.Minute},
+			lines: []line{{
+				after: 30 * time.Second,
+				text:  "some log line of the fuzz target",
+			}},
+			now:  time.Minute,
+			hung: true,
+		},
+		{
+			name:   "stalled execution count",
+			limits: HangLimits{StallTimeout: time.Minute},
+			lines: []line{{
+				after: 0,
+				text: "fuzz: elapsed: 0s, execs: 10 " +
+					"(10/sec), new interesting: 0",
+			}, {
+				after: 61 * time.Second,
+				text: "fuzz: elapsed: 61s, execs: 10 " +
+					"(0/sec), new interesting: 0",
+			}},
+			now:  61 * time.Second,
+			hung: true,
+		},
+		{
+			name:   "growing baseline coverage",
+			limits: HangLimits{StallTimeout: time.Minute},
+			lines: []line{{
+				after: 30 * time.Second,
+				text: "fuzz: elapsed: 30s, gathering " +
+					"baseline coverage: 3/9 completed",
+			}},
+			now: 61 * time.Second,
+		},
+		{
+			name:   "minimizing",
+			limits: HangLimits{StallTimeout: time.Minute},
+			lines: []line{{
+				after: 50 * time.Second,
+				text:  "fuzz: elapsed: 50s, minimizing",
+			}},
+			now: 61 * time.Second,
+		},
+		{
+			name:   "disabled",
+			limits: HangLimits{},
+			now:    time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newProgressWatchdog(tt.limits, start)
+			for _, l := range tt.lines {
+				w.observe(l.text, at(l.after))
+			}
+
+			assert.Equal(t, tt.hung, w.check(at(tt.now)))
+			reason, hung := w.hung()
+			assert.Equal(t, tt.hung, hung)
+			assert.Equal(t, tt.hung, reason != "")
+		})
+	}
+
+	t.Run("reports once", func(t *testing.T) {
+		w := newProgressWatchdog(HangLimits{
+			ProgressTimeout: time.Minute,
+		}, start)
+		require.True(t, w.check(at(time.Minute)))
+		assert.False(t, w.check(at(2*time.Minute)))
+
+		_, hung := w.hung()
+		assert.True(t, hung)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/distribution/reference"
+)
+
+const (
+	// PullAlways pulls the container images at every cycle.
+	PullAlways = "always"
+
+	// PullIfNotPresent pulls the container images that are missing from
+	// the runtime.
+	PullIfNotPresent = "if-not-present"
+
+	// PullNever never pulls the container images, which must have been
+	// loaded into the runtime beforehand.
+	PullNever = "never"
+)
+
+// validateImageRef checks that ref is a valid image reference, such as
+// golang:1.24.6 or golang:1.24.6@sha256:<digest>.
+func validateImageRef(ref string) error {
+	if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+		return fmt.Errorf("invalid container image %q: %w", ref, err)
+	}
+
+	return nil
+}
+
+// validateImageConfig checks the container image of the local toolchain and
+// the per-target image overrides.
+func validateImageConfig(fuzz *Fuzz) error {
+	if err := validateImageRef(fuzz.Image); err != nil {
+		return err
+	}
+
+	for key, ref := range fuzz.TargetImages {
+		if err := validateImageRef(ref); err != nil {
+			return fmt.Errorf("invalid target-image entry %q: %w",
+				key, err)
+		}
+	}
+
+	return nil
+}
+
+// targetImage returns the container image the task is run in: the image
+// configured for its target, else for its package, else the image of its Go
+// version.
+func targetImage(fuzz *Fuzz, task Task) string {
+	pkg := task.Package.Path
+	if ref, ok := fuzz.TargetImages[targetKey(pkg, task.Target)]; ok {
+		return ref
+	}
+	if ref, ok := fuzz.TargetImages[pkg]; ok {
+		return ref
+	}
+
+	return containerImageFor(fuzz, task.GoVersion)
+}
+
+// ensureImage makes the given image available to the runner according to the
+// pull policy.
+func ensureImage(ctx context.Context, logger *slog.Logger, runner Runner,
+	image, policy string) error {
+
+	if policy != PullAlways {
+		present, err := runner.ImageExists(ctx, image)
+		if err != nil {
+			return err
+		}
+		if present {
+			logger.Info("Using container image present in the "+
+				"runtime", "image", image)
+			return nil
+		}
+		if policy == PullNever {
+			return fmt.Errorf("container image %q is not present "+
+				"and the pull policy is %q", image, PullNever)
+		}
+	}
+
+	return runner.PullImage(ctx, image)
+}
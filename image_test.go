@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDigest is a well-formed image digest.
+const testDigest = "4b1f0d8d0a3b0e5e8f6c1f4f0f2f0c5d" +
+	"6d4e5b8a9c7f6e5d4c3b2a1908f7e6d5"
+
+// fakeImageRunner is a runner that only tracks the images present in the
+// runtime and the images pulled.
+type fakeImageRunner struct {
+	Runner
+
+	present map[string]bool
+	pulled  []string
+}
+
+// PullImage records the pulled image.
+func (r *fakeImageRunner) PullImage(_ context.Context, image string) error {
+	r.pulled = append(r.pulled, image)
+	return nil
+}
+
+// ImageExists reports whether the image is present.
+func (r *fakeImageRunner) ImageExists(_ context.Context, image string) (bool,
+	error) {
+
+	return r.present[image], nil
+}
+
+// TestTargetImage verifies that a target's image override takes precedence
+// over its package's, and both over the image of the Go version.
+func TestTargetImage(t *testing.T) {
+	fuzz := &Fuzz{
+		Image: ContainerImage,
+		TargetImages: map[string]string{
+			"img":            "fuzz/img:1",
+			"img/FuzzDecode": "fuzz/decode@sha256:" + testDigest,
+		},
+	}
+
+	tests := []struct {
+		name      string
+		pkg       string
+		target    string
+		goVersion string
+		want      string
+	}{
+		{name: "local toolchain", pkg: "parser", target: "FuzzParse",
+			want: ContainerImage},
+		{name: "go version", pkg: "parser", target: "FuzzParse",
+			goVersion: "1.23.4", want: "golang:1.23.4"},
+		{name: "package", pkg: "img", target: "FuzzEncode",
+			goVersion: "1.23.4", want: "fuzz/img:1"},
+		{name: "target", pkg: "img", target: "FuzzDecode",
+			want: "fuzz/decode@sha256:" + testDigest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := Task{
+				Package:   GoPackage{Path: tt.pkg},
+				Target:    tt.target,
+				GoVersion: tt.goVersion,
+			}
+			assert.Equal(t, tt.want, targetImage(fuzz, task))
+		})
+	}
+}
+
+// TestValidateImageConfig verifies that image references, including digests,
+// are validated.
+func TestValidateImageConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		targets map[string]string
+		wantErr bool
+	}{
+		{name: "tag", image: ContainerImage},
+		{name: "digest", image: "golang:1.24.6@sha256:" + testDigest},
+		{name: "short digest", image: "golang@sha256:abc",
+			wantErr: true},
+		{name: "invalid target image", image: ContainerImage,
+			targets: map[string]string{"img": "Fuzz/Img"},
+			wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fuzz := &Fuzz{Image: tt.image, TargetImages: tt.targets}
+			err := validateImageConfig(fuzz)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// TestEnsureImage verifies that images are pulled according to the pull
+// policy.
+func TestEnsureImage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	tests := []struct {
+		policy     string
+		present    bool
+		wantPulled bool
+		wantErr    bool
+	}{
+		{policy: PullAlways, present: true, wantPulled: true},
+		{policy: PullIfNotPresent, present: true},
+		{policy: PullIfNotPresent, wantPulled: true},
+		{policy: PullNever, present: true},
+		{policy: PullNever, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		runner := &fakeImageRunner{
+			present: map[string]bool{ContainerImage: tt.present},
+		}
+
+		err := ensureImage(ctx, logger, runner, ContainerImage,
+			tt.policy)
+		if tt.wantErr {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+		assert.Equal(t, tt.wantPulled, len(runner.pulled) == 1,
+			"policy %s, present %v", tt.policy, tt.present)
+	}
+}
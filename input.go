@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// CrashInputDir is the directory, inside the corpus directory, where
+	// the full failing inputs of the reported crashes are stored, named by
+	// their SHA-256 checksum. It is archived with the corpus rather than
+	// published with the reports, and the go command ignores it, like any
+	// directory whose name starts with a dot, so it never holds a package.
+	CrashInputDir = ".crash-inputs"
+
+	// maxInlineInputBytes bounds the bytes of an input shown in an issue,
+	// so that the issue body stays below GitHub's size limit.
+	maxInlineInputBytes = 8 << 10
+
+	// base64LineLen is the length of the lines of base64-encoded inputs.
+	base64LineLen = 76
+
+	// inputEncodingText shows an input as is, and inputEncodingBase64 as
+	// base64, for inputs that are not text or that GitHub would alter.
+	inputEncodingText   = "text"
+	inputEncodingBase64 = "base64"
+)
+
+// inputHeaderRegex matches the comment preceding the fenced block of an input
+// in an issue, which GitHub does not render, capturing the encoding, the size
+// and the SHA-256 checksum of the full input, and whether the block holds only
+// its first bytes.
+//
+// It matches lines like:
+//
+//	"<!-- input encoding=text size=28 sha256=9f86d08... truncated -->"
+var inputHeaderRegex = regexp.MustCompile(
+	`<!-- input encoding=(text|base64) size=([0-9]+) ` +
+		`sha256=([0-9a-f]{64})( truncated)? -->\n`,
+)
+
+// errInputChecksum is returned for inputs that do not match their checksum,
+// such as inputs whose secrets were redacted from the issue.
+var errInputChecksum = errors.New("input does not match its checksum")
+
+// inputChecksum returns the hex-encoded SHA-256 checksum of an input.
+func inputChecksum(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+// isIssueText reports whether an input can be shown as is in an issue: it is
+// valid UTF-8 without control characters other than newlines and tabs, which
+// GitHub keeps unchanged in code blocks.
+func isIssueText(input string) bool {
+	if !utf8.ValidString(input) {
+		return false
+	}
+
+	for _, r := range input {
+		if r < 0x20 && r != '\n' && r != '\t' || r == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inputFence returns a code fence for the given block that is longer than any
+// run of tildes in it, so that the block cannot end it early.
+func inputFence(block string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(block); i++ {
+		if block[i] != '~' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+
+	return strings.Repeat("~", max(3, longest+1))
+}
+
+// formatInput formats an input for an issue: a comment with its encoding, size
+// and checksum, followed by a fenced block holding the input, as text or
+// base64-encoded, truncated to its first maxInlineInputBytes bytes.
+func formatInput(input string) string {
+	shown := input
+	truncated := len(input) > maxInlineInputBytes
+	if truncated {
+		shown = input[:maxInlineInputBytes]
+	}
+
+	encoding := inputEncodingText
+	block := shown
+	if !isIssueText(input) {
+		encoding = inputEncodingBase64
+		block = wrapLines(base64.StdEncoding.EncodeToString(
+			[]byte(shown)), base64LineLen)
+	} else if truncated {
+		// Keep the truncated text valid UTF-8.
+		for len(shown) > 0 && !utf8.ValidString(shown) {
+			shown = shown[:len(shown)-1]
+		}
+		block = shown
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- input encoding=%s size=%d sha256=%s", encoding,
+		len(input), inputChecksum(input))
+	if truncated {
+		b.WriteString(" truncated")
+	}
+	b.WriteString(" -->\n")
+
+	fence := inputFence(block)
+	fmt.Fprintf(&b, "%ssh\n%s\n%s", fence, block, fence)
+	if truncated {
+		fmt.Fprintf(&b, "\nThe input is truncated to its first %d of "+
+			"%d bytes.", len(shown), len(input))
+	}
+
+	return b.String()
+}
+
+// wrapLines splits s into lines of at most n bytes.
+func wrapLines(s string, n int) string {
+	var lines []string
+	for len(s) > n {
+		lines = append(lines, s[:n])
+		s = s[n:]
+	}
+	lines = append(lines, s)
+
+	return strings.Join(lines, "\n")
+}
+
+// issueInput is a failing input parsed from an issue.
+type issueInput struct {
+	// data is the input shown in the issue, which is its first bytes if
+	// truncated is set.
+	data string
+
+	// size and checksum are those of the full input. They are unknown,
+	// with a zero checksum, for issues reported before inputs carried
+	// them.
+	size      int
+	checksum  string
+	truncated bool
+}
+
+// complete reports whether the input shown in the issue is the full input,
+// unaltered.
+func (in issueInput) complete() bool {
+	if in.checksum == "" {
+		return true
+	}
+
+	return !in.truncated && len(in.data) == in.size &&
+		inputChecksum(in.data) == in.checksum
+}
+
+// parseInput parses an input formatted with formatInput at the start of s.
+func parseInput(s string) (issueInput, error) {
+	m := inputHeaderRegex.FindStringSubmatchIndex(s)
+	if m == nil || m[0] != 0 {
+		return issueInput{}, fmt.Errorf("input header not found")
+	}
+
+	in := issueInput{
+		checksum:  s[m[6]:m[7]],
+		truncated: m[8] >= 0,
+	}
+	var err error
+	in.size, err = strconv.Atoi(s[m[4]:m[5]])
+	if err != nil {
+		return issueInput{}, fmt.Errorf("invalid input size: %w", err)
+	}
+
+	// The fenced block ends at the first line holding only its fence.
+	rest := s[m[1]:]
+	fence := rest[:len(rest)-len(strings.TrimLeft(rest, "~"))]
+	rest, ok := strings.CutPrefix(rest[len(fence):], "sh\n")
+	if len(fence) < 3 || !ok {
+		return issueInput{}, fmt.Errorf("input block not found")
+	}
+	block, _, ok := strings.Cut(rest, "\n"+fence+"\n")
+	if !ok {
+		block, ok = strings.CutSuffix(rest, "\n"+fence)
+	}
+	if !ok {
+		return issueInput{}, fmt.Errorf("unterminated input block")
+	}
+
+	in.data = block
+	if s[m[2]:m[3]] == inputEncodingBase64 {
+		data, err := base64.StdEncoding.DecodeString(
+			strings.ReplaceAll(block, "\n", ""))
+		if err != nil {
+			return issueInput{}, fmt.Errorf("invalid base64 "+
+				"input: %w", err)
+		}
+		in.data = string(data)
+	}
+
+	return in, nil
+}
+
+// storedInputRegex matches the checksums of the inputs a crash report lists as
+// stored, in its full input and original input sections.
+var storedInputRegex = regexp.MustCompile("SHA-256 `([0-9a-f]{64})`")
+
+// crashInputPath returns the path, below corpusDir, of the stored input with
+// the given checksum.
+func crashInputPath(corpusDir, checksum string) string {
+	return filepath.Join(corpusDir, CrashInputDir, checksum)
+}
+
+// storeCrashInput stores the full input of a crash below corpusDir, to be
+// archived along with the corpus.
+func storeCrashInput(corpusDir, input string) error {
+	inputPath := crashInputPath(corpusDir, inputChecksum(input))
+	err := writeFileAtomic(strings.NewReader(input), inputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("storing crash input: %w", err)
+	}
+
+	return nil
+}
+
+// removeCrashInput removes the stored input with the given checksum from
+// corpusDir. Removing an input that is not stored is not an error.
+func removeCrashInput(corpusDir, checksum string) error {
+	err := os.Remove(crashInputPath(corpusDir, checksum))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing crash input: %w", err)
+	}
+
+	return nil
+}
+
+// storedInputChecksums returns the checksums of the inputs the crash report in
+// an issue body lists as stored.
+func storedInputChecksums(body string) []string {
+	var checksums []string
+	for _, m := range storedInputRegex.FindAllStringSubmatch(body, -1) {
+		checksums = append(checksums, m[1])
+	}
+
+	return checksums
+}
+
+// loadCrashInput returns the stored input with the given checksum from
+// corpusDir, after checking that it matches the checksum.
+func loadCrashInput(corpusDir, checksum string) (string, error) {
+	data, err := os.ReadFile(crashInputPath(corpusDir, checksum))
+	if err != nil {
+		return "", fmt.Errorf("loading crash input: %w", err)
+	}
+	if inputChecksum(string(data)) != checksum {
+		return "", errInputChecksum
+	}
+
+	return string(data), nil
+}
+
+// formatStoredInput formats the report section noting the size and checksum
+// of the full input of a crash, stored with the corpus.
+func formatStoredInput(input string) string {
+	return fmt.Sprintf("## Full input\nThe full failing input (%d bytes, "+
+		"SHA-256 `%s`) is stored with the fuzzing corpus, which is "+
+		"not published, until this issue is closed.\n", len(input),
+		inputChecksum(input))
+}
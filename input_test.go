@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFormatInput verifies that inputs of any content survive their encoding
+// in an issue, that text is shown as is and other inputs as base64, and that
+// huge inputs are truncated while keeping the size and checksum of the full
+// input.
+func TestFormatInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		encoding  string
+		truncated bool
+	}{
+		{
+			name:     "text",
+			input:    "go test fuzz v1\nstring(\"0\")\n",
+			encoding: inputEncodingText,
+		},
+		{
+			name:     "fences",
+			input:    "~~~\n~~~~~ sh\n~~~~",
+			encoding: inputEncodingText,
+		},
+		{
+			name:     "invalid utf-8",
+			input:    "go test fuzz v1\n\xff\xfe\x00",
+			encoding: inputEncodingBase64,
+		},
+		{
+			name:     "carriage return",
+			input:    "line\r\n",
+			encoding: inputEncodingBase64,
+		},
+		{
+			name:      "huge text",
+			input:     strings.Repeat("é", maxInlineInputBytes),
+			encoding:  inputEncodingText,
+			truncated: true,
+		},
+		{
+			name: "huge binary",
+			input: strings.Repeat("\x00",
+				2*maxInlineInputBytes),
+			encoding:  inputEncodingBase64,
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted := formatInput(tt.input)
+			assert.Contains(t, formatted, "encoding="+tt.encoding)
+
+			in, err := parseInput(formatted)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.input), in.size)
+			assert.Equal(t, inputChecksum(tt.input), in.checksum)
+			assert.Equal(t, tt.truncated, in.truncated)
+			assert.Equal(t, !tt.truncated, in.complete())
+
+			if !tt.truncated {
+				assert.Equal(t, tt.input, in.data)
+				return
+			}
+			assert.LessOrEqual(t, len(in.data), maxInlineInputBytes)
+			assert.True(t, strings.HasPrefix(tt.input, in.data))
+			assert.Contains(t, formatted, "The input is truncated")
+		})
+	}
+}
+
+// TestParseInputRedacted verifies that an input altered in the issue, such as
+// by redaction, is detected as incomplete by its checksum.
+func TestParseInputRedacted(t *testing.T) {
+	formatted := formatInput("token=hunter22")
+	formatted = strings.Replace(formatted, "hunter22", redactedText, 1)
+
+	in, err := parseInput(formatted)
+	require.NoError(t, err)
+	assert.Equal(t, "token="+redactedText, in.data)
+	assert.False(t, in.complete())
+
+	_, err = parseInput("~~~sh\nlegacy\n~~~")
+	assert.Error(t, err)
+}
+
+// TestStoreCrashInput verifies that the full input of a crash is stored below
+// the corpus directory by its checksum, loaded back only if it still matches
+// it, and removed once the report listing it is closed.
+func TestStoreCrashInput(t *testing.T) {
+	corpusDir := t.TempDir()
+	input := strings.Repeat("\xff", 3*maxInlineInputBytes)
+
+	require.NoError(t, storeCrashInput(corpusDir, input))
+	assert.FileExists(t, filepath.Join(corpusDir, CrashInputDir,
+		inputChecksum(input)))
+
+	loaded, err := loadCrashInput(corpusDir, inputChecksum(input))
+	require.NoError(t, err)
+	assert.Equal(t, input, loaded)
+
+	_, err = loadCrashInput(corpusDir, inputChecksum("other"))
+	assert.Error(t, err)
+
+	require.NoError(t, storeCrashInput(corpusDir, "other"))
+	err = writeFileAtomic(strings.NewReader("changed"),
+		crashInputPath(corpusDir, inputChecksum("other")), 0644)
+	require.NoError(t, err)
+	_, err = loadCrashInput(corpusDir, inputChecksum("other"))
+	assert.ErrorIs(t, err, errInputChecksum)
+
+	// The report lists the stored inputs by their checksum, but not the
+	// checksum of its failing testcase.
+	report := formatCrashReport("", "", "minimized") +
+		formatStoredInput(input) + formatOriginalInput("other")
+	checksums := storedInputChecksums(report)
+	assert.Equal(t, []string{inputChecksum(input),
+		inputChecksum("other")}, checksums)
+
+	for _, checksum := range checksums {
+		require.NoError(t, removeCrashInput(corpusDir, checksum))
+	}
+	_, err = loadCrashInput(corpusDir, inputChecksum(input))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoError(t, removeCrashInput(corpusDir, inputChecksum(input)))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"maps"
+	"net/url"
+	"time"
+)
+
+const (
+	// labelPrefix is the prefix of the labels of the fuzzing containers.
+	labelPrefix = "io.github.go-continuous-fuzz."
+
+	// LabelDaemon identifies the daemon that started a container across
+	// restarts, so that the containers left over by its previous
+	// instances can be found.
+	LabelDaemon = labelPrefix + "daemon"
+
+	// LabelInstance identifies the process that started a container.
+	LabelInstance = labelPrefix + "instance"
+
+	// LabelProject is the repository of the project a container fuzzes.
+	LabelProject = labelPrefix + "project"
+
+	// LabelPackage is the package of the fuzz target a container runs.
+	LabelPackage = labelPrefix + "package"
+
+	// LabelTarget is the fuzz target a container runs.
+	LabelTarget = labelPrefix + "target"
+
+	// LabelCycle is the ID of the fuzzing cycle a container runs in.
+	LabelCycle = labelPrefix + "cycle"
+)
+
+// shutdownReapTimeout bounds the removal of the runs of an instance when it
+// shuts down, so that an unresponsive runtime does not keep it from exiting.
+const shutdownReapTimeout = 30 * time.Second
+
+// daemonID returns the ID of the daemon described by the configuration, which
+// stays the same across restarts: a hash of the agent name for agents, and of
+// the project repository otherwise. The credentials in the repository URL are
+// left out, so that rotating them keeps the ID.
+func daemonID(cfg *Config) string {
+	if cfg.Mode == ModeAgent {
+		return ComputeSHA256Short("agent:" + cfg.Agent.Name)
+	}
+
+	repo := cfg.Project.SrcRepo
+	if parsed, err := url.Parse(repo); err == nil {
+		parsed.User = nil
+		repo = parsed.String()
+	}
+
+	return ComputeSHA256Short("project:" + repo)
+}
+
+// newInstanceID returns a random ID for a new process of the daemon.
+func newInstanceID() string {
+	return rand.Text()
+}
+
+// taskLabels returns the labels describing the fuzzing runs of the task in the
+// given cycle.
+func taskLabels(cfg *Config, task Task, cycleID string) map[string]string {
+	return map[string]string{
+		LabelProject: SanitizeURL(cfg.Project.SrcRepo),
+		LabelPackage: task.Package.Path,
+		LabelTarget:  task.Target,
+		LabelCycle:   cycleID,
+	}
+}
+
+// withOwnerLabels returns a copy of labels extended with the labels of the
+// daemon and the process starting the run.
+func withOwnerLabels(cfg *Config, labels map[string]string) map[string]string {
+	owned := maps.Clone(labels)
+	if owned == nil {
+		owned = make(map[string]string)
+	}
+	owned[LabelDaemon] = cfg.DaemonID
+	owned[LabelInstance] = cfg.InstanceID
+
+	return owned
+}
+
+// cleanupOrphans removes the runs left over by the daemon with a runner of its
+// own, for callers that keep no runner across fuzzing cycles.
+func cleanupOrphans(ctx context.Context, logger *slog.Logger, cfg *Config) {
+	runner, err := newRunner(logger, cfg)
+	if err != nil {
+		logger.Error("Failed to create runner to remove left over "+
+			"fuzzing containers", "error", err)
+		return
+	}
+	defer func() {
+		if err := runner.Close(); err != nil {
+			logger.Error("Failed to close runner", "error", err)
+		}
+	}()
+
+	reapOrphans(ctx, logger, runner, cfg)
+}
+
+// shutdownReapContext returns the context of the removal of the runs of this
+// instance on shutdown, which ends after shutdownReapTimeout.
+func shutdownReapContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), shutdownReapTimeout)
+}
+
+// reapOrphans removes the runs left over by the daemon, such as the containers
+// of a previous instance that was killed or whose host rebooted mid-cycle. On
+// shutdown, it also removes the runs of this instance that were not stopped.
+func reapOrphans(ctx context.Context, logger *slog.Logger, runner Runner,
+	cfg *Config) {
+
+	reaped, err := runner.Reap(ctx, map[string]string{
+		LabelDaemon: cfg.DaemonID,
+	})
+	if err != nil {
+		logger.Error("Failed to remove left over fuzzing containers",
+			"daemon", cfg.DaemonID, "error", err)
+		return
+	}
+
+	if reaped > 0 {
+		logger.Info("Removed left over fuzzing containers", "daemon",
+			cfg.DaemonID, "count", reaped)
+	}
+}
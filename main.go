@@ -75,10 +75,56 @@ func run() int {
 		cancelApp()
 	}()
 
-	// Start the continuous fuzzing cycles.
-	if err := runFuzzingCycles(appCtx, logger, cfg); err != nil {
-		logger.Error("Failed to run fuzzing cycles", "error", err)
-		return 1
+	// Remove the containers left over by previous instances, and those of
+	// this instance on shutdown. Agents do so with their own runner; the
+	// coordinator runs local containers too, to verify issues, minimize
+	// crashes, measure coverage and minimize corpora.
+	if cfg.Mode != ModeAgent {
+		cleanupOrphans(appCtx, logger, cfg)
+		defer func() {
+			reapCtx, cancel := shutdownReapContext()
+			defer cancel()
+
+			cleanupOrphans(reapCtx, logger, cfg)
+		}()
+	}
+
+	switch cfg.Mode {
+	case ModeAgent:
+		// Run the fuzzing runs leased from the coordinator.
+		if err := runAgent(appCtx, logger, cfg); err != nil {
+			logger.Error("Failed to run agent", "error", err)
+			return 1
+		}
+
+	case ModeCoordinator:
+		// Serve the coordinator API to the agents, then start the
+		// continuous fuzzing cycles, whose runs are handed to them.
+		board := newLeaseBoard(logger, cfg.Coordinator.LeaseTimeout,
+			hangLimits(&cfg.Fuzz), cfg.Fuzz.RedactPatterns)
+		err := startCoordinator(appCtx, logger, cfg, board)
+		if err != nil {
+			logger.Error("Failed to start coordinator", "error",
+				err)
+			return 1
+		}
+
+		if err := runFuzzingCycles(appCtx, logger, cfg,
+			board); err != nil {
+
+			logger.Error("Failed to run fuzzing cycles", "error",
+				err)
+			return 1
+		}
+
+	default:
+		// Start the continuous fuzzing cycles.
+		err := runFuzzingCycles(appCtx, logger, cfg, nil)
+		if err != nil {
+			logger.Error("Failed to run fuzzing cycles", "error",
+				err)
+			return 1
+		}
 	}
 
 	logger.Info("Program exited.")
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fuzzStatsRegex matches the progress lines the fuzzer prints while it fuzzes,
+// capturing the elapsed time, the number of executions, the execution rate,
+// the number of new interesting inputs found by the run and the size of the
+// corpus.
+//
+// It matches lines like:
+//
+//	"fuzz: elapsed: 3s, execs: 10 (3/sec), new interesting: 2 (total: 9)"
+var fuzzStatsRegex = regexp.MustCompile(
+	`^fuzz: elapsed: (\S+), execs: (\d+) \((\d+)/sec\), ` +
+		`new interesting: (\d+) \(total: (\d+)\)`,
+)
+
+// FuzzStats are the statistics of a fuzzing run shown by a progress line of
+// the fuzzer.
+type FuzzStats struct {
+	// Elapsed is the fuzzing time of the run.
+	Elapsed time.Duration
+
+	// Execs is the number of inputs executed.
+	Execs int64
+
+	// ExecsPerSec is the number of inputs executed per second.
+	ExecsPerSec int64
+
+	// NewInteresting is the number of inputs added to the corpus because
+	// they expanded coverage.
+	NewInteresting int64
+
+	// TotalCorpus is the number of inputs in the corpus, including the
+	// seed corpus.
+	TotalCorpus int64
+}
+
+// parseFuzzStats returns the statistics shown by an output line of a run, and
+// whether the line is a progress line showing them.
+func parseFuzzStats(line string) (FuzzStats, bool) {
+	m := fuzzStatsRegex.FindStringSubmatch(line)
+	if m == nil {
+		return FuzzStats{}, false
+	}
+
+	elapsed, err := time.ParseDuration(m[1])
+	if err != nil {
+		return FuzzStats{}, false
+	}
+
+	var counts [4]int64
+	for i := range counts {
+		counts[i], err = strconv.ParseInt(m[i+2], 10, 64)
+		if err != nil {
+			return FuzzStats{}, false
+		}
+	}
+
+	return FuzzStats{
+		Elapsed:        elapsed,
+		Execs:          counts[0],
+		ExecsPerSec:    counts[1],
+		NewInteresting: counts[2],
+		TotalCorpus:    counts[3],
+	}, true
+}
+
+// max returns the largest value of each of the statistics of s and o.
+func (s FuzzStats) max(o FuzzStats) FuzzStats {
+	return FuzzStats{
+		Elapsed:        max(s.Elapsed, o.Elapsed),
+		Execs:          max(s.Execs, o.Execs),
+		ExecsPerSec:    max(s.ExecsPerSec, o.ExecsPerSec),
+		NewInteresting: max(s.NewInteresting, o.NewInteresting),
+		TotalCorpus:    max(s.TotalCorpus, o.TotalCorpus),
+	}
+}
+
+// RunMetrics are the final and peak statistics of the fuzzing runs of a
+// target. For a single run, Final holds the statistics of its last progress
+// line. For the runs of a target in a cycle, which may be restarts after
+// crashes or parallel shards, Final holds the total fuzzing time, executions
+// and new interesting inputs of the runs, their average execution rate per run
+// and the largest corpus.
+type RunMetrics struct {
+	// Runs is the number of runs that showed progress.
+	Runs int
+
+	// Final holds the statistics at the end of the runs.
+	Final FuzzStats
+
+	// Peak holds the largest value of each statistic seen in any
+	// progress line of the runs.
+	Peak FuzzStats
+}
+
+// observe records the statistics of a progress line of a single run.
+func (m *RunMetrics) observe(s FuzzStats) {
+	m.Runs = 1
+	m.Final = s
+	m.Peak = m.Peak.max(s)
+}
+
+// add adds the metrics of other runs of the same target.
+func (m *RunMetrics) add(o RunMetrics) {
+	if o.Runs == 0 {
+		return
+	}
+
+	m.Runs += o.Runs
+	m.Final.Elapsed += o.Final.Elapsed
+	m.Final.Execs += o.Final.Execs
+	m.Final.NewInteresting += o.Final.NewInteresting
+	m.Final.TotalCorpus = max(m.Final.TotalCorpus, o.Final.TotalCorpus)
+	m.Peak = m.Peak.max(o.Peak)
+
+	if seconds := int64(m.Final.Elapsed / time.Second); seconds > 0 {
+		m.Final.ExecsPerSec = m.Final.Execs / seconds
+	} else {
+		m.Final.ExecsPerSec = max(m.Final.ExecsPerSec,
+			o.Final.ExecsPerSec)
+	}
+}
+
+// metricsRecorder collects the metrics of a fuzzing run from its progress
+// lines. It is safe for concurrent use, since the output of a run is processed
+// while the run is waited for.
+type metricsRecorder struct {
+	mu      sync.Mutex
+	metrics RunMetrics
+}
+
+// observe records the statistics shown by an output line of the run, if it is
+// a progress line.
+func (r *metricsRecorder) observe(line string) {
+	stats, ok := parseFuzzStats(line)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics.observe(stats)
+}
+
+// record replaces the metrics of the run with those reported for it, such as
+// by the agent that ran it.
+func (r *metricsRecorder) record(metrics RunMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = metrics
+}
+
+// result returns the metrics of the run recorded so far.
+func (r *metricsRecorder) result() RunMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.metrics
+}
+
+// CycleMetrics are the metrics of the runs of a target in a fuzzing cycle.
+type CycleMetrics struct {
+	// Cycle is the ID of the fuzzing cycle of the runs.
+	Cycle string
+
+	RunMetrics
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseFuzzStats verifies that the statistics of the fuzzer's progress
+// lines are parsed, and that other lines are ignored.
+func TestParseFuzzStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected FuzzStats
+		ok       bool
+	}{
+		{
+			name: "progress",
+			line: "fuzz: elapsed: 3s, execs: 12345 (4115/sec), " +
+				"new interesting: 12 (total: 340)",
+			expected: FuzzStats{
+				Elapsed:        3 * time.Second,
+				Execs:          12345,
+				ExecsPerSec:    4115,
+				NewInteresting: 12,
+				TotalCorpus:    340,
+			},
+			ok: true,
+		},
+		{
+			name: "long run",
+			line: "fuzz: elapsed: 1h2m3s, execs: 9 (0/sec), " +
+				"new interesting: 0 (total: 1)",
+			expected: FuzzStats{
+				Elapsed: time.Hour + 2*time.Minute +
+					3*time.Second,
+				Execs:       9,
+				TotalCorpus: 1,
+			},
+			ok: true,
+		},
+		{
+			name: "baseline coverage",
+			line: "fuzz: elapsed: 0s, gathering baseline " +
+				"coverage: 3/9 completed",
+		},
+		{
+			name: "minimizing",
+			line: "fuzz: elapsed: 6s, minimizing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, ok := parseFuzzStats(tt.line)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, stats)
+		})
+	}
+}
+
+// TestRunMetrics verifies that the final and peak statistics of a run are
+// kept, and that the metrics of several runs of a target are combined.
+func TestRunMetrics(t *testing.T) {
+	var first RunMetrics
+	first.observe(FuzzStats{Elapsed: 3 * time.Second, Execs: 300,
+		ExecsPerSec: 100, NewInteresting: 5, TotalCorpus: 15})
+	first.observe(FuzzStats{Elapsed: 6 * time.Second, Execs: 420,
+		ExecsPerSec: 40, NewInteresting: 6, TotalCorpus: 16})
+
+	assert.Equal(t, RunMetrics{
+		Runs: 1,
+		Final: FuzzStats{Elapsed: 6 * time.Second, Execs: 420,
+			ExecsPerSec: 40, NewInteresting: 6, TotalCorpus: 16},
+		Peak: FuzzStats{Elapsed: 6 * time.Second, Execs: 420,
+			ExecsPerSec: 100, NewInteresting: 6, TotalCorpus: 16},
+	}, first)
+
+	var second RunMetrics
+	second.observe(FuzzStats{Elapsed: 4 * time.Second, Execs: 580,
+		ExecsPerSec: 145, NewInteresting: 2, TotalCorpus: 18})
+
+	var total RunMetrics
+	total.add(first)
+	total.add(RunMetrics{})
+	total.add(second)
+
+	assert.Equal(t, RunMetrics{
+		Runs: 2,
+		Final: FuzzStats{Elapsed: 10 * time.Second, Execs: 1000,
+			ExecsPerSec: 100, NewInteresting: 8, TotalCorpus: 18},
+		Peak: FuzzStats{Elapsed: 6 * time.Second, Execs: 580,
+			ExecsPerSec: 145, NewInteresting: 6, TotalCorpus: 18},
+	}, total)
+}
+
+// TestProcessFuzzStreamMetrics verifies that the output processor records the
+// metrics of the progress lines of a run.
+func TestProcessFuzzStreamMetrics(t *testing.T) {
+	processor := NewFuzzOutputProcessor(slog.Default(), t.TempDir())
+	processor.metrics = &metricsRecorder{}
+
+	crash, err := processor.processFuzzStream(stdoutOutput(t,
+		"fuzz: elapsed: 0s, gathering baseline coverage: 0/9 "+
+			"completed\n"+
+			"fuzz: elapsed: 3s, execs: 900 (300/sec), new "+
+			"interesting: 1 (total: 10)\n"+
+			"fuzz: elapsed: 6s, execs: 1500 (200/sec), new "+
+			"interesting: 3 (total: 12)\n"+
+			"PASS\n"))
+	require.NoError(t, err)
+	assert.Nil(t, crash)
+
+	metrics := processor.metrics.result()
+	assert.Equal(t, 1, metrics.Runs)
+	assert.Equal(t, int64(1500), metrics.Final.Execs)
+	assert.Equal(t, int64(200), metrics.Final.ExecsPerSec)
+	assert.Equal(t, int64(300), metrics.Peak.ExecsPerSec)
+	assert.Equal(t, int64(12), metrics.Final.TotalCorpus)
+}
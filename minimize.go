@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// corpusFileHeader is the first line of the files of a Go fuzzing corpus.
+const corpusFileHeader = "go test fuzz v1"
+
+// corpusValue is a value of a corpus file, one argument of the fuzz target.
+type corpusValue struct {
+	// line is the line of the value in the corpus file, such as
+	// "int(42)" or "[]byte(\"\\x00\")".
+	line string
+
+	// typ and data are the type and the contents of string and []byte
+	// values, the only values that are shrunk. typ is empty for others.
+	typ  string
+	data string
+}
+
+// parseCorpusFile parses the values of a corpus file.
+func parseCorpusFile(input string) ([]corpusValue, error) {
+	lines := strings.Split(strings.TrimSuffix(input, "\n"), "\n")
+	if lines[0] != corpusFileHeader {
+		return nil, fmt.Errorf("not a corpus file")
+	}
+
+	values := make([]corpusValue, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		value := corpusValue{line: line}
+
+		typ, lit, ok := strings.Cut(line, "(")
+		lit, closed := strings.CutSuffix(lit, ")")
+		if ok && closed && (typ == "string" || typ == "[]byte") {
+			data, err := strconv.Unquote(lit)
+			if err != nil {
+				return nil, fmt.Errorf("invalid corpus value "+
+					"%q: %w", line, err)
+			}
+			value.typ, value.data = typ, data
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// formatCorpusFile formats values as a corpus file.
+func formatCorpusFile(values []corpusValue) string {
+	var b strings.Builder
+	b.WriteString(corpusFileHeader + "\n")
+	for _, value := range values {
+		if value.typ == "" {
+			b.WriteString(value.line + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%s(%s)\n", value.typ,
+			strconv.Quote(value.data))
+	}
+
+	return b.String()
+}
+
+// reduceCorpusInput shrinks the string and []byte values of a corpus file for
+// as long as ctx allows, by removing ever smaller chunks of their bytes while
+// the input still reproduces the crash. It returns the smallest input found
+// that reproduces, which is the input itself if none does or if it is not a
+// corpus file.
+func reduceCorpusInput(ctx context.Context, input string,
+	reproduces func(candidate string) bool) string {
+
+	values, err := parseCorpusFile(input)
+	if err != nil {
+		return input
+	}
+
+	for i := range values {
+		if values[i].typ == "" {
+			continue
+		}
+
+		for chunk := len(values[i].data) / 2; chunk > 0; chunk /= 2 {
+			data := values[i].data
+			for start := 0; start < len(data); {
+				if ctx.Err() != nil {
+					return formatCorpusFile(values)
+				}
+
+				end := min(start+chunk, len(data))
+				values[i].data = data[:start] + data[end:]
+				if reproduces(formatCorpusFile(values)) {
+					data = values[i].data
+					continue
+				}
+				values[i].data = data
+				start = end
+			}
+		}
+	}
+
+	return formatCorpusFile(values)
+}
+
+// crashMinimizer reruns a fuzz target on smaller failing inputs of a crash, to
+// find the smallest one that still crashes it the same way.
+type crashMinimizer struct {
+	wg   *WorkerGroup
+	task Task
+}
+
+// minimizeCrash shrinks the failing input of the crash, within the configured
+// crash minimize time, before it is reported. The shrunk input replaces the
+// failing input of the crash, whose original input is kept. Crashes without a
+// failing input, and runs killed for running out of memory or hanging, are
+// left alone.
+func (wg *WorkerGroup) minimizeCrash(task Task, crash *fuzzCrash) {
+	if wg.cfg.Fuzz.CrashMinimizeTime == 0 || crash.failingInput == "" ||
+		crash.kind == crashKindOOM || crash.kind == crashKindHang {
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(wg.ctx,
+		wg.cfg.Fuzz.CrashMinimizeTime)
+	defer cancel()
+
+	logger := wg.logger.With("package", task.Package.Path, "target",
+		task.Target)
+	m := &crashMinimizer{wg: wg, task: task}
+
+	// The signature of a crash reproduced from the corpus may differ from
+	// the one of the fuzzing run, so the smaller inputs must match the
+	// one of the original input.
+	reference, err := m.signature(ctx, crash.failingInput)
+	if err != nil || reference == "" {
+		logger.Info("Failing input does not reproduce the crash; "+
+			"not minimizing it", "error", err)
+		return
+	}
+
+	attempts := 0
+	minimized := reduceCorpusInput(ctx, crash.failingInput,
+		func(candidate string) bool {
+			attempts++
+			signature, err := m.signature(ctx, candidate)
+			if err != nil && ctx.Err() == nil {
+				logger.Warn("Failed to run minimization "+
+					"candidate", "error", err)
+			}
+			return signature == reference
+		})
+	if wg.ctx.Err() != nil {
+		return
+	}
+
+	logger.Info("Minimized failing input", "originalSize",
+		len(crash.failingInput), "minimizedSize", len(minimized),
+		"attempts", attempts)
+	if len(minimized) < len(crash.failingInput) {
+		crash.originalInput = crash.failingInput
+		crash.failingInput = minimized
+	}
+}
+
+// signature runs the fuzz target on the given input, as an entry of its seed
+// corpus, and returns the signature of the crash it causes, or an empty string
+// if it does not crash.
+func (m *crashMinimizer) signature(ctx context.Context,
+	input string) (string, error) {
+
+	task, cfg := m.task, m.wg.cfg
+	target := task.Target
+	fuzzBinaryPath := task.binaryDir(cfg.Project.BinaryDir)
+
+	id := "minimize-" + ComputeSHA256Short(input)
+	inputPath := filepath.Join(fuzzBinaryPath, "testdata", "fuzz", target,
+		id)
+	if err := EnsureDirExists(filepath.Dir(inputPath)); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(inputPath, []byte(input), 0644); err != nil {
+		return "", fmt.Errorf("writing minimization candidate: %w",
+			err)
+	}
+	defer os.Remove(inputPath)
+
+	crash, err := runContainer(m.wg.sandboxContainer(ctx, task,
+		fuzzBinaryPath, []string{
+			fmt.Sprintf("./%s.test", target),
+			fmt.Sprintf("-test.run=^%s$/^%s$", target, id),
+		}), task)
+	if crash == nil {
+		return "", err
+	}
+
+	return crash.signature(signatureOptions(&cfg.Fuzz,
+		m.wg.modulePaths)), nil
+}
+
+// formatOriginalInput formats the report section noting the original failing
+// input of a crash, stored with the corpus, which was minimized into the
+// failing testcase of the report.
+func formatOriginalInput(input string) string {
+	return fmt.Sprintf("## Original input\nThe failing testcase was "+
+		"minimized from the input the fuzzer found (%d bytes, SHA-256 "+
+		"`%s`), which is stored with the fuzzing corpus until this "+
+		"issue is closed.\n", len(input), inputChecksum(input))
+}
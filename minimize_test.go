@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCorpusFile verifies that corpus files are parsed into their values and
+// formatted back, with only the string and []byte values to shrink.
+func TestCorpusFile(t *testing.T) {
+	input := "go test fuzz v1\n" +
+		"[]byte(\"\\x00\\xffabc\")\n" +
+		"int(42)\n" +
+		"string(\"héllo\\n\")\n"
+
+	values, err := parseCorpusFile(input)
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	assert.Equal(t, "\x00\xffabc", values[0].data)
+	assert.Empty(t, values[1].typ)
+	assert.Equal(t, "héllo\n", values[2].data)
+	assert.Equal(t, input, formatCorpusFile(values))
+
+	_, err = parseCorpusFile("not a corpus file\n")
+	assert.Error(t, err)
+
+	_, err = parseCorpusFile("go test fuzz v1\nstring(\"unterminated)\n")
+	assert.Error(t, err)
+}
+
+// TestReduceCorpusInput verifies that the values of a failing input are shrunk
+// to the bytes the crash needs, and that inputs that are not corpus files are
+// left alone.
+func TestReduceCorpusInput(t *testing.T) {
+	// The crash needs "bug" in the first value and a non-empty second
+	// value.
+	reproduces := func(candidate string) bool {
+		values, err := parseCorpusFile(candidate)
+		require.NoError(t, err)
+		return strings.Contains(values[0].data, "bug") &&
+			values[2].data != ""
+	}
+
+	input := "go test fuzz v1\n" +
+		"[]byte(\"" + strings.Repeat("x", 100) + "bug" +
+		strings.Repeat("y", 57) + "\")\n" +
+		"bool(true)\n" +
+		"string(\"some text\")\n"
+
+	minimized := reduceCorpusInput(context.Background(), input,
+		reproduces)
+	values, err := parseCorpusFile(minimized)
+	require.NoError(t, err)
+	assert.Equal(t, "bug", values[0].data)
+	assert.Equal(t, "bool(true)", values[1].line)
+	assert.Len(t, values[2].data, 1)
+
+	// Once the context is done, the smallest input found so far is kept.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, input, reduceCorpusInput(ctx, input, reproduces))
+
+	assert.Equal(t, "raw", reduceCorpusInput(context.Background(), "raw",
+		reproduces))
+}
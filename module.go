@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// recursivePkgSuffix is the suffix of a pkgs-path entry that selects
+	// every package below the given directory, across module boundaries.
+	recursivePkgSuffix = "..."
+
+	// rootModuleDir is the module directory of the module located at the
+	// root of the project.
+	rootModuleDir = "."
+)
+
+// GoPackage describes a package to fuzz together with the Go module it belongs
+// to.
+//
+// Path is the package directory relative to the project root. Since it
+// contains both the module directory and the package directory within that
+// module, it is unique across all modules of the project and is used to key
+// the corpus, the reports and the state. Two modules that contain a package
+// with the same path relative to their own root never collide.
+type GoPackage struct {
+	// Path is the slash-separated package directory relative to the
+	// project root.
+	Path string
+
+	// ModuleDir is the slash-separated directory of the module root
+	// relative to the project root ("." for the root module).
+	ModuleDir string
+
+	// ModulePath is the module path declared in the module's go.mod.
+	ModulePath string
+}
+
+// RelPath returns the package path relative to its module root in the form
+// expected by the go command (e.g. "./parser").
+func (p GoPackage) RelPath() string {
+	rel, err := filepath.Rel(filepath.FromSlash(p.ModuleDir),
+		filepath.FromSlash(p.Path))
+	if err != nil || rel == "." {
+		return "."
+	}
+
+	return "./" + filepath.ToSlash(rel)
+}
+
+// moduleRootPath returns the absolute path of the package's module root inside
+// the project directory.
+func (p GoPackage) moduleRootPath(srcDir string) string {
+	return filepath.Join(srcDir, filepath.FromSlash(p.ModuleDir))
+}
+
+// discoverPackages resolves every cfg.Fuzz.PkgsPath entry into the packages to
+// fuzz. An entry ending in "/..." selects all packages containing test files
+// below that directory, including those in nested modules. Every package is
+// associated with the nearest enclosing module, so that discovery and builds
+// run from the correct module root.
+func discoverPackages(srcDir string, pkgsPath []string) ([]GoPackage, error) {
+	seen := make(map[string]bool)
+	var pkgs []GoPackage
+
+	addPkg := func(pkgDir string) error {
+		pkg, err := resolvePackage(srcDir, pkgDir)
+		if err != nil {
+			return err
+		}
+		if seen[pkg.Path] {
+			return nil
+		}
+		seen[pkg.Path] = true
+		pkgs = append(pkgs, pkg)
+
+		return nil
+	}
+
+	for _, entry := range pkgsPath {
+		dir, recursive := strings.CutSuffix(filepath.ToSlash(entry),
+			recursivePkgSuffix)
+		if !recursive {
+			if err := addPkg(entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		dirs, err := findTestPackageDirs(srcDir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("expanding %q: %w", entry, err)
+		}
+		for _, d := range dirs {
+			if err := addPkg(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return pkgs, nil
+}
+
+// resolvePackage locates the module that contains pkgDir (relative to srcDir)
+// and returns the corresponding GoPackage.
+func resolvePackage(srcDir, pkgDir string) (GoPackage, error) {
+	pkgPath := filepath.Clean(filepath.FromSlash(pkgDir))
+	if filepath.IsAbs(pkgPath) || pkgPath == ".." ||
+		strings.HasPrefix(pkgPath, ".."+string(filepath.Separator)) {
+
+		return GoPackage{}, fmt.Errorf("package path %q must be "+
+			"relative to the project root", pkgDir)
+	}
+
+	absPkgPath := filepath.Join(srcDir, pkgPath)
+	info, err := os.Stat(absPkgPath)
+	if err != nil {
+		return GoPackage{}, fmt.Errorf("package %q: %w", pkgDir, err)
+	}
+	if !info.IsDir() {
+		return GoPackage{}, fmt.Errorf("package %q is not a directory",
+			pkgDir)
+	}
+
+	moduleDir, err := findModuleRoot(srcDir, pkgPath)
+	if err != nil {
+		return GoPackage{}, fmt.Errorf("package %q: %w", pkgDir, err)
+	}
+
+	modulePath, err := readModulePath(filepath.Join(srcDir, moduleDir,
+		"go.mod"))
+	if err != nil {
+		return GoPackage{}, err
+	}
+
+	return GoPackage{
+		Path:       filepath.ToSlash(pkgPath),
+		ModuleDir:  filepath.ToSlash(moduleDir),
+		ModulePath: modulePath,
+	}, nil
+}
+
+// findModuleRoot walks up from pkgPath (relative to srcDir) until it finds a
+// directory containing a go.mod file, without leaving srcDir. It returns the
+// module directory relative to srcDir.
+func findModuleRoot(srcDir, pkgPath string) (string, error) {
+	dir := pkgPath
+	for {
+		goModPath := filepath.Join(srcDir, dir, "go.mod")
+		if _, err := os.Stat(goModPath); err == nil {
+			return dir, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("cannot stat %q: %w", goModPath,
+				err)
+		}
+
+		if dir == rootModuleDir {
+			return "", fmt.Errorf("no go.mod found for %q", pkgPath)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// readModulePath returns the module path declared by the "module" directive of
+// the given go.mod file.
+func readModulePath(goModPath string) (string, error) {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return "", fmt.Errorf("read %q: %w", goModPath, err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+
+	return "", fmt.Errorf("module directive not found in %q", goModPath)
+}
+
+// findTestPackageDirs returns, relative to srcDir, every directory below dir
+// that contains at least one _test.go file. Like the go command, it skips
+// testdata and vendor directories as well as directories starting with "." or
+// "_".
+func findTestPackageDirs(srcDir, dir string) ([]string, error) {
+	root := filepath.Join(srcDir, filepath.FromSlash(dir))
+
+	// A directory is walked before its own files that sort after its
+	// subdirectories, so its test files are not all seen in a row.
+	seen := make(map[string]bool)
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry,
+		walkErr error) error {
+
+		if walkErr != nil {
+			return walkErr
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (name == "testdata" ||
+				name == "vendor" ||
+				strings.HasPrefix(name, ".") ||
+				strings.HasPrefix(name, "_")) {
+
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(srcDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !seen[rel] {
+			seen[rel] = true
+			dirs = append(dirs, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// detectGoWork returns the value of GOWORK to use for go commands run inside
+// the project. If the project has a go.work file at its root, it is used
+// explicitly; otherwise workspace mode is disabled so that a go.work file in a
+// parent directory of the workspace can never change which module a package is
+// built against.
+func detectGoWork(srcDir string) string {
+	goWorkPath := filepath.Join(srcDir, "go.work")
+	if _, err := os.Stat(goWorkPath); err == nil {
+		return goWorkPath
+	}
+
+	return "off"
+}
+
+// goEnv returns the environment variables that must be set on every go
+// command run inside the project directory with the given Go version (empty
+// for the local toolchain).
+func goEnv(cfg *Config, goVersion string) []string {
+	return append([]string{"GOWORK=" + cfg.Project.GoWork},
+		toolchainEnv(goVersion)...)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates the given files (relative to root) with their contents.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+// TestDiscoverPackages verifies that package paths are resolved to the nearest
+// enclosing module, that recursive entries descend into nested modules, and
+// that packages with the same path inside different modules stay distinct.
+func TestDiscoverPackages(t *testing.T) {
+	srcDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		"go.mod":                          "module example.com/root\n",
+		"parser/parser_test.go":           "package parser\n",
+		"modA/go.mod":                     "module example.com/a\n",
+		"modA/parser/parser_test.go":      "package parser\n",
+		"modB/go.mod":                     "module \"example.com/b\"\n",
+		"modB/parser/parser_test.go":      "package parser\n",
+		"modB/parser/testdata/x_test.go":  "package ignored\n",
+		"modB/internal/util/util.go":      "package util\n",
+		"modB/.hidden/hidden_test.go":     "package hidden\n",
+		"modB/parser/sub/sub_test.go":     "package sub\n",
+		"modB/vendor/dep/dep_test.go":     "package dep\n",
+		"modB/_examples/ex/ex_test.go":    "package ex\n",
+		"modB/parser/sub/another_test.go": "package sub\n",
+	})
+
+	pkgs, err := discoverPackages(srcDir, []string{
+		"parser", "modA/parser", "modB/...", "./modA/parser",
+	})
+	require.NoError(t, err)
+
+	expected := []GoPackage{
+		{
+			Path:       "parser",
+			ModuleDir:  ".",
+			ModulePath: "example.com/root",
+		},
+		{
+			Path:       "modA/parser",
+			ModuleDir:  "modA",
+			ModulePath: "example.com/a",
+		},
+		{
+			Path:       "modB/parser",
+			ModuleDir:  "modB",
+			ModulePath: "example.com/b",
+		},
+		{
+			Path:       "modB/parser/sub",
+			ModuleDir:  "modB",
+			ModulePath: "example.com/b",
+		},
+	}
+	assert.Equal(t, expected, pkgs)
+
+	relPaths := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		relPaths[i] = pkg.RelPath()
+	}
+	assert.Equal(t, []string{"./parser", "./parser", "./parser",
+		"./parser/sub"}, relPaths)
+}
+
+// TestDiscoverPackagesErrors verifies that invalid package paths are rejected.
+func TestDiscoverPackagesErrors(t *testing.T) {
+	srcDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		"nomod/nomod_test.go": "package nomod\n",
+	})
+
+	tests := []struct {
+		name         string
+		pkgsPath     string
+		expectErrMsg string
+	}{
+		{
+			name:         "path outside the project",
+			pkgsPath:     "../parser",
+			expectErrMsg: "must be relative to the project root",
+		},
+		{
+			name:         "missing package",
+			pkgsPath:     "missing",
+			expectErrMsg: "no such file or directory",
+		},
+		{
+			name:         "package without module",
+			pkgsPath:     "nomod",
+			expectErrMsg: "no go.mod found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := discoverPackages(srcDir,
+				[]string{tt.pkgsPath})
+			assert.ErrorContains(t, err, tt.expectErrMsg)
+		})
+	}
+}
+
+// TestFindTestPackageDirs verifies that a directory whose test files sort
+// before and after one of its subdirectories is listed once.
+func TestFindTestPackageDirs(t *testing.T) {
+	srcDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		"go.mod":                 "module example.com/root\n",
+		"pkg/a_test.go":          "package pkg\n",
+		"pkg/b/b_test.go":        "package b\n",
+		"pkg/c_test.go":          "package pkg\n",
+		"pkg/testdata/x.go":      "package x\n",
+		"pkg/testdata/x_test.go": "package x\n",
+	})
+
+	dirs, err := findTestPackageDirs(srcDir, "pkg")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pkg", filepath.Join("pkg", "b")}, dirs)
+}
+
+// TestDetectGoWork verifies that the project's go.work file is used when
+// present and that workspace mode is disabled otherwise.
+func TestDetectGoWork(t *testing.T) {
+	srcDir := t.TempDir()
+	assert.Equal(t, "off", detectGoWork(srcDir))
+
+	writeFiles(t, srcDir, map[string]string{"go.work": "go 1.24\n"})
+	assert.Equal(t, filepath.Join(srcDir, "go.work"),
+		detectGoWork(srcDir))
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,6 +11,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
 var (
@@ -41,13 +46,137 @@ var (
 	)
 )
 
+// maxTailLines is the number of most recent output lines kept by the output
+// processor, reported when a run is killed without a failure report.
+const maxTailLines = 50
+
+// maxRecentInputs is the number of recently added corpus inputs reported for
+// runs killed before the fuzzer could write the failing input.
+const maxRecentInputs = 3
+
+// outOfMemoryMarker is printed by the Go runtime when an allocation fails, for
+// example because of an address space limit.
+const outOfMemoryMarker = "runtime: out of memory"
+
+// outputStream identifies the stream an output line of a run was written to.
+type outputStream int
+
+const (
+	// streamStdout is the standard output of a run, where the testing
+	// package reports the failures of fuzz targets.
+	streamStdout outputStream = iota
+
+	// streamStderr is the standard error of a run, where the fuzzer
+	// prints its status and the Go runtime its panics and goroutine dumps.
+	streamStderr
+)
+
+// String returns the name of the stream.
+func (s outputStream) String() string {
+	if s == streamStderr {
+		return "stderr"
+	}
+
+	return "stdout"
+}
+
+// outputLine is a line of the output of a run, without its newline, tagged
+// with the stream it was written to.
+type outputLine struct {
+	stream outputStream
+	text   string
+}
+
+// joinLines returns the text of the lines written to each stream,
+// newline-terminated.
+func joinLines(lines []outputLine) (string, string) {
+	var stdout, stderr strings.Builder
+	for _, line := range lines {
+		b := &stdout
+		if line.stream == streamStderr {
+			b = &stderr
+		}
+		b.WriteString(line.text + "\n")
+	}
+
+	return stdout.String(), stderr.String()
+}
+
 // fuzzCrash represents information about a crash encountered during fuzz
-// testing. It captures the error logs, the input that caused the failure, and
-// the location in the code where the first error occurred.
+// testing. It captures the kind of crash and its detail (see
+// crashClassifier.classify), the error logs and the standard error output of
+// the run, the input that caused the failure, the file the fuzzer
+// wrote it to (empty for seed corpus failures and killed runs), the location in
+// the code where the first error occurred, and the project frames of its stack
+// trace, top first. For runs killed before the fuzzer could write the failing
+// input, it holds the inputs the fuzzer added to the corpus last instead,
+// newest first. The raw output of the run is archived in the run log at
+// logPath, if set. If the failing input was minimized, originalInput holds the
+// one the fuzzer found.
 type fuzzCrash struct {
+	kind               crashKind
+	detail             string
 	errorLogs          string
+	stderrLogs         string
 	failingInput       string
+	failingInputFile   string
 	failureFileAndLine string
+	stack              []StackFrame
+	recentInputs       []string
+	logPath            string
+	originalInput      string
+}
+
+// signature returns a short hash identifying the crash, used to deduplicate
+// crashes and their GitHub issues. It is built from the topmost project frames
+// of the crash's stack trace, or from the location of the first error for
+// crashes without one, such as t.Fatal failures. Crashes of another kind than
+// plain failures get signatures of their own, even at the same location.
+func (fc fuzzCrash) signature(opts SignatureOptions) string {
+	key := stackSignature(fc.stack, opts)
+	if key == "" {
+		key = fc.failureFileAndLine
+	}
+
+	if fc.kind == crashKindFailure {
+		return ComputeSHA256Short(key)
+	}
+
+	return ComputeSHA256Short(string(fc.kind) + ":" + key)
+}
+
+// crashID identifies the issue of a crash: the signature and the kind its title
+// is tagged with.
+type crashID struct {
+	signature string
+	kind      crashKind
+}
+
+// legacyIDs returns the identities earlier versions of go-continuous-fuzz gave
+// the crash, whose issues may still be open. Before signatures were built from
+// stack traces, crashes were identified by the location of their first error.
+// Before crashes were classified further than running out of memory and
+// hanging, crashes of the other kinds were reported as plain failures.
+func (fc fuzzCrash) legacyIDs() []crashID {
+	location := fuzzCrash{
+		kind:               fc.kind,
+		failureFileAndLine: fc.failureFileAndLine,
+	}
+	ids := []crashID{{
+		signature: location.signature(SignatureOptions{}),
+		kind:      fc.kind,
+	}}
+
+	if fc.kind != crashKindFailure && fc.kind != crashKindOOM &&
+		fc.kind != crashKindHang {
+
+		ids = append(ids, crashID{
+			signature: ComputeSHA256Short(fc.failureFileAndLine),
+			kind:      crashKindFailure,
+		})
+	}
+
+	return ids
 }
 
 // fuzzOutputProcessor handles parsing and logging of fuzzing output streams,
@@ -58,6 +187,50 @@ type fuzzOutputProcessor struct {
 
 	// Directory containing the fuzzing corpus.
 	corpusDir string
+
+	// tail holds the most recent output lines, up to maxTailLines.
+	tail []outputLine
+
+	// outputLevel is the level the output lines are logged at.
+	outputLevel slog.Level
+
+	// archive, if set, receives the output lines of both streams as they
+	// are demultiplexed, such as the run log.
+	archive io.Writer
+
+	// redactor removes the secrets from the output lines before they are
+	// logged and archived.
+	redactor *redactor
+
+	// watchdog, if set, tracks the progress of the run. Once it detected
+	// a hang, the output lines are kept in dump, starting with the tail
+	// at that time, up to dumpBytes of maxDumpBytes.
+	watchdog  *progressWatchdog
+	dump      []outputLine
+	dumpBytes int
+
+	// metrics, if set, records the statistics of the progress lines of
+	// the run.
+	metrics *metricsRecorder
+
+	// failure collects the failure report of the run, once the testing
+	// package reported a failure.
+	failure *failureReport
+
+	// err is the error that stopped the processing of the output.
+	err error
+}
+
+// failureReport collects the output of a run following a failure reported by
+// the testing package, and the details of the crash extracted from it.
+type failureReport struct {
+	classifier crashClassifier
+	stacks     [2]stackParser
+	stdout     strings.Builder
+	stderr     strings.Builder
+	input      string
+	inputFile  string
+	fileLine   string
 }
 
 // NewFuzzOutputProcessor constructs a fuzzOutputProcessor for the given logger
@@ -66,109 +239,273 @@ func NewFuzzOutputProcessor(logger *slog.Logger,
 	corpusDir string) *fuzzOutputProcessor {
 
 	return &fuzzOutputProcessor{
-		logger:    logger,
-		corpusDir: corpusDir,
+		logger:      logger,
+		corpusDir:   corpusDir,
+		outputLevel: slog.LevelInfo,
 	}
 }
 
-// processFuzzStream reads each line from the fuzzing output stream, logs all
-// lines, and captures failure details if a failure is detected.
+// processFuzzStream demultiplexes the output stream of a run, in the stdcopy
+// framing of Docker, into the lines written to its standard output and
+// standard error. It logs all lines, and captures failure details if a failure
+// is detected.
 func (fp *fuzzOutputProcessor) processFuzzStream(stream io.Reader) (*fuzzCrash,
 	error) {
 
-	scanner := bufio.NewScanner(stream)
+	stdout := &lineWriter{fp: fp, stream: streamStdout}
+	stderr := &lineWriter{fp: fp, stream: streamStderr}
+	_, err := stdcopy.StdCopy(stdout, stderr, stream)
+	stdout.flush()
+	stderr.flush()
+
+	switch {
+	case fp.err != nil:
+		return nil, fmt.Errorf("processing fuzz stream: %w", fp.err)
 
-	// Scan until a failure line is found; if not found, return nil.
-	if !fp.scanUntilFailure(scanner) {
+	// The stream broke, e.g. because the connection to the Docker daemon
+	// was lost, so the run is worth retrying.
+	case err != nil:
+		return nil, newTransientError(fmt.Errorf("reading fuzz "+
+			"stream: %w", err))
+
+	case fp.failure == nil:
 		return nil, nil
 	}
 
-	// Process and log failure lines, capturing error data.
-	return fp.processFailureLines(scanner)
+	return fp.failure.crash(), nil
 }
 
-// scanUntilFailure scans the output until a failure indicator (--- FAIL:) is
-// found. Returns true if a failure line is detected, false otherwise.
-func (fp *fuzzOutputProcessor) scanUntilFailure(scanner *bufio.Scanner) bool {
-	for scanner.Scan() {
-		line := scanner.Text()
-		fp.logger.Info("Fuzzer output", "message", line)
-
-		// Detect the start of a failure section.
-		if strings.Contains(line, "--- FAIL:") {
-			return true
+// processOutput processes the output a run wrote to files rather than to a
+// stream, as processFuzzStream does. The lines of the standard error follow all
+// lines of the standard output, so that they belong to the failure it reports.
+func (fp *fuzzOutputProcessor) processOutput(stdout,
+	stderr io.Reader) (*fuzzCrash, error) {
+
+	for _, output := range []struct {
+		r      io.Reader
+		stream outputStream
+	}{{stdout, streamStdout}, {stderr, streamStderr}} {
+		w := &lineWriter{fp: fp, stream: output.stream}
+		_, err := io.Copy(w, output.r)
+		w.flush()
+
+		switch {
+		case fp.err != nil:
+			return nil, fmt.Errorf("processing output: %w", fp.err)
+
+		case err != nil:
+			return nil, fmt.Errorf("reading output: %w", err)
 		}
 	}
-	return false
+
+	if fp.failure == nil {
+		return nil, nil
+	}
+
+	return fp.failure.crash(), nil
+}
+
+// lineWriter splits the output written to a stream of a run into lines and
+// hands them to the output processor. Overlong lines are split at
+// bufio.MaxScanTokenSize.
+type lineWriter struct {
+	fp      *fuzzOutputProcessor
+	stream  outputStream
+	partial []byte
 }
 
-// processFailureLines scans the fuzzer output line by line after a failure is
-// detected. It collects relevant log lines, extracts the location of the first
-// error for deduplication, attempts to read the failing input data (if
-// available), and notify the caller about the crash.
-func (fp *fuzzOutputProcessor) processFailureLines(scanner *bufio.Scanner,
-) (*fuzzCrash, error) {
-
-	var failingLog string
-	var failingInputString string
-	var failingFileLine string
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fp.logger.Info("Fuzzer output", "message", line)
-
-		// Write the current line to the failure log.
-		failingLog += line + "\n"
-
-		// failingFileLine stores the .go file and line where the first
-		// error occurred, which is used for deduplication.
-		if failingFileLine == "" {
-			// Parse the current error line to extract the .go file
-			// and line, then assign it to failingFileLine.
-			errorFileAndLine := parseFileAndLine(line)
-
-			if errorFileAndLine != "" {
-				failingFileLine = errorFileAndLine
+// Write processes the complete lines of p and keeps the rest for the next
+// write. It fails once the processor stopped.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for w.fp.err == nil {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			if len(w.partial) < bufio.MaxScanTokenSize {
+				break
 			}
+			i = bufio.MaxScanTokenSize
 		}
 
-		// If error data has already been captured, skip further
-		// extraction.
-		if failingInputString != "" {
-			continue
-		}
+		line := strings.TrimSuffix(string(w.partial[:i]), "\r")
+		w.partial = w.partial[min(i+1, len(w.partial)):]
+		w.fp.processLine(outputLine{stream: w.stream, text: line})
+	}
+	if w.fp.err != nil {
+		return 0, w.fp.err
+	}
 
-		// Parse the line to extract the fuzz target and ID (hex) of the
-		// failing input.
-		// When a fuzz target encounters a failure during f.Add, the
-		// crash is printed, but no input is saved to testdata/fuzz.
-		//
-		// The log output typically appears as:
-		//   failure while testing seed corpus entry: FuzzFoo/seed#0
-		//
-		// As a result, no error data will be printed.
-		target, id := parseFailureLine(line)
-		// If either target or ID is empty, skip further processing.
-		if target == "" || id == "" {
-			continue
-		}
+	return len(p), nil
+}
+
+// flush processes the last line of the stream if it has no newline.
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 && w.fp.err == nil {
+		w.fp.processLine(outputLine{stream: w.stream,
+			text: string(w.partial)})
+	}
+	w.partial = nil
+}
+
+// processLine processes an output line of the run: until the testing package
+// reports a failure (--- FAIL:) on the standard output, the line is kept as one
+// of the most recent lines, and afterwards as part of the failure report.
+func (fp *fuzzOutputProcessor) processLine(line outputLine) {
+	fp.handleLine(line)
+
+	if fp.failure != nil {
+		fp.processFailureLine(line)
+		return
+	}
+
+	fp.keepTail(line)
 
-		// Read and store the input data associated with the failing
-		// target and ID.
-		var err error
-		failingInputString, err = fp.readFailingInput(target, id)
-		if err != nil {
-			return nil,
-				fmt.Errorf("processing fuzz stream: %w", err)
+	// Detect the start of a failure section. A test binary that timed
+	// out panics without reporting a failure first.
+	if line.stream == streamStdout &&
+		strings.Contains(line.text, "--- FAIL:") {
+
+		fp.failure = &failureReport{}
+	}
+	if line.stream == streamStderr &&
+		strings.HasPrefix(line.text, testTimeoutMarker) {
+
+		fp.failure = &failureReport{}
+		fp.processFailureLine(line)
+	}
+}
+
+// handleLine logs and archives an output line, with its secrets redacted, and
+// records it as progress of the run, in its metrics and, after a hang, as part
+// of its dump.
+func (fp *fuzzOutputProcessor) handleLine(line outputLine) {
+	text, _ := fp.redactor.redact(line.text)
+	fp.logger.Log(context.Background(), fp.outputLevel, "Fuzzer output",
+		"stream", line.stream, "message", text)
+	if fp.archive != nil {
+		_, _ = io.WriteString(fp.archive, text+"\n")
+	}
+
+	if fp.metrics != nil {
+		fp.metrics.observe(line.text)
+	}
+
+	if fp.watchdog != nil {
+		fp.watchdog.observe(line.text, time.Now())
+
+		if _, hung := fp.watchdog.hung(); hung {
+			if fp.dump == nil {
+				fp.dump = append([]outputLine{}, fp.tail...)
+			}
+			if fp.dumpBytes+len(line.text) < maxDumpBytes {
+				fp.dump = append(fp.dump, line)
+				fp.dumpBytes += len(line.text) + 1
+			}
 		}
 	}
+}
+
+// keepTail records the line as one of the most recent output lines.
+func (fp *fuzzOutputProcessor) keepTail(line outputLine) {
+	if len(fp.tail) == maxTailLines {
+		fp.tail = fp.tail[1:]
+	}
+	fp.tail = append(fp.tail, line)
+}
+
+// hangOutput returns the output of the run around its hang, on the standard
+// output and the standard error: the lines preceding it and the goroutine dump
+// following it.
+func (fp *fuzzOutputProcessor) hangOutput() (string, string) {
+	if fp.dump == nil {
+		return fp.recentOutput()
+	}
+
+	return joinLines(fp.dump)
+}
+
+// recentOutput returns the most recent output lines on the standard output and
+// the standard error.
+func (fp *fuzzOutputProcessor) recentOutput() (string, string) {
+	return joinLines(fp.tail)
+}
+
+// processFailureLine processes an output line following a failure reported by
+// the testing package. It collects the line in the failure report, extracts the
+// location of the first error for deduplication and attempts to read the
+// failing input data (if available). The crash is classified along the way.
+func (fp *fuzzOutputProcessor) processFailureLine(line outputLine) {
+	fr := fp.failure
+
+	// Write the current line to the failure log of its stream.
+	if line.stream == streamStderr {
+		fr.stderr.WriteString(line.text + "\n")
+	} else {
+		fr.stdout.WriteString(line.text + "\n")
+	}
+
+	// Collect the signs of the kind of the crash.
+	fr.classifier.observe(line.text)
+	fr.stacks[line.stream].observe(line.text)
+
+	// fileLine stores the .go file and line where the first error
+	// occurred, which is used for deduplication.
+	if fr.fileLine == "" {
+		fr.fileLine = parseFileAndLine(line.text)
+	}
+
+	// If error data has already been captured, skip further extraction.
+	if fr.input != "" {
+		return
+	}
+
+	// Parse the line to extract the fuzz target and ID (hex) of the
+	// failing input.
+	// When a fuzz target encounters a failure during f.Add, the crash is
+	// printed, but no input is saved to testdata/fuzz.
+	//
+	// The log output typically appears as:
+	//   failure while testing seed corpus entry: FuzzFoo/seed#0
+	//
+	// As a result, no error data will be printed.
+	target, id := parseFailureLine(line.text)
+	// If either target or ID is empty, skip further processing.
+	if target == "" || id == "" {
+		return
+	}
+
+	// Read and store the input data associated with the failing target
+	// and ID.
+	input, err := fp.readFailingInput(target, id)
+	if err != nil {
+		fp.err = err
+		return
+	}
+	fr.input = input
+	fr.inputFile = filepath.Join(fp.corpusDir, target, id)
+}
+
+// crash returns the crash described by the failure report.
+func (fr *failureReport) crash() *fuzzCrash {
+	kind, detail := fr.classifier.classify()
+
+	// Worker crashes are reported on the standard output, crashes of the
+	// test process itself on the standard error.
+	stack := fr.stacks[streamStdout].frames
+	if len(stack) == 0 {
+		stack = fr.stacks[streamStderr].frames
+	}
 
-	// Send all captured fuzz crash data to notify the caller.
 	return &fuzzCrash{
-		errorLogs:          failingLog,
-		failingInput:       failingInputString,
-		failureFileAndLine: failingFileLine,
-	}, nil
+		kind:               kind,
+		detail:             detail,
+		errorLogs:          fr.stdout.String(),
+		stderrLogs:         fr.stderr.String(),
+		failingInput:       fr.input,
+		failingInputFile:   fr.inputFile,
+		failureFileAndLine: fr.fileLine,
+		stack:              stack,
+	}
 }
 
 // parseFileAndLine attempts to extract stack-trace line indicating a fuzzing
@@ -225,18 +562,31 @@ func parseFailureLine(line string) (string, string) {
 
 // parseIssueBody extracts and returns the content of the "## Failing testcase"
 // section from the issue body. This section contains the input that caused a
-// crash in the given fuzz target.
-func parseIssueBody(body string) (string, error) {
+// crash in the given fuzz target, encoded with formatInput, or verbatim in the
+// issues reported before inputs were encoded.
+func parseIssueBody(body string) (issueInput, error) {
+	const heading = "## Failing testcase\n"
+
+	_, section, ok := strings.Cut(body, heading)
+	if !ok {
+		return issueInput{}, fmt.Errorf("failing testcase section " +
+			"not found")
+	}
+	if strings.HasPrefix(section, "<!-- input ") {
+		return parseInput(section)
+	}
+
 	// failingInputRegex matches an issue body and captures the text inside
 	// the "## Failing testcase" section.
 	failingInputRegex := regexp.MustCompile(
 		`(?s)## Failing testcase\n~~~sh\n(.*?)\n~~~`)
 	match := failingInputRegex.FindStringSubmatch(body)
 	if len(match) < 2 {
-		return "", fmt.Errorf("failing testcase section not found")
+		return issueInput{}, fmt.Errorf("failing testcase section " +
+			"not found")
 	}
 
-	return match[1], nil
+	return issueInput{data: match[1]}, nil
 }
 
 // readFailingInput attempts to read the failing input file from the corpus
@@ -1,12 +1,48 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"log/slog"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// muxOutput returns the output stream of a run that wrote the text of the given
+// chunks to their streams in order, multiplexed in the stdcopy framing.
+func muxOutput(t *testing.T, chunks ...outputLine) io.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, chunk := range chunks {
+		streamType := stdcopy.Stdout
+		if chunk.stream == streamStderr {
+			streamType = stdcopy.Stderr
+		}
+
+		_, err := stdcopy.NewStdWriter(&buf, streamType).Write(
+			[]byte(chunk.text))
+		require.NoError(t, err)
+	}
+
+	return &buf
+}
+
+// stdoutOutput returns the output stream of a run that wrote text to its
+// standard output only.
+func stdoutOutput(t *testing.T, text string) io.Reader {
+	t.Helper()
+
+	return muxOutput(t, outputLine{stream: streamStdout, text: text})
+}
+
 // TestParseFileAndLine verifies that parseFileAndLine correctly extracts
 // the .go file and line where error occurs from various fuzzing log formats.
 func TestParseFileAndLine(t *testing.T) {
@@ -163,6 +199,13 @@ func TestParseIssueBody(t *testing.T) {
 			expectedInput: seedCorpusErrMsg,
 			expectErrMsg:  "",
 		},
+		{
+			name: "encoded input",
+			body: "## Error logs\n" + formatCrashReport("", "",
+				"go test fuzz v1\nstring(\"~~~\")\n"),
+			expectedInput: "go test fuzz v1\nstring(\"~~~\")\n",
+			expectErrMsg:  "",
+		},
 		{
 			name:          "missing section",
 			body:          "No failing testcase section",
@@ -181,7 +224,224 @@ func TestParseIssueBody(t *testing.T) {
 			}
 
 			assert.NoError(t, err)
-			assert.Equal(t, tt.expectedInput, got)
+			assert.Equal(t, tt.expectedInput, got.data)
+		})
+	}
+}
+
+// TestProcessFuzzStream verifies that a crash is captured from the fuzzing
+// output together with its kind, the failing input, the file the fuzzer wrote
+// it to and its signature, and that seed corpus failures have no failing input
+// file.
+func TestProcessFuzzStream(t *testing.T) {
+	tests := []struct {
+		name              string
+		output            string
+		expectedKind      crashKind
+		expectedDetail    string
+		expectedInput     string
+		expectedInputFile string
+	}{
+		{
+			name: "failing input written",
+			output: "--- FAIL: FuzzFoo (0.01s)\n" +
+				"    stringutils_test.go:17: invalid\n" +
+				"    Failing input written to testdata/fuzz/" +
+				"FuzzFoo/771e938e4458e983\n",
+			expectedKind: crashKindTestFailure,
+			expectedInput: "go test fuzz v1\n" +
+				"string(\"0\")\n",
+			expectedInputFile: filepath.Join("testdata", "FuzzFoo",
+				"771e938e4458e983"),
+		},
+		{
+			name: "seed corpus entry",
+			output: "--- FAIL: FuzzFoo (0.01s)\n" +
+				"    failure while testing seed corpus " +
+				"entry: FuzzFoo/seed#0\n" +
+				"    stringutils_test.go:17: invalid\n",
+			expectedKind:   crashKindSeedCorpus,
+			expectedDetail: "seed#0: test-failure",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard,
+				nil))
+			processor := NewFuzzOutputProcessor(logger, "testdata")
+
+			crash, err := processor.processFuzzStream(
+				stdoutOutput(t, tt.output))
+			assert.NoError(t, err)
+			assert.NotNil(t, crash)
+
+			assert.Equal(t, tt.expectedKind, crash.kind)
+			assert.Equal(t, tt.expectedDetail, crash.detail)
+			assert.Equal(t, tt.expectedInput, crash.failingInput)
+			assert.Equal(t, tt.expectedInputFile,
+				crash.failingInputFile)
+			assert.Equal(t, ComputeSHA256Short(
+				string(tt.expectedKind)+
+					":stringutils_test.go:17"),
+				crash.signature(SignatureOptions{Depth: 3}))
+		})
+	}
+}
+
+// TestProcessFuzzStreamStreams verifies that only failures reported on the
+// standard output start a crash, that the output of the two streams is kept
+// apart in the crash, and that lines split across frames are reassembled.
+func TestProcessFuzzStreamStreams(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	processor := NewFuzzOutputProcessor(logger, "testdata")
+
+	crash, err := processor.processFuzzStream(muxOutput(t,
+		outputLine{stream: streamStderr, text: "fuzz: elapsed: 3s\r\n"},
+		outputLine{stream: streamStderr, text: "--- FAIL: echoed\n"},
+		outputLine{stream: streamStdout, text: "--- FAIL: FuzzFoo\n"},
+		outputLine{stream: streamStdout, text: "    stringutils_"},
+		outputLine{stream: streamStderr, text: "panic: boom\n"},
+		outputLine{stream: streamStdout, text: "test.go:17: invalid\n"},
+		outputLine{stream: streamStderr, text: "exit status 2"}))
+	require.NoError(t, err)
+	require.NotNil(t, crash)
+
+	assert.Equal(t, "    stringutils_test.go:17: invalid\n",
+		crash.errorLogs)
+	assert.Equal(t, "panic: boom\nexit status 2\n", crash.stderrLogs)
+	assert.Equal(t, "stringutils_test.go:17", crash.failureFileAndLine)
+
+	stdout, stderr := processor.recentOutput()
+	assert.Equal(t, "--- FAIL: FuzzFoo\n", stdout)
+	assert.Equal(t, "fuzz: elapsed: 3s\n--- FAIL: echoed\n", stderr)
+}
+
+// TestProcessOutput verifies that the output a run wrote to files is processed
+// as a stream, with the standard error following the failure reported on the
+// standard output, and that a test binary that timed out is reported as a hang
+// without a failure of the testing package.
+func TestProcessOutput(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	processor := NewFuzzOutputProcessor(logger, "testdata")
+	crash, err := processor.processOutput(strings.NewReader(
+		"    --- FAIL: FuzzFoo/abc (0.00s)\n"), strings.NewReader(
+		"panic: boom [recovered]\ngoroutine 7 [running]:\n"))
+	require.NoError(t, err)
+	require.NotNil(t, crash)
+	assert.Equal(t, crashKindPanic, crash.kind)
+	assert.Equal(t, "panic: boom [recovered]\ngoroutine 7 [running]:\n",
+		crash.stderrLogs)
+
+	processor = NewFuzzOutputProcessor(logger, "testdata")
+	crash, err = processor.processOutput(strings.NewReader(""),
+		strings.NewReader("panic: test timed out after 3s\n"+
+			"goroutine 8 [running]:\n"))
+	require.NoError(t, err)
+	require.NotNil(t, crash)
+	assert.Equal(t, crashKindHang, crash.kind)
+	assert.Contains(t, crash.stderrLogs, "test timed out")
+
+	processor = NewFuzzOutputProcessor(logger, "testdata")
+	crash, err = processor.processOutput(strings.NewReader("PASS\n"),
+		strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Nil(t, crash)
+}
+
+// TestProcessFuzzStreamOutOfMemory verifies that a fuzz target crashing on a
+// failed allocation is classified as out of memory, with a signature distinct
+// from a plain failure at the same location, and that the processor keeps the
+// most recent output lines.
+func TestProcessFuzzStreamOutOfMemory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	processor := NewFuzzOutputProcessor(logger, "testdata")
+
+	var output strings.Builder
+	for i := range maxTailLines + 5 {
+		fmt.Fprintf(&output, "fuzz: elapsed: %ds\n", i)
+	}
+	output.WriteString("--- FAIL: FuzzFoo (0.01s)\n" +
+		"    fatal error: runtime: out of memory\n" +
+		"    stringutils_test.go:17\n")
+
+	crash, err := processor.processFuzzStream(
+		stdoutOutput(t, output.String()))
+	require.NoError(t, err)
+	require.NotNil(t, crash)
+
+	assert.Equal(t, crashKindOOM, crash.kind)
+	assert.NotEqual(t, ComputeSHA256Short("stringutils_test.go:17"),
+		crash.signature(SignatureOptions{Depth: 3}))
+
+	stdout, stderr := processor.recentOutput()
+	assert.Empty(t, stderr)
+	tail := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	assert.Len(t, tail, maxTailLines)
+	assert.Equal(t, "--- FAIL: FuzzFoo (0.01s)", tail[len(tail)-1])
+}
+
+// TestProcessFuzzStreamHang verifies that a fuzz worker reported as hung is
+// classified as a hang unless it printed a panic or fatal error, and that the
+// output following a detected hang is kept as its goroutine dump.
+func TestProcessFuzzStreamHang(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name   string
+		output string
+		kind   crashKind
+	}{
+		{
+			name: "hung worker",
+			output: "--- FAIL: FuzzFoo (65.00s)\n" +
+				"    fuzzing process hung or terminated " +
+				"unexpectedly: exit status 2\n",
+			kind: crashKindHang,
+		},
+		{
+			name: "crashed worker",
+			output: "--- FAIL: FuzzFoo (0.01s)\n" +
+				"    fuzzing process hung or terminated " +
+				"unexpectedly: exit status 2\n" +
+				"    panic: boom\n" +
+				"    stringutils_test.go:17\n",
+			kind: crashKindPanic,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewFuzzOutputProcessor(logger, "testdata")
+			crash, err := processor.processFuzzStream(
+				stdoutOutput(t, tt.output))
+			require.NoError(t, err)
+			require.NotNil(t, crash)
+			assert.Equal(t, tt.kind, crash.kind)
 		})
 	}
+
+	t.Run("goroutine dump", func(t *testing.T) {
+		start := time.Now()
+		processor := NewFuzzOutputProcessor(logger, "testdata")
+		processor.watchdog = newProgressWatchdog(HangLimits{
+			ProgressTimeout: time.Minute,
+		}, start)
+		require.True(t, processor.watchdog.check(
+			start.Add(time.Minute)))
+
+		crash, err := processor.processFuzzStream(muxOutput(t,
+			outputLine{stream: streamStdout, text: "=== RUN\n"},
+			outputLine{stream: streamStderr, text: "SIGQUIT: " +
+				"quit\ngoroutine 1 [chan receive]:\n" +
+				"main.FuzzFoo.func1(...)\n"}))
+		require.NoError(t, err)
+		assert.Nil(t, crash)
+
+		stdout, stderr := processor.hangOutput()
+		assert.Equal(t, "=== RUN\n", stdout)
+		assert.Equal(t, "SIGQUIT: quit\ngoroutine 1 [chan receive]:\n"+
+			"main.FuzzFoo.func1(...)\n", stderr)
+	})
 }
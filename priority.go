@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	// ScheduleFilename is the name of the file, inside the report
+	// directory, that records when each target was last fuzzed.
+	ScheduleFilename = "schedule.json"
+
+	// maxStalenessDays caps the number of days since a target was last
+	// fuzzed used in its priority, so that targets that were never fuzzed
+	// do not dwarf every other factor.
+	maxStalenessDays = 30
+)
+
+// targetKey returns the key identifying a fuzz target of a package across
+// cycles, in the form "<pkg>/<target>".
+func targetKey(pkg, target string) string {
+	return path.Join(pkg, target)
+}
+
+// scheduleKey returns the key of the scheduling history of a task. In a fuzzing
+// matrix, every Go version of a target is scheduled, and its metrics kept, on
+// its own, under "<pkg>/<target>@go<version>".
+func scheduleKey(task Task, perVersion bool) string {
+	key := targetKey(task.Package.Path, task.Target)
+	if !perVersion || task.GoVersion == "" {
+		return key
+	}
+
+	return key + "@go" + task.GoVersion
+}
+
+// TargetSchedule records the scheduling history of a fuzz target, and the
+// metrics of its runs in the cycle it was last fuzzed, if they showed
+// progress.
+type TargetSchedule struct {
+	LastFuzzed  time.Time
+	LastMetrics *RunMetrics `json:",omitempty"`
+}
+
+// priorityFactors holds the inputs the priority of a task is computed from.
+type priorityFactors struct {
+	// Weight is the configured weight of the target.
+	Weight float64
+
+	// DaysSinceFuzzed is the number of days since the target was last
+	// fuzzed, capped at maxStalenessDays.
+	DaysSinceFuzzed float64
+
+	// Changed reports whether the target's package changed since the
+	// target was last fuzzed.
+	Changed bool
+
+	// OpenIssue reports whether an issue is open for a crash of the
+	// target.
+	OpenIssue bool
+
+	// Discovering reports whether the target found new interesting inputs
+	// the last time it was fuzzed, so that it is likely to find more.
+	Discovering bool
+}
+
+// computePriority combines the priority factors of a task using the configured
+// weights. Higher values are scheduled first.
+func computePriority(fuzz *Fuzz, f priorityFactors) float64 {
+	score := 1 + fuzz.StalenessWeight*f.DaysSinceFuzzed
+	if f.Changed {
+		score += fuzz.ChangeWeight
+	}
+	if f.OpenIssue {
+		score += fuzz.OpenIssueWeight
+	}
+	if f.Discovering {
+		score += fuzz.DiscoveryWeight
+	}
+
+	return f.Weight * score
+}
+
+// targetWeight returns the configured weight of the given target, which
+// defaults to 1.
+func targetWeight(fuzz *Fuzz, pkg, target string) float64 {
+	if weight, ok := fuzz.TargetWeights[targetKey(pkg, target)]; ok {
+		return weight
+	}
+
+	return 1
+}
+
+// scheduleTracker keeps track of when each target was last fuzzed and persists
+// this information in the report directory, so that it survives across cycles
+// and is uploaded along with the reports. With perVersion, the Go versions of
+// a target are tracked apart.
+type scheduleTracker struct {
+	mu         sync.Mutex
+	path       string
+	perVersion bool
+	schedules  map[string]TargetSchedule
+}
+
+// loadScheduleTracker loads the scheduling history from the report directory,
+// tracking the Go versions of a target apart if perVersion is set. A missing
+// file yields an empty history.
+func loadScheduleTracker(reportDir string,
+	perVersion bool) (*scheduleTracker, error) {
+
+	t := &scheduleTracker{
+		path:       filepath.Join(reportDir, ScheduleFilename),
+		perVersion: perVersion,
+		schedules:  make(map[string]TargetSchedule),
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return t, nil
+		}
+		return nil, fmt.Errorf("failed to read schedule file %q: %w",
+			t.path, err)
+	}
+
+	if err := json.Unmarshal(data, &t.schedules); err != nil {
+		return nil, fmt.Errorf("invalid JSON in schedule file %q: %w",
+			t.path, err)
+	}
+
+	return t, nil
+}
+
+// schedule returns the scheduling history of the task. A Go version of a
+// target not yet tracked on its own falls back to the history of the target,
+// recorded before the fuzzing matrix was set up. The caller must hold t.mu.
+func (t *scheduleTracker) schedule(task Task) TargetSchedule {
+	if schedule, ok := t.schedules[scheduleKey(task, t.perVersion)]; ok {
+		return schedule
+	}
+
+	return t.schedules[scheduleKey(task, false)]
+}
+
+// lastMetrics returns the metrics of the runs of the given task in the cycle it
+// was last fuzzed, and whether they are known.
+func (t *scheduleTracker) lastMetrics(task Task) (RunMetrics, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	metrics := t.schedule(task).LastMetrics
+	if metrics == nil {
+		return RunMetrics{}, false
+	}
+
+	return *metrics, true
+}
+
+// lastFuzzed returns when the given task was last fuzzed, or the zero time if
+// it never was.
+func (t *scheduleTracker) lastFuzzed(task Task) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.schedule(task).LastFuzzed
+}
+
+// markFuzzed records that the given task has just been fuzzed with the given
+// metrics and persists the scheduling history.
+func (t *scheduleTracker) markFuzzed(task Task, metrics RunMetrics) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := scheduleKey(task, t.perVersion)
+	schedule := t.schedules[key]
+	schedule.LastFuzzed = time.Now()
+	schedule.LastMetrics = nil
+	if metrics.Runs > 0 {
+		schedule.LastMetrics = &metrics
+	}
+	t.schedules[key] = schedule
+
+	data, err := json.MarshalIndent(t.schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize schedule: %w", err)
+	}
+
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedule file %q: %w",
+			t.path, err)
+	}
+
+	return nil
+}
+
+// packageChangedSince reports whether any commit reachable from HEAD and made
+// after since touched a file of the given package directory.
+func packageChangedSince(repo *git.Repository, pkg string,
+	since time.Time) (bool, error) {
+
+	prefix := pkg + "/"
+	if pkg == "." {
+		prefix = ""
+	}
+
+	commits, err := repo.Log(&git.LogOptions{
+		Since: &since,
+		PathFilter: func(p string) bool {
+			return strings.HasPrefix(p, prefix)
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("reading git log: %w", err)
+	}
+	defer commits.Close()
+
+	_, err = commits.Next()
+	switch {
+	case err == nil:
+		return true, nil
+
+	case errors.Is(err, io.EOF):
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("iterating git log: %w", err)
+	}
+}
+
+// hasOpenIssue reports whether any of the given open issue titles belongs to a
+// crash of the given target.
+func hasOpenIssue(titles []string, pkg, target string) bool {
+	needle := fmt.Sprintf("Fuzzing crash in %s", targetKey(pkg, target))
+	for _, title := range titles {
+		_, rest, found := strings.Cut(title, needle)
+		if found && (rest == "" || strings.HasPrefix(rest, " [")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prioritizeTasks computes the priority factors of every task from the
+// scheduling history, the project's git history and the open crash issues.
+// Failures to read the git history or the issues are logged and the affected
+// factors are left unset, since prioritization is best-effort.
+func prioritizeTasks(logger *slog.Logger, cfg *Config, tasks []Task,
+	tracker *scheduleTracker, gh *GitHubRepo) []priorityFactors {
+
+	now := time.Now()
+
+	repo, err := git.PlainOpen(cfg.Project.SrcDir)
+	if err != nil {
+		logger.Warn("Failed to open project repository; ignoring "+
+			"recent changes in task priorities", "error", err)
+	}
+
+	titles, err := gh.listOpenCrashIssueTitles()
+	if err != nil {
+		logger.Warn("Failed to list open crash issues; ignoring "+
+			"issue status in task priorities", "error", err)
+	}
+
+	// Cache the change status per package and last fuzzed time, since
+	// walking the git history is comparatively expensive.
+	type changeKey struct {
+		pkg   string
+		since time.Time
+	}
+	changed := make(map[changeKey]bool)
+
+	factors := make([]priorityFactors, len(tasks))
+	for i, task := range tasks {
+		pkg, target := task.Package.Path, task.Target
+
+		f := priorityFactors{
+			Weight:          targetWeight(&cfg.Fuzz, pkg, target),
+			DaysSinceFuzzed: maxStalenessDays,
+			OpenIssue:       hasOpenIssue(titles, pkg, target),
+		}
+
+		metrics, ok := tracker.lastMetrics(task)
+		f.Discovering = ok && metrics.Final.NewInteresting > 0
+
+		lastFuzzed := tracker.lastFuzzed(task)
+		if !lastFuzzed.IsZero() {
+			days := now.Sub(lastFuzzed).Hours() / 24
+			f.DaysSinceFuzzed = min(days, maxStalenessDays)
+
+			key := changeKey{pkg, lastFuzzed}
+			c, ok := changed[key]
+			if !ok && repo != nil {
+				c, err = packageChangedSince(repo, pkg,
+					lastFuzzed)
+				if err != nil {
+					logger.Warn("Failed to check package "+
+						"changes", "package", pkg,
+						"error", err)
+				}
+				changed[key] = c
+			}
+			f.Changed = c
+		}
+
+		factors[i] = f
+	}
+
+	return factors
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTaskQueueOrdering verifies that the task queue dequeues tasks by
+// descending priority, keeps FIFO order for equal priorities, lets waiting
+// tasks age ahead of tasks with a slightly higher priority that started
+// waiting later, and ages tasks from when they started waiting.
+func TestTaskQueueOrdering(t *testing.T) {
+	task := func(target string) Task {
+		return Task{Package: GoPackage{Path: "pkg"}, Target: target}
+	}
+
+	now := time.Now()
+	q := NewTaskQueue(1)
+	q.Enqueue(task("FuzzLow"), 1, time.Time{})
+	q.Enqueue(task("FuzzHigh"), 5, time.Time{})
+	q.Enqueue(task("FuzzTieFirst"), 3, time.Time{})
+	q.Enqueue(task("FuzzTieSecond"), 3, now.Add(time.Hour))
+
+	// Pretend the queue was created two hours ago: a task enqueued now
+	// with priority 2.5 must come after the task of priority 1 that has
+	// been aging since the queue was created.
+	q.created = q.created.Add(-2 * time.Hour)
+	q.Enqueue(task("FuzzLate"), 2.5, time.Time{})
+
+	// A target last fuzzed three days ago has been waiting 72 hours, and
+	// ages ahead of all the tasks enqueued at the same time.
+	q.Enqueue(task("FuzzStale"), 0.5, now.Add(-72*time.Hour))
+
+	ordered, priorities := q.Ordering()
+	assert.Equal(t, []float64{0.5, 5, 3, 3, 1, 2.5}, priorities)
+	assert.Equal(t, 6, q.Length(), "Ordering must not modify the queue")
+
+	var targets []string
+	for {
+		task, ok := q.Dequeue()
+		if !ok {
+			break
+		}
+		targets = append(targets, task.Target)
+	}
+
+	expected := []string{"FuzzStale", "FuzzHigh", "FuzzTieFirst",
+		"FuzzTieSecond", "FuzzLow", "FuzzLate"}
+	assert.Equal(t, expected, targets)
+	for i, task := range ordered {
+		assert.Equal(t, expected[i], task.Target)
+	}
+}
+
+// TestComputePriority verifies how the priority factors are combined with the
+// configured weights.
+func TestComputePriority(t *testing.T) {
+	fuzz := &Fuzz{
+		StalenessWeight: 1,
+		ChangeWeight:    2,
+		OpenIssueWeight: -1,
+		DiscoveryWeight: 1,
+	}
+
+	tests := []struct {
+		name     string
+		factors  priorityFactors
+		expected float64
+	}{
+		{
+			name:     "recently fuzzed",
+			factors:  priorityFactors{Weight: 1},
+			expected: 1,
+		},
+		{
+			name: "stale and changed",
+			factors: priorityFactors{
+				Weight:          1,
+				DaysSinceFuzzed: 3,
+				Changed:         true,
+			},
+			expected: 6,
+		},
+		{
+			name: "weighted with open issue",
+			factors: priorityFactors{
+				Weight:          2,
+				DaysSinceFuzzed: 1,
+				OpenIssue:       true,
+			},
+			expected: 2,
+		},
+		{
+			name: "still discovering",
+			factors: priorityFactors{
+				Weight:      1,
+				Discovering: true,
+			},
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected,
+				computePriority(fuzz, tt.factors))
+		})
+	}
+}
+
+// TestScheduleTracker verifies that the Go versions of a target are tracked
+// apart in a fuzzing matrix, falling back to the history of the target
+// recorded before the matrix was set up, and that the history persists.
+func TestScheduleTracker(t *testing.T) {
+	dir := t.TempDir()
+	task := Task{Package: GoPackage{Path: "pkg"}, Target: "FuzzFoo"}
+	newer, older := task, task
+	newer.GoVersion, older.GoVersion = "1.24.6", "1.23.12"
+
+	tracker, err := loadScheduleTracker(dir, false)
+	require.NoError(t, err)
+	require.NoError(t, tracker.markFuzzed(task, RunMetrics{
+		Runs: 1, Final: FuzzStats{NewInteresting: 3}}))
+
+	tracker, err = loadScheduleTracker(dir, true)
+	require.NoError(t, err)
+	legacy := tracker.lastFuzzed(newer)
+	assert.False(t, legacy.IsZero())
+	assert.Equal(t, legacy, tracker.lastFuzzed(older))
+
+	require.NoError(t, tracker.markFuzzed(newer, RunMetrics{}))
+	_, ok := tracker.lastMetrics(newer)
+	assert.False(t, ok)
+
+	metrics, ok := tracker.lastMetrics(older)
+	require.True(t, ok)
+	assert.EqualValues(t, 3, metrics.Final.NewInteresting)
+
+	tracker, err = loadScheduleTracker(dir, true)
+	require.NoError(t, err)
+	assert.True(t, tracker.lastFuzzed(newer).After(legacy))
+	assert.Equal(t, legacy, tracker.lastFuzzed(older))
+}
+
+// TestHasOpenIssue verifies that open issue titles are matched to their exact
+// fuzz target.
+func TestHasOpenIssue(t *testing.T) {
+	titles := []string{
+		"[fuzz/cfec419a119b189c] Fuzzing crash in parser/FuzzFooBar",
+		"[fuzz/0123456789abcdef] Fuzzing crash in tree/FuzzTree " +
+			"[go1.24.6]",
+	}
+
+	assert.True(t, hasOpenIssue(titles, "parser", "FuzzFooBar"))
+	assert.False(t, hasOpenIssue(titles, "parser", "FuzzFoo"))
+	assert.True(t, hasOpenIssue(titles, "tree", "FuzzTree"))
+	assert.False(t, hasOpenIssue(titles, "stringutils", "FuzzTree"))
+}
+
+// TestTimePool verifies that unused fuzzing time is split evenly between the
+// tasks still to run, the last one taking whatever is left.
+func TestTimePool(t *testing.T) {
+	var pool timePool
+	assert.Zero(t, pool.take(3))
+
+	pool.deposit(90 * time.Second)
+	pool.deposit(30 * time.Second)
+
+	assert.Equal(t, 30*time.Second, pool.take(3))
+	assert.Equal(t, 30*time.Second, pool.take(2))
+	assert.Equal(t, 30*time.Second, pool.take(1))
+	assert.Equal(t, 30*time.Second, pool.take(0))
+	assert.Zero(t, pool.take(0))
+}
@@ -8,30 +8,233 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // MasterEntry represents an entry in the master index HTML file.
 type MasterEntry struct {
-	PkgPath  string
-	Target   string
-	LinkFile string
+	ModuleDir string
+	PkgPath   string
+	Target    string
+	LinkFile  string
 }
 
-// TargetHistory stores the historical coverage data for a fuzzing target.
+// TargetHistory stores the historical coverage data for a fuzzing target, and
+// the run logs and metrics of the target's runs in the cycles of that date.
 type TargetHistory struct {
 	Date       string
 	Coverage   string
 	ReportPath string
+	Logs       []RunLogLink   `json:",omitempty"`
+	Metrics    []CycleMetrics `json:",omitempty"`
 }
 
-// TargetState keeps track of registered fuzzing targets.
+// TargetState keeps track of registered fuzzing targets. PkgPath is relative
+// to the project root, so it already identifies the module the package belongs
+// to; ModuleDir is only recorded for packages of nested modules.
 type TargetState struct {
-	PkgPath string
-	Target  string
+	PkgPath   string
+	Target    string
+	ModuleDir string `json:",omitempty"`
+}
+
+// newTargetState returns the master state entry for a target of the given
+// package.
+func newTargetState(pkg GoPackage, target string) TargetState {
+	state := TargetState{PkgPath: pkg.Path, Target: target}
+	if pkg.ModuleDir != rootModuleDir {
+		state.ModuleDir = pkg.ModuleDir
+	}
+
+	return state
+}
+
+const (
+	// CycleReportDir is the directory, inside the report directory, where
+	// the report of each fuzzing cycle is stored.
+	CycleReportDir = "cycles"
+
+	// cycleIDLayout is the time layout of the IDs of the fuzzing cycles,
+	// which are the UTC start times of the cycles.
+	cycleIDLayout = "2006-01-02T15-04-05Z"
+)
+
+// QueuedTarget describes a task of a fuzzing cycle, the factors its priority
+// was computed from and the metrics of its runs in the cycle it was last
+// fuzzed, if known.
+type QueuedTarget struct {
+	PkgPath         string
+	Target          string
+	GoVersion       string `json:",omitempty"`
+	Priority        float64
+	Weight          float64
+	DaysSinceFuzzed float64
+	Changed         bool
+	OpenIssue       bool
+	Discovering     bool
+	LastMetrics     *RunMetrics `json:",omitempty"`
+}
+
+// FailedTarget describes a task of a fuzzing cycle that permanently failed.
+type FailedTarget struct {
+	PkgPath   string
+	Target    string
+	GoVersion string `json:",omitempty"`
+	Error     string
+}
+
+// TargetMetrics holds the metrics of the runs of a fuzz target in a fuzzing
+// cycle.
+type TargetMetrics struct {
+	PkgPath   string
+	Target    string
+	GoVersion string `json:",omitempty"`
+
+	RunMetrics
+}
+
+// TargetCrashes lists the signatures of the distinct crashes found in a fuzz
+// target during a fuzzing cycle.
+type TargetCrashes struct {
+	PkgPath    string
+	Target     string
+	GoVersion  string `json:",omitempty"`
+	Signatures []string
+}
+
+// CycleReport summarizes a single fuzzing cycle, including the order in which
+// its tasks were scheduled, the crashes they found, the tasks that permanently
+// failed and the metrics of the tasks' runs.
+type CycleReport struct {
+	mu sync.Mutex
+
+	CycleID       string
+	StartTime     time.Time
+	EndTime       time.Time
+	TaskOrder     []QueuedTarget
+	Crashes       []TargetCrashes
+	FailedTargets []FailedTarget
+	Metrics       []TargetMetrics
+
+	// redactor removes the secrets from the errors of failed tasks.
+	redactor *redactor
+}
+
+// addMetrics adds the metrics of a run of the given task to those of its other
+// runs in the cycle. Runs that showed no progress are ignored. It is safe for
+// concurrent use.
+func (c *CycleReport) addMetrics(task Task, metrics RunMetrics) {
+	if metrics.Runs == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.Metrics {
+		m := &c.Metrics[i]
+		if m.PkgPath == task.Package.Path && m.Target == task.Target &&
+			m.GoVersion == task.GoVersion {
+
+			m.add(metrics)
+			return
+		}
+	}
+
+	c.Metrics = append(c.Metrics, TargetMetrics{
+		PkgPath:    task.Package.Path,
+		Target:     task.Target,
+		GoVersion:  task.GoVersion,
+		RunMetrics: metrics,
+	})
+}
+
+// targetMetrics returns the metrics of the runs of the given task in the cycle.
+// It is safe for concurrent use.
+func (c *CycleReport) targetMetrics(task Task) RunMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range c.Metrics {
+		if m.PkgPath == task.Package.Path && m.Target == task.Target &&
+			m.GoVersion == task.GoVersion {
+
+			return m.RunMetrics
+		}
+	}
+
+	return RunMetrics{}
+}
+
+// addCrashes records the signatures of the distinct crashes found by the given
+// task. It is safe for concurrent use.
+func (c *CycleReport) addCrashes(task Task, signatures []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Crashes = append(c.Crashes, TargetCrashes{
+		PkgPath:    task.Package.Path,
+		Target:     task.Target,
+		GoVersion:  task.GoVersion,
+		Signatures: signatures,
+	})
+}
+
+// addFailure records that the given task permanently failed with err, with its
+// secrets redacted. It is safe for concurrent use.
+func (c *CycleReport) addFailure(task Task, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msg, _ := c.redactor.redact(err.Error())
+	c.FailedTargets = append(c.FailedTargets, FailedTarget{
+		PkgPath:   task.Package.Path,
+		Target:    task.Target,
+		GoVersion: task.GoVersion,
+		Error:     msg,
+	})
+}
+
+// newCycleReport creates the report of a fuzzing cycle starting now, whose
+// errors are redacted with the given redactor.
+func newCycleReport(redactor *redactor) *CycleReport {
+	start := time.Now().UTC()
+	return &CycleReport{
+		CycleID:   start.Format(cycleIDLayout),
+		StartTime: start,
+		redactor:  redactor,
+	}
+}
+
+// save writes the cycle report as JSON to the cycles directory of reportDir,
+// recording the current time as the end of the cycle.
+func (c *CycleReport) save(reportDir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.EndTime = time.Now().UTC()
+
+	dir := filepath.Join(reportDir, CycleReportDir)
+	if err := EnsureDirExists(dir); err != nil {
+		return fmt.Errorf("create cycle report directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize cycle report: %w", err)
+	}
+
+	reportPath := filepath.Join(dir, c.CycleID+".json")
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cycle report %q: %w",
+			reportPath, err)
+	}
+
+	return nil
 }
 
 // TargetPkgReport holds all the state and configuration needed to generate,
@@ -45,6 +248,16 @@ type TargetPkgReport struct {
 	coverage       string
 	reportDir      string
 	reportHTMLPath string
+
+	// logs links the run logs of the target archived in this cycle, and
+	// logRetention is how long run logs are kept.
+	logs         []RunLogLink
+	logRetention time.Duration
+
+	// cycleID is the ID of the current cycle, and metrics are the metrics
+	// of the target's runs in it.
+	cycleID string
+	metrics RunMetrics
 }
 
 // loadMasterState loads the master state from a JSON file at the given path.
@@ -105,14 +318,17 @@ func addToMaster(projectName, reportDir string, newState []TargetState,
 			err)
 	}
 
-	// Check for new targets - skip if already present
+	// Check for new targets - skip if already present, but refresh the
+	// module of existing ones since a package may have moved into a nested
+	// module.
 	states := append([]TargetState{}, existState...)
 	for _, new := range newState {
 		duplicate := false
-		for _, exist := range existState {
+		for i, exist := range existState {
 			if new.PkgPath == exist.PkgPath &&
 				new.Target == exist.Target {
 
+				states[i].ModuleDir = new.ModuleDir
 				duplicate = true
 				break
 			}
@@ -139,7 +355,12 @@ func addToMaster(projectName, reportDir string, newState []TargetState,
 	for i, s := range states {
 		linkFile := filepath.Join("targets", s.PkgPath,
 			s.Target+".html")
-		entries[i] = MasterEntry{s.PkgPath, s.Target, linkFile}
+		moduleDir := s.ModuleDir
+		if moduleDir == "" {
+			moduleDir = rootModuleDir
+		}
+		entries[i] = MasterEntry{moduleDir, s.PkgPath, s.Target,
+			linkFile}
 	}
 
 	// Render master index template
@@ -167,7 +388,8 @@ func addToMaster(projectName, reportDir string, newState []TargetState,
 }
 
 // updateTarget updates the HTML report and JSON history file for a given
-// fuzzing target.
+// fuzzing target. The run logs and metrics of the cycle are recorded in the
+// entry of the current date, and links to expired run logs are dropped.
 func (r *TargetPkgReport) updateTarget() error {
 	// Build base filenames and paths
 	baseName := filepath.Join(r.pkg, r.target)
@@ -189,16 +411,30 @@ func (r *TargetPkgReport) updateTarget() error {
 
 	// Prepend a new entry only if there is no existing entry for the
 	// current date
-	if len(history) > 0 && history[0].Date == currentDate {
-		return nil
+	if len(history) == 0 || history[0].Date != currentDate {
+		newEntry := TargetHistory{
+			Date:       currentDate,
+			Coverage:   r.coverage,
+			ReportPath: r.reportHTMLPath,
+		}
+		history = append([]TargetHistory{newEntry}, history...)
+	}
+	history[0].Logs = append(history[0].Logs, r.logs...)
+	if r.metrics.Runs > 0 {
+		history[0].Metrics = append(history[0].Metrics, CycleMetrics{
+			Cycle:      r.cycleID,
+			RunMetrics: r.metrics,
+		})
 	}
 
-	newEntry := TargetHistory{
-		Date:       currentDate,
-		Coverage:   r.coverage,
-		ReportPath: r.reportHTMLPath,
+	now := time.Now()
+	for i := range history {
+		history[i].Logs = slices.DeleteFunc(history[i].Logs,
+			func(l RunLogLink) bool {
+				return expiredRunLog(l.Cycle, r.logRetention,
+					now)
+			})
 	}
-	history = append([]TargetHistory{newEntry}, history...)
 
 	// Save updated JSON history
 	historyData, err := json.MarshalIndent(history, "", "  ")
@@ -232,38 +468,21 @@ func (r *TargetPkgReport) updateTarget() error {
 	}{r.target, history})
 }
 
-// updateReport runs the fuzz target’s tests with coverage, generates an HTML
-// coverage report, and updates both the master index and the per-target history
-func updateReport(ctx context.Context, pkg, target string, cfg *Config,
-	logger *slog.Logger) error {
+// updateReport generates an HTML coverage report from the coverage profile of
+// the fuzz target's corpus at profilePath, and updates both the master index
+// and the per-target history with the coverage and the given metrics of the
+// target's runs in the cycle.
+func updateReport(ctx context.Context, task Task, cfg *Config, cycleID string,
+	profilePath string, metrics RunMetrics, logger *slog.Logger) error {
 
-	// Determine the package and corpus paths.
-	pkgPath := filepath.Join(cfg.Project.SrcDir, pkg)
-	corpusSrc := filepath.Join(cfg.Project.CorpusDir, pkg, "testdata",
-		"fuzz", target)
-	corpusDst := filepath.Join(pkgPath, "testdata", "fuzz", target)
+	pkg := task.Package.Path
+	target := task.Target
+	modulePath := task.Package.moduleRootPath(cfg.Project.SrcDir)
 
-	// Copy any existing corpus files into the testdata directory.
-	if err := copyData(corpusSrc, corpusDst); err != nil {
-		return fmt.Errorf("corpus copy failed: %w", err)
-	}
-
-	// Run `go test` for this target with coverage profiling enabled.
-	testCmd := []string{"test", fmt.Sprintf("-run=^%s$", target),
-		fmt.Sprintf("-coverprofile=%s.out", target), "-covermode=count"}
-	testOutput, err := runGoCommand(ctx, pkgPath, testCmd)
+	coveragePct, err := coverProfilePercent(profilePath)
 	if err != nil {
-		return fmt.Errorf("go test failed for %q: %w ", pkg, err)
-	}
-
-	// Parse the coverage percentage from the test output.
-	coverageRe := regexp.MustCompile(`coverage:\s+([\d.]+)%`)
-	matches := coverageRe.FindStringSubmatch(testOutput)
-	if len(matches) < 2 {
-		return fmt.Errorf("coverage not found in output:\n%s",
-			testOutput)
+		return err
 	}
-	coveragePct := matches[1]
 
 	// Generate an HTML coverage report using `go tool cover`.
 	targetReportDir := filepath.Join(cfg.Project.ReportDir, "targets",
@@ -276,11 +495,18 @@ func updateReport(ctx context.Context, pkg, target string, cfg *Config,
 	reportPath := filepath.Join(targetReportDir, htmlFileName)
 
 	coverCmd := []string{"tool", "cover",
-		fmt.Sprintf("-html=%s.out", target), "-o", reportPath}
-	if _, err := runGoCommand(ctx, pkgPath, coverCmd); err != nil {
+		"-html=" + profilePath, "-o", reportPath}
+	_, err = runGoCommand(ctx, modulePath, coverCmd,
+		goEnv(cfg, task.GoVersion)...)
+	if err != nil {
 		return fmt.Errorf("go tool cover failed for %q: %w ", pkg, err)
 	}
 
+	logs, err := targetRunLogs(cfg.Project.ReportDir, cycleID, pkg, target)
+	if err != nil {
+		return fmt.Errorf("listing run logs: %w", err)
+	}
+
 	covReport := &TargetPkgReport{
 		logger:         logger,
 		pkg:            pkg,
@@ -288,6 +514,10 @@ func updateReport(ctx context.Context, pkg, target string, cfg *Config,
 		coverage:       coveragePct,
 		reportDir:      cfg.Project.ReportDir,
 		reportHTMLPath: filepath.Join(target, htmlFileName),
+		logs:           logs,
+		logRetention:   cfg.Fuzz.LogRetention,
+		cycleID:        cycleID,
+		metrics:        metrics,
 	}
 
 	// Record this run in the target's history and regenerate its HTML.
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
+)
+
+// ResourceLimits describes the resources of a fuzzing container and the
+// number of fuzzing processes running in it.
+type ResourceLimits struct {
+	// MemoryBytes is the memory limit of the container, 0 meaning
+	// unlimited.
+	MemoryBytes int64
+
+	// CPUs is the number of CPUs the container may use.
+	CPUs float64
+
+	// PidsLimit is the maximum number of processes in the container, 0
+	// meaning unlimited.
+	PidsLimit int64
+
+	// TmpfsBytes is the size of the tmpfs mounted at /tmp, which holds the
+	// Go build cache, 0 meaning that no tmpfs is mounted.
+	TmpfsBytes int64
+
+	// Parallel is the number of fuzzing processes in the container, passed
+	// as -test.parallel.
+	Parallel int
+}
+
+// cpuMillis returns the CPU share of the container in thousandths of a CPU,
+// rounded up.
+func (l ResourceLimits) cpuMillis() int64 {
+	return int64(math.Ceil(l.CPUs * 1000))
+}
+
+// validate ensures that the limits are usable.
+func (l ResourceLimits) validate() error {
+	switch {
+	case l.MemoryBytes < 0:
+		return fmt.Errorf("invalid memory limit %d: must be "+
+			"non-negative", l.MemoryBytes)
+
+	case l.CPUs <= 0:
+		return fmt.Errorf("invalid CPU limit %v: must be positive",
+			l.CPUs)
+
+	case l.PidsLimit < 0:
+		return fmt.Errorf("invalid pids limit %d: must be "+
+			"non-negative", l.PidsLimit)
+
+	case l.TmpfsBytes < 0:
+		return fmt.Errorf("invalid tmpfs size %d: must be "+
+			"non-negative", l.TmpfsBytes)
+
+	case l.Parallel < 1:
+		return fmt.Errorf("invalid parallelism %d: must be at least 1",
+			l.Parallel)
+	}
+
+	return nil
+}
+
+// parseByteSize parses a size such as 512m or 4g. An empty size is 0.
+func parseByteSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	return units.RAMInBytes(size)
+}
+
+// applyResourceSpec overrides the limits set in spec, a comma-separated list of
+// <key>=<value> pairs with the keys memory, cpus, pids, tmpfs and parallel.
+func applyResourceSpec(l *ResourceLimits, spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("invalid resource %q: expected "+
+				"<key>=<value>", pair)
+		}
+
+		var err error
+		switch key {
+		case "memory":
+			l.MemoryBytes, err = parseByteSize(value)
+
+		case "cpus":
+			l.CPUs, err = strconv.ParseFloat(value, 64)
+
+		case "pids":
+			l.PidsLimit, err = strconv.ParseInt(value, 10, 64)
+
+		case "tmpfs":
+			l.TmpfsBytes, err = parseByteSize(value)
+
+		case "parallel":
+			l.Parallel, err = strconv.Atoi(value)
+
+		default:
+			return fmt.Errorf("unknown resource %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for resource %q: %w",
+				key, err)
+		}
+	}
+
+	return nil
+}
+
+// parseResourceLimits resolves the global container resource options and the
+// per-package and per-target overrides of fuzz into fuzz.DefaultLimits and
+// fuzz.Limits. Overrides start from the global limits.
+func parseResourceLimits(fuzz *Fuzz) error {
+	memory, err := parseByteSize(fuzz.ContainerMemory)
+	if err != nil {
+		return fmt.Errorf("invalid container memory %q: %w",
+			fuzz.ContainerMemory, err)
+	}
+	tmpfs, err := parseByteSize(fuzz.ContainerTmpfsSize)
+	if err != nil {
+		return fmt.Errorf("invalid container tmpfs size %q: %w",
+			fuzz.ContainerTmpfsSize, err)
+	}
+
+	fuzz.DefaultLimits = ResourceLimits{
+		MemoryBytes: memory,
+		CPUs:        fuzz.ContainerCPUs,
+		PidsLimit:   fuzz.ContainerPidsLimit,
+		TmpfsBytes:  tmpfs,
+		Parallel:    fuzz.Parallel,
+	}
+	if err := fuzz.DefaultLimits.validate(); err != nil {
+		return fmt.Errorf("invalid container resources: %w", err)
+	}
+
+	fuzz.Limits = make(map[string]ResourceLimits, len(fuzz.Resources))
+	for key, spec := range fuzz.Resources {
+		limits := fuzz.DefaultLimits
+		if err := applyResourceSpec(&limits, spec); err != nil {
+			return fmt.Errorf("invalid resources for %q: %w", key,
+				err)
+		}
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("invalid resources for %q: %w", key,
+				err)
+		}
+
+		fuzz.Limits[key] = limits
+	}
+
+	return nil
+}
+
+// resourceLimits returns the container resources of the given target: those
+// configured for the target, else those configured for its package, else the
+// global ones.
+func resourceLimits(fuzz *Fuzz, pkg, target string) ResourceLimits {
+	if limits, ok := fuzz.Limits[targetKey(pkg, target)]; ok {
+		return limits
+	}
+	if limits, ok := fuzz.Limits[pkg]; ok {
+		return limits
+	}
+
+	return fuzz.DefaultLimits
+}
+
+// slotCapacity returns the number of worker slots, in thousandths of a CPU,
+// shared by the running containers: one CPU per worker.
+func slotCapacity(fuzz *Fuzz) int64 {
+	return int64(fuzz.NumWorkers) * 1000
+}
+
+// taskSlots returns the number of worker slots the task takes while it is
+// fuzzed: the CPU share of its container times its number of shards. It is
+// capped at the slot capacity, so that every task can run eventually.
+func taskSlots(fuzz *Fuzz, task Task) int64 {
+	pkg, target := task.Package.Path, task.Target
+	limits := resourceLimits(fuzz, pkg, target)
+	shards := int64(targetShards(fuzz, pkg, target))
+
+	return min(limits.cpuMillis()*shards, slotCapacity(fuzz))
+}
+
+// workerCount returns the number of workers needed to keep the slot capacity
+// busy, given that the tasks with the smallest CPU share may run more
+// containers at once than there are configured workers.
+func workerCount(fuzz *Fuzz, tasks []Task) int {
+	workers := fuzz.NumWorkers
+	for _, task := range tasks {
+		fit := int(slotCapacity(fuzz) / taskSlots(fuzz, task))
+		workers = max(workers, fit)
+	}
+
+	return min(workers, max(len(tasks), fuzz.NumWorkers))
+}
+
+// totalSlotTime returns the number of per-target time slices of one worker
+// needed to fuzz every task once, accounting for their CPU shares and shards.
+func totalSlotTime(fuzz *Fuzz, tasks []Task) int {
+	var total int64
+	for _, task := range tasks {
+		total += taskSlots(fuzz, task)
+	}
+
+	return int((total + 999) / 1000)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseResourceLimits verifies that the global container resources are
+// resolved, that package and target entries override them, and that invalid
+// entries are rejected.
+func TestParseResourceLimits(t *testing.T) {
+	defaults := ResourceLimits{
+		MemoryBytes: 2 << 30,
+		CPUs:        1,
+		Parallel:    1,
+	}
+
+	tests := []struct {
+		name      string
+		resources map[string]string
+		pkg       string
+		target    string
+		expected  ResourceLimits
+		errMsg    string
+	}{
+		{
+			name:     "global defaults",
+			pkg:      "parser",
+			target:   "FuzzParse",
+			expected: defaults,
+		},
+		{
+			name: "package entry",
+			resources: map[string]string{
+				"parser": "memory=4g,pids=256,tmpfs=512m",
+			},
+			pkg:    "parser",
+			target: "FuzzParse",
+			expected: ResourceLimits{
+				MemoryBytes: 4 << 30,
+				CPUs:        1,
+				PidsLimit:   256,
+				TmpfsBytes:  512 << 20,
+				Parallel:    1,
+			},
+		},
+		{
+			name: "target entry takes precedence",
+			resources: map[string]string{
+				"parser":           "memory=4g",
+				"parser/FuzzParse": "cpus=0.5, parallel=2",
+			},
+			pkg:    "parser",
+			target: "FuzzParse",
+			expected: ResourceLimits{
+				MemoryBytes: 2 << 30,
+				CPUs:        0.5,
+				Parallel:    2,
+			},
+		},
+		{
+			name: "entry of another package",
+			resources: map[string]string{
+				"parser/sub": "memory=4g",
+			},
+			pkg:      "parser",
+			target:   "FuzzParse",
+			expected: defaults,
+		},
+		{
+			name:      "unknown key",
+			resources: map[string]string{"parser": "disk=1g"},
+			errMsg:    `unknown resource "disk"`,
+		},
+		{
+			name:      "missing value",
+			resources: map[string]string{"parser": "memory"},
+			errMsg:    "expected <key>=<value>",
+		},
+		{
+			name:      "invalid size",
+			resources: map[string]string{"parser": "memory=lots"},
+			errMsg:    `invalid value for resource "memory"`,
+		},
+		{
+			name:      "no CPU",
+			resources: map[string]string{"parser": "cpus=0"},
+			errMsg:    "must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fuzz := &Fuzz{
+				ContainerMemory: "2g",
+				ContainerCPUs:   1,
+				Parallel:        1,
+				Resources:       tt.resources,
+			}
+
+			err := parseResourceLimits(fuzz)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			limits := resourceLimits(fuzz, tt.pkg, tt.target)
+			assert.Equal(t, tt.expected, limits)
+		})
+	}
+}
+
+// TestTaskSlots verifies that tasks take the CPUs of the containers of all
+// their shards, capped at the CPUs of all workers, and that the worker count
+// and fuzzing time account for them.
+func TestTaskSlots(t *testing.T) {
+	fuzz := &Fuzz{
+		NumWorkers:    4,
+		ContainerCPUs: 1,
+		Parallel:      1,
+		Resources: map[string]string{
+			"light":           "cpus=0.5",
+			"heavy/FuzzHeavy": "cpus=3",
+		},
+		TargetShards: map[string]int{
+			"heavy/FuzzHeavy":  2,
+			"parser/FuzzParse": 2,
+		},
+	}
+	require.NoError(t, parseResourceLimits(fuzz))
+
+	light := Task{Package: GoPackage{Path: "light"}, Target: "FuzzLight"}
+	heavy := Task{Package: GoPackage{Path: "heavy"}, Target: "FuzzHeavy"}
+	parser := Task{Package: GoPackage{Path: "parser"}, Target: "FuzzParse"}
+	plain := Task{Package: GoPackage{Path: "plain"}, Target: "FuzzPlain"}
+
+	assert.EqualValues(t, 500, taskSlots(fuzz, light))
+	assert.EqualValues(t, 4000, taskSlots(fuzz, heavy))
+	assert.EqualValues(t, 2000, taskSlots(fuzz, parser))
+	assert.EqualValues(t, 1000, taskSlots(fuzz, plain))
+
+	tasks := []Task{light, heavy, parser, plain}
+	assert.Equal(t, 8, totalSlotTime(fuzz, tasks))
+
+	// Eight light containers fit into four CPUs, but there are only four
+	// tasks to run.
+	assert.Equal(t, 4, workerCount(fuzz, tasks))
+
+	lights := make([]Task, 10)
+	for i := range lights {
+		lights[i] = light
+	}
+	assert.Equal(t, 8, workerCount(fuzz, lights))
+	assert.Equal(t, 5, totalSlotTime(fuzz, lights))
+}
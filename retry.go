@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/client"
+	"github.com/google/go-github/v72/github"
+)
+
+// transientError marks an error as transient: retrying the failed operation
+// later may succeed.
+type transientError struct {
+	err error
+}
+
+// Error returns the message of the wrapped error.
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// newTransientError marks err as transient. A nil error stays nil.
+func newTransientError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &transientError{err: err}
+}
+
+// isTransientError classifies an error as transient (worth retrying) or fatal.
+// Errors explicitly marked with newTransientError, connection failures and
+// resets, timeouts, Docker daemon internal or unavailability errors, and GitHub
+// server errors or rate limits are transient. Context cancellation is never
+// transient.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+
+		return false
+	}
+
+	var te *transientError
+	if errors.As(err, &te) {
+		return true
+	}
+
+	// Broken connections, e.g. a Docker log stream disconnect.
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// Docker daemon hiccups.
+	if client.IsErrConnectionFailed(err) || cerrdefs.IsInternal(err) ||
+		cerrdefs.IsUnavailable(err) {
+
+		return true
+	}
+
+	// GitHub server errors and rate limits.
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return true
+	}
+
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		status := ghErr.Response.StatusCode
+		return status >= http.StatusInternalServerError ||
+			status == http.StatusTooManyRequests
+	}
+
+	return false
+}
+
+// retrier retries operations failing with transient errors using exponential
+// backoff, up to a bounded number of attempts.
+type retrier struct {
+	logger      *slog.Logger
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// newRetrier constructs a retrier from the fuzz configuration.
+func newRetrier(logger *slog.Logger, cfg *Config) *retrier {
+	return &retrier{
+		logger:      logger,
+		maxAttempts: cfg.Fuzz.MaxAttempts,
+		baseDelay:   cfg.Fuzz.RetryBackoff,
+		maxDelay:    cfg.Fuzz.RetryMaxBackoff,
+	}
+}
+
+// do runs op until it succeeds, fails with a non-transient error, the attempts
+// are exhausted or ctx is done. The delay between attempts doubles after every
+// failure, starting at baseDelay and capped at maxDelay. It returns the last
+// error of op.
+func (r *retrier) do(ctx context.Context, name string, op func() error) error {
+	delay := r.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+
+		if !isTransientError(err) {
+			return err
+		}
+		if attempt >= r.maxAttempts {
+			return fmt.Errorf("%s failed after %d attempts: %w",
+				name, attempt, err)
+		}
+
+		r.logger.Warn("Transient failure; retrying", "operation", name,
+			"attempt", attempt, "maxAttempts", r.maxAttempts,
+			"backoff", delay, "error", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("retrying %s: %w", name,
+				errors.Join(ctx.Err(), err))
+		}
+
+		delay = min(2*delay, r.maxDelay)
+	}
+}
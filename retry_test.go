@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIsTransientError verifies the classification of errors as transient or
+// fatal.
+func TestIsTransientError(t *testing.T) {
+	ghResponse := func(status int) *github.ErrorResponse {
+		return &github.ErrorResponse{
+			Response: &http.Response{StatusCode: status},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "nil",
+			err:       nil,
+			transient: false,
+		},
+		{
+			name:      "plain error",
+			err:       errors.New("exit status 1"),
+			transient: false,
+		},
+		{
+			name: "marked transient",
+			err: fmt.Errorf("wrapped: %w",
+				newTransientError(errors.New("boom"))),
+			transient: true,
+		},
+		{
+			name: "context canceled",
+			err: newTransientError(fmt.Errorf("reading: %w",
+				context.Canceled)),
+			transient: false,
+		},
+		{
+			name:      "unexpected EOF",
+			err:       fmt.Errorf("read: %w", io.ErrUnexpectedEOF),
+			transient: true,
+		},
+		{
+			name:      "connection reset",
+			err:       fmt.Errorf("read: %w", syscall.ECONNRESET),
+			transient: true,
+		},
+		{
+			name:      "GitHub bad gateway",
+			err:       fmt.Errorf("create: %w", ghResponse(502)),
+			transient: true,
+		},
+		{
+			name:      "GitHub too many requests",
+			err:       ghResponse(http.StatusTooManyRequests),
+			transient: true,
+		},
+		{
+			name:      "GitHub not found",
+			err:       ghResponse(http.StatusNotFound),
+			transient: false,
+		},
+		{
+			name:      "GitHub rate limit",
+			err:       &github.RateLimitError{},
+			transient: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.transient, isTransientError(tt.err))
+		})
+	}
+}
+
+// TestRetrierDo verifies that transient failures are retried up to the
+// configured number of attempts and that fatal failures are not retried.
+func TestRetrierDo(t *testing.T) {
+	transient := newTransientError(errors.New("daemon hiccup"))
+	fatal := errors.New("exit status 1")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		expectCalls  int
+		expectErr    error
+		expectErrMsg string
+	}{
+		{
+			name:        "success",
+			errs:        []error{nil},
+			expectCalls: 1,
+		},
+		{
+			name:        "transient then success",
+			errs:        []error{transient, transient, nil},
+			expectCalls: 3,
+		},
+		{
+			name:        "fatal",
+			errs:        []error{fatal, nil},
+			expectCalls: 1,
+			expectErr:   fatal,
+		},
+		{
+			name: "attempts exhausted",
+			errs: []error{transient, transient, transient,
+				nil},
+			expectCalls:  3,
+			expectErr:    transient,
+			expectErrMsg: "test op failed after 3 attempts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard,
+				nil))
+			r := &retrier{
+				logger:      logger,
+				maxAttempts: 3,
+				baseDelay:   time.Millisecond,
+				maxDelay:    2 * time.Millisecond,
+			}
+
+			calls := 0
+			err := r.do(context.Background(), "test op",
+				func() error {
+					calls++
+					return tt.errs[calls-1]
+				})
+
+			assert.Equal(t, tt.expectCalls, calls)
+			if tt.expectErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.expectErr)
+			if tt.expectErrMsg != "" {
+				assert.ErrorContains(t, err, tt.expectErrMsg)
+			}
+		})
+	}
+}
+
+// TestRetrierDoCanceled verifies that a canceled context stops the retries.
+func TestRetrierDoCanceled(t *testing.T) {
+	r := &retrier{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		maxAttempts: 5,
+		baseDelay:   time.Hour,
+		maxDelay:    time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := r.do(ctx, "test op", func() error {
+		calls++
+		return newTransientError(errors.New("daemon hiccup"))
+	})
+
+	assert.Equal(t, 1, calls)
+	assert.ErrorIs(t, err, context.Canceled)
+}
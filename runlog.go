@@ -0,0 +1,219 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RunLogDir is the directory, inside the report directory, where the
+	// raw output of the fuzzing runs of each cycle is archived.
+	RunLogDir = "logs"
+
+	// runLogExt is the extension of the archived run logs.
+	runLogExt = ".log.gz"
+
+	// AgentRunLogFile is the name of the file, inside the run directory of
+	// an agent, where the output of a leased run is archived before it is
+	// uploaded to the coordinator.
+	AgentRunLogFile = "run" + runLogExt
+)
+
+// runLogPath returns the path of the log archiving the raw output of the
+// task's fuzzing runs in the given cycle, below reportDir. Every Go version and
+// shard of a target gets its own log; shard is negative for unsharded targets.
+func runLogPath(reportDir, cycleID string, task Task, shard int) string {
+	name := task.Target
+	if task.GoVersion != "" {
+		name += "-go" + task.GoVersion
+	}
+	if shard >= 0 {
+		name += fmt.Sprintf("-shard%d", shard)
+	}
+
+	return filepath.Join(reportDir, RunLogDir, cycleID, task.Package.Path,
+		name+runLogExt)
+}
+
+// runLogURL returns the URL the run log at logPath is published at once the
+// reports are uploaded.
+func runLogURL(cfg *Config, logPath string) string {
+	return reportFileURL(cfg, logPath)
+}
+
+// reportFileURL returns the URL the file at filePath, below the report
+// directory, is published at once the reports are uploaded: below reportURL if
+// set, and in the S3 bucket otherwise.
+func reportFileURL(cfg *Config, filePath string) string {
+	rel, err := filepath.Rel(cfg.Project.ReportDir, filePath)
+	if err != nil {
+		return ""
+	}
+	key := filepath.ToSlash(rel)
+
+	if cfg.Project.ReportURL != "" {
+		return strings.TrimSuffix(cfg.Project.ReportURL, "/") + "/" +
+			key
+	}
+
+	return fmt.Sprintf("s3://%s/%s", cfg.Project.S3BucketName, key)
+}
+
+// runLog archives the raw output of a fuzzing run, compressed, at the end of a
+// run log file. Every run appends a gzip member of its own, so that the file
+// decompresses into the output of all the runs in order.
+//
+// Archiving is best effort: write errors are logged once and the rest of the
+// output is discarded, so that the run itself is never disturbed.
+type runLog struct {
+	logger *slog.Logger
+	file   *os.File
+	gz     *gzip.Writer
+	failed bool
+}
+
+// openRunLog opens the run log at logPath for appending the output of a new
+// run.
+func openRunLog(logger *slog.Logger, logPath string) (*runLog, error) {
+	if err := EnsureDirExists(filepath.Dir(logPath)); err != nil {
+		return nil, fmt.Errorf("create run log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0644)
+	if err != nil {
+		return nil, fmt.Errorf("open run log %q: %w", logPath, err)
+	}
+
+	return &runLog{
+		logger: logger.With("runLog", logPath),
+		file:   file,
+		gz:     gzip.NewWriter(file),
+	}, nil
+}
+
+// Write archives p. It never fails, so that it can be used with io.TeeReader.
+func (l *runLog) Write(p []byte) (int, error) {
+	if l.failed {
+		return len(p), nil
+	}
+
+	if _, err := l.gz.Write(p); err != nil {
+		l.logger.Error("Failed to write run log; discarding the rest "+
+			"of the output", "error", err)
+		l.failed = true
+	}
+
+	return len(p), nil
+}
+
+// Close completes the gzip member of the run and closes the log file.
+func (l *runLog) Close() error {
+	gzErr := l.gz.Close()
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	return gzErr
+}
+
+// appendRunLog appends a gzip-compressed run log read from r, as uploaded by an
+// agent, to the run log at logPath.
+func appendRunLog(logPath string, r io.Reader) error {
+	if err := EnsureDirExists(filepath.Dir(logPath)); err != nil {
+		return fmt.Errorf("create run log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0644)
+	if err != nil {
+		return fmt.Errorf("open run log %q: %w", logPath, err)
+	}
+
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("append to run log %q: %w", logPath, err)
+	}
+
+	return nil
+}
+
+// RunLogLink links the target's HTML page to a run log of the target.
+type RunLogLink struct {
+	// Cycle is the ID of the fuzzing cycle of the runs.
+	Cycle string
+
+	// Name is the file name of the run log.
+	Name string
+
+	// Path is the slash-separated path of the run log relative to the
+	// directory of the target's HTML page.
+	Path string
+}
+
+// targetRunLogs returns the links to the run logs of the given target in the
+// given cycle in reportDir.
+func targetRunLogs(reportDir, cycleID, pkg, target string) ([]RunLogLink,
+	error) {
+
+	logDir := filepath.Join(reportDir, RunLogDir, cycleID, pkg)
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("list run logs in %q: %w", logDir, err)
+	}
+
+	pageDir := filepath.Join(reportDir, "targets", pkg)
+	var links []RunLogLink
+	for _, entry := range entries {
+		name := entry.Name()
+		base := strings.TrimSuffix(name, runLogExt)
+		if entry.IsDir() || base == name || (base != target &&
+			!strings.HasPrefix(base, target+"-")) {
+
+			continue
+		}
+
+		rel, err := filepath.Rel(pageDir, filepath.Join(logDir, name))
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, RunLogLink{
+			Cycle: cycleID,
+			Name:  name,
+			Path:  path.Clean(filepath.ToSlash(rel)),
+		})
+	}
+
+	return links, nil
+}
+
+// expiredRunLog reports whether the run logs of the given cycle are older than
+// the retention as of now. Logs of cycles with malformed IDs never expire, and
+// neither do logs kept forever with a zero retention.
+func expiredRunLog(cycleID string, retention time.Duration,
+	now time.Time) bool {
+
+	if retention == 0 {
+		return false
+	}
+
+	start, err := time.Parse(cycleIDLayout, cycleID)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(start) > retention
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRunLog appends the output of a run to the run log at logPath.
+func writeRunLog(t *testing.T, logPath, output string) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runLog, err := openRunLog(logger, logPath)
+	require.NoError(t, err)
+
+	_, err = runLog.Write([]byte(output))
+	require.NoError(t, err)
+	require.NoError(t, runLog.Close())
+}
+
+// readRunLog returns the decompressed output of all the runs in the run log at
+// logPath.
+func readRunLog(t *testing.T, logPath string) string {
+	t.Helper()
+
+	file, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+// TestRunLog verifies that every run appends its output to the run log, which
+// decompresses into the output of all the runs in order.
+func TestRunLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "logs", "FuzzFoo.log.gz")
+
+	writeRunLog(t, logPath, "fuzz: first run\n")
+	writeRunLog(t, logPath, "fuzz: second run\n")
+
+	assert.Equal(t, "fuzz: first run\nfuzz: second run\n",
+		readRunLog(t, logPath))
+}
+
+// TestRunLogPath verifies that every Go version and shard of a target gets a
+// run log of its own, and the URLs the run logs are published at.
+func TestRunLogPath(t *testing.T) {
+	reportDir := t.TempDir()
+	pkg := GoPackage{Path: "parser"}
+
+	tests := []struct {
+		name     string
+		task     Task
+		shard    int
+		expected string
+	}{
+		{
+			name:     "unsharded",
+			task:     Task{Package: pkg, Target: "FuzzFoo"},
+			shard:    -1,
+			expected: "logs/c1/parser/FuzzFoo.log.gz",
+		},
+		{
+			name: "go version and shard",
+			task: Task{Package: pkg, Target: "FuzzFoo",
+				GoVersion: "1.24.6"},
+			shard: 2,
+			expected: "logs/c1/parser/" +
+				"FuzzFoo-go1.24.6-shard2.log.gz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath := runLogPath(reportDir, "c1", tt.task,
+				tt.shard)
+			assert.Equal(t, filepath.Join(reportDir,
+				filepath.FromSlash(tt.expected)), logPath)
+
+			cfg := &Config{Project: Project{
+				ReportDir:    reportDir,
+				S3BucketName: "bucket",
+			}}
+			assert.Equal(t, "s3://bucket/"+tt.expected,
+				runLogURL(cfg, logPath))
+
+			cfg.Project.ReportURL = "https://fuzz.example.com/"
+			assert.Equal(t, "https://fuzz.example.com/"+
+				tt.expected, runLogURL(cfg, logPath))
+		})
+	}
+}
+
+// TestTargetRunLogs verifies that the run logs of a target in a cycle are
+// listed relative to the target's HTML page, excluding those of other targets.
+func TestTargetRunLogs(t *testing.T) {
+	reportDir := t.TempDir()
+	writeFiles(t, reportDir, map[string]string{
+		"logs/c1/parser/FuzzFoo.log.gz":          "",
+		"logs/c1/parser/FuzzFoo-shard0.log.gz":   "",
+		"logs/c1/parser/FuzzFooBar.log.gz":       "",
+		"logs/c1/parser/FuzzFoo.txt":             "",
+		"logs/c2/parser/FuzzFoo-go1.24.6.log.gz": "",
+	})
+
+	logs, err := targetRunLogs(reportDir, "c1", "parser", "FuzzFoo")
+	require.NoError(t, err)
+	assert.Equal(t, []RunLogLink{{
+		Cycle: "c1",
+		Name:  "FuzzFoo-shard0.log.gz",
+		Path:  "../../logs/c1/parser/FuzzFoo-shard0.log.gz",
+	}, {
+		Cycle: "c1",
+		Name:  "FuzzFoo.log.gz",
+		Path:  "../../logs/c1/parser/FuzzFoo.log.gz",
+	}}, logs)
+
+	logs, err = targetRunLogs(reportDir, "c3", "parser", "FuzzFoo")
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+}
+
+// TestExpiredRunLog verifies that run logs expire once their cycle is older
+// than the retention, unless they are kept forever.
+func TestExpiredRunLog(t *testing.T) {
+	now := time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		cycleID   string
+		retention time.Duration
+		expired   bool
+	}{
+		{
+			name:      "recent cycle",
+			cycleID:   "2025-08-30T12-00-00Z",
+			retention: 48 * time.Hour,
+		},
+		{
+			name:      "old cycle",
+			cycleID:   "2025-08-01T12-00-00Z",
+			retention: 48 * time.Hour,
+			expired:   true,
+		},
+		{
+			name:    "kept forever",
+			cycleID: "2025-08-01T12-00-00Z",
+		},
+		{
+			name:      "malformed cycle ID",
+			cycleID:   "latest",
+			retention: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expired, expiredRunLog(tt.cycleID,
+				tt.retention, now))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+const (
+	// RuntimeDocker runs the fuzz targets in Docker containers.
+	RuntimeDocker = "docker"
+
+	// RuntimePodman runs the fuzz targets in Podman containers, through
+	// Podman's Docker-compatible API.
+	RuntimePodman = "podman"
+
+	// RuntimeProcess runs the fuzz targets as plain processes on the host.
+	RuntimeProcess = "process"
+)
+
+// RunSpec describes a fuzzing run: the image it runs in, the host directories
+// mounted as its working directory (ContainerWorkDir) and its corpus directory
+// (ContainerCorpusPath), its command, its resources, its security settings and
+// the labels identifying it.
+type RunSpec struct {
+	Image     string
+	WorkDir   string
+	CorpusDir string
+	Cmd       []string
+	Limits    ResourceLimits
+	Sandbox   SandboxOptions
+	Labels    map[string]string
+}
+
+// ExitStatus describes how a fuzzing run exited.
+type ExitStatus struct {
+	// Code is the exit code of the run, 128 plus the signal number for
+	// runs killed by a signal.
+	Code int
+
+	// OOMKilled reports whether the run was killed for exceeding its
+	// memory limit.
+	OOMKilled bool
+}
+
+// Runner starts and manages fuzzing runs in a container runtime, or directly on
+// the host. It is safe for concurrent use.
+type Runner interface {
+	// PullImage makes the given image available to later runs.
+	PullImage(ctx context.Context, image string) error
+
+	// ImageExists reports whether the given image is available to runs
+	// without pulling it.
+	ImageExists(ctx context.Context, image string) (bool, error)
+
+	// Start starts the run described by spec and returns its ID.
+	Start(ctx context.Context, spec RunSpec) (string, error)
+
+	// Logs returns the output stream of the run, which ends when the
+	// run exits. Its standard output and standard error are multiplexed
+	// in the stdcopy framing of Docker.
+	Logs(ctx context.Context, id string) (io.ReadCloser, error)
+
+	// Wait waits until the run exits and returns its exit status.
+	Wait(ctx context.Context, id string) (ExitStatus, error)
+
+	// Quit sends SIGQUIT to the main process of the run, which makes Go
+	// programs dump the stacks of their goroutines and exit.
+	Quit(ctx context.Context, id string) error
+
+	// Stop stops the run, if it is still running, and releases its
+	// resources.
+	Stop(id string) error
+
+	// Reap removes all runs carrying the given labels, including runs
+	// started by other processes, and returns their number.
+	Reap(ctx context.Context, labels map[string]string) (int, error)
+
+	// Close stops all remaining runs and releases the runner.
+	Close() error
+}
+
+// newRunner creates the runner of the configured runtime.
+func newRunner(logger *slog.Logger, cfg *Config) (Runner, error) {
+	switch cfg.Fuzz.Runtime {
+	case RuntimePodman:
+		return newDockerRunner(logger, podmanHost(cfg.Fuzz.RuntimeHost),
+			true)
+
+	case RuntimeProcess:
+		return newProcessRunner(logger, cfg.Fuzz.ProcessCgroup)
+
+	case RuntimeDocker, "":
+		return newDockerRunner(logger, cfg.Fuzz.RuntimeHost, false)
+
+	default:
+		return nil, fmt.Errorf("unknown runtime %q", cfg.Fuzz.Runtime)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// dockerRunner runs fuzzing runs in containers through the Docker Engine API,
+// which Podman implements as well.
+type dockerRunner struct {
+	logger *slog.Logger
+	cli    *client.Client
+
+	// podman adapts the containers to rootless Podman: images are fully
+	// qualified, since Podman does not assume Docker Hub, and the user
+	// namespace keeps the host user's ID, so that files written to the
+	// mounts belong to the host user.
+	podman bool
+
+	// mu guards started, the containers the runner created and did not
+	// remove yet, which Close removes.
+	mu      sync.Mutex
+	started map[string]bool
+}
+
+// newDockerRunner creates a runner talking to the Docker or Podman API at host,
+// or at the address from the environment (DOCKER_HOST) if host is empty.
+func newDockerRunner(logger *slog.Logger, host string, podman bool) (Runner,
+	error) {
+
+	opts := []client.Opt{
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+	}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start docker client: %w", err)
+	}
+
+	return &dockerRunner{
+		logger:  logger,
+		cli:     cli,
+		podman:  podman,
+		started: make(map[string]bool),
+	}, nil
+}
+
+// podmanHost returns the address of the Podman API: the given host if set,
+// else CONTAINER_HOST, else the default socket of the root or rootless Podman
+// service.
+func podmanHost(host string) string {
+	if host != "" {
+		return host
+	}
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if os.Getuid() == 0 {
+		return "unix:///run/podman/podman.sock"
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+
+	return "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+// qualifyImage returns the fully qualified name of a Docker Hub image, such as
+// docker.io/library/golang:1.24.6 for golang:1.24.6. Names that already
+// include a registry are returned unchanged.
+func qualifyImage(ref string) string {
+	first, _, found := strings.Cut(ref, "/")
+	if !found {
+		return "docker.io/library/" + ref
+	}
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return ref
+	}
+
+	return "docker.io/" + ref
+}
+
+// imageRef returns the reference of the given image in the runtime.
+func (r *dockerRunner) imageRef(ref string) string {
+	if r.podman {
+		return qualifyImage(ref)
+	}
+
+	return ref
+}
+
+// PullImage pulls the given image. The progress the runtime streams as JSON
+// messages is logged per layer: status changes at info level and transfer
+// progress at debug level.
+func (r *dockerRunner) PullImage(ctx context.Context, imageRef string) error {
+	reader, err := r.cli.ImagePull(ctx, r.imageRef(imageRef),
+		image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull docker image %q: %w",
+			imageRef, err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			r.logger.Error("Failed to close image logs reader",
+				"error", err)
+		}
+	}()
+
+	logger := r.logger.With("image", imageRef)
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		err := decoder.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading image-pull stream: %w",
+				err)
+		}
+
+		// Older API versions report errors only in the legacy field.
+		if msg.Error != nil {
+			return fmt.Errorf("failed to pull docker image %q: %w",
+				imageRef, msg.Error)
+		}
+		if msg.ErrorMessage != "" {
+			return fmt.Errorf("failed to pull docker image %q: %s",
+				imageRef, msg.ErrorMessage)
+		}
+
+		if msg.Progress != nil && msg.Progress.Total > 0 {
+			logger.Debug("Image pull progress", "layer", msg.ID,
+				"status", msg.Status, "current",
+				msg.Progress.Current, "total",
+				msg.Progress.Total)
+			continue
+		}
+
+		if msg.ID != "" {
+			logger.Info("Image pull status", "layer", msg.ID,
+				"status", msg.Status)
+		} else {
+			logger.Info("Image pull status", "status", msg.Status)
+		}
+	}
+
+	return nil
+}
+
+// ImageExists reports whether the given image is present in the runtime.
+func (r *dockerRunner) ImageExists(ctx context.Context, imageRef string) (bool,
+	error) {
+
+	_, err := r.cli.ImageInspect(ctx, r.imageRef(imageRef))
+	switch {
+	case err == nil:
+		return true, nil
+
+	case errdefs.IsNotFound(err):
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("failed to inspect docker image "+
+			"%q: %w", imageRef, err)
+	}
+}
+
+// Start creates and starts a container with the specified configuration. It
+// returns the container ID if successful, or an error if container creation or
+// startup fails.
+func (r *dockerRunner) Start(ctx context.Context, spec RunSpec) (string,
+	error) {
+
+	// Prepare Docker container configuration and limit resources for the
+	// container.
+	containerConfig := &container.Config{
+		Image:        r.imageRef(spec.Image),
+		Cmd:          spec.Cmd,
+		WorkingDir:   ContainerWorkDir,
+		User:         fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		AttachStdout: true,
+		AttachStderr: true,
+		Env: []string{
+			"GOCACHE=/tmp",
+		},
+		Labels: spec.Labels,
+	}
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:%s", spec.WorkDir, ContainerWorkDir),
+			fmt.Sprintf("%s:%s", spec.CorpusDir,
+				ContainerCorpusPath),
+		},
+		Resources: container.Resources{
+			Memory:   spec.Limits.MemoryBytes,
+			NanoCPUs: int64(spec.Limits.CPUs * 1e9),
+		},
+	}
+	if spec.Limits.PidsLimit > 0 {
+		hostConfig.PidsLimit = &spec.Limits.PidsLimit
+	}
+	if spec.Limits.TmpfsBytes > 0 {
+		hostConfig.Tmpfs = map[string]string{
+			"/tmp": fmt.Sprintf("size=%d", spec.Limits.TmpfsBytes),
+		}
+	}
+	if r.podman {
+		hostConfig.UsernsMode = "keep-id"
+	}
+	spec.Sandbox.apply(hostConfig, spec.Limits)
+
+	resp, err := r.cli.ContainerCreate(ctx, containerConfig, hostConfig,
+		nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create fuzz container: %w",
+			err)
+	}
+
+	r.mu.Lock()
+	r.started[resp.ID] = true
+	r.mu.Unlock()
+
+	err = r.cli.ContainerStart(ctx, resp.ID, container.StartOptions{})
+	if err != nil {
+		if rmErr := r.remove(resp.ID); rmErr != nil {
+			r.logger.Error("Failed to remove container", "error",
+				rmErr, "containerID", resp.ID)
+		}
+		return "", fmt.Errorf("failed to start fuzz container: %w",
+			err)
+	}
+
+	return resp.ID, nil
+}
+
+// Logs returns the log stream of the running container, with its stdout and
+// stderr multiplexed by the Docker daemon, as it runs without a TTY.
+func (r *dockerRunner) Logs(ctx context.Context, id string) (io.ReadCloser,
+	error) {
+
+	return r.cli.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: false,
+	})
+}
+
+// Wait waits for the container to stop and returns its exit code, and whether
+// it was killed for exceeding its memory limit.
+func (r *dockerRunner) Wait(ctx context.Context, id string) (ExitStatus,
+	error) {
+
+	statusCh, errCh := r.cli.ContainerWait(ctx, id,
+		container.WaitConditionNotRunning)
+
+	var status ExitStatus
+	select {
+	case err := <-errCh:
+		return ExitStatus{}, err
+
+	case resp := <-statusCh:
+		status.Code = int(resp.StatusCode)
+	}
+
+	// The container is kept until it is stopped, so that its state can
+	// still be inspected here.
+	info, err := r.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return ExitStatus{}, fmt.Errorf("inspecting fuzz container: %w",
+			err)
+	}
+	if info.State != nil {
+		status.OOMKilled = info.State.OOMKilled
+	}
+
+	return status, nil
+}
+
+// Quit sends SIGQUIT to the main process of the container.
+func (r *dockerRunner) Quit(ctx context.Context, id string) error {
+	return r.cli.ContainerKill(ctx, id, "SIGQUIT")
+}
+
+// Stop stops the container, killing it if it does not stop within the default
+// timeout of 10 seconds, and removes it.
+func (r *dockerRunner) Stop(id string) error {
+	err := r.cli.ContainerStop(context.Background(), id,
+		container.StopOptions{})
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	return r.remove(id)
+}
+
+// remove forcibly removes the container.
+func (r *dockerRunner) remove(id string) error {
+	err := r.cli.ContainerRemove(context.Background(), id,
+		container.RemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	r.mu.Lock()
+	delete(r.started, id)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Reap removes all containers carrying the given labels, whether they are
+// running or not.
+func (r *dockerRunner) Reap(ctx context.Context,
+	labels map[string]string) (int, error) {
+
+	args := filters.NewArgs()
+	for key, value := range labels {
+		args.Add("label", key+"="+value)
+	}
+
+	containers, err := r.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("listing containers: %w", err)
+	}
+
+	var errs []error
+	for _, c := range containers {
+		err := r.cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{
+			Force: true,
+		})
+		if err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("removing container "+
+				"%s: %w", c.ID, err))
+			continue
+		}
+
+		r.mu.Lock()
+		delete(r.started, c.ID)
+		r.mu.Unlock()
+	}
+
+	return len(containers) - len(errs), errors.Join(errs...)
+}
+
+// Close forcibly removes the containers the runner started and did not remove
+// yet, killing those still running, and closes the API client.
+func (r *dockerRunner) Close() error {
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.started))
+	for id := range r.started {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	var err error
+	for _, id := range ids {
+		if rmErr := r.remove(id); rmErr != nil {
+			err = errors.Join(err, fmt.Errorf("removing container "+
+				"%s: %w", id, rmErr))
+		}
+	}
+
+	return errors.Join(err, r.cli.Close())
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// processStopTimeout is how long a stopped process may take to exit
+	// after SIGTERM before it is killed, as for containers.
+	processStopTimeout = 10 * time.Second
+
+	// cgroupCPUPeriod is the period of the CPU quota of a run's cgroup, in
+	// microseconds.
+	cgroupCPUPeriod = 100_000
+
+	// rlimitExecArg is the first argument of the daemon, or of its test
+	// binary, started as the wrapper of a run: it applies the rlimits of
+	// the run to itself and executes the run's command, so that the
+	// limits hold before the command runs its first instruction.
+	rlimitExecArg = "-go-continuous-fuzz-rlimit-exec"
+
+	// processLabelsEnv is the environment variable holding the labels of
+	// a run, encoded as JSON. The fuzzer's worker processes inherit it,
+	// so that Reap finds every process of a run.
+	processLabelsEnv = "GO_CONTINUOUS_FUZZ_LABELS"
+)
+
+// init turns the process into the wrapper of a run if it was started as one,
+// before anything else of the daemon runs.
+func init() {
+	if len(os.Args) > 2 && os.Args[1] == rlimitExecArg {
+		os.Exit(execWithRlimits(os.Args[2], os.Args[3:]))
+	}
+}
+
+// execWithRlimits applies the rlimits of a run, with the given memory limit in
+// bytes, to the process and replaces it with the command args. It only returns
+// if that fails, with the exit code of a command that could not be executed.
+func execWithRlimits(memory string, args []string) int {
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "go-continuous-fuzz: %v\n", err)
+		return 127
+	}
+
+	memoryBytes, err := strconv.ParseInt(memory, 10, 64)
+	if err != nil || len(args) == 0 {
+		return fail(errors.New("invalid rlimit wrapper arguments"))
+	}
+	if err := setRlimits(memoryBytes); err != nil {
+		return fail(err)
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return fail(err)
+	}
+
+	return fail(unix.Exec(path, args, os.Environ()))
+}
+
+// processRunner runs fuzz binaries as plain processes on the host, for hosts
+// without a container runtime. Runs get no isolation beyond a private home and
+// temporary directory: their working directory and corpus directory are the
+// host directories themselves. Resources are limited with rlimits and, if a
+// delegated cgroup v2 directory is configured, with a cgroup per run.
+type processRunner struct {
+	logger       *slog.Logger
+	cgroupParent string
+
+	mu     sync.Mutex
+	procs  map[string]*process
+	nextID int
+}
+
+// process is a fuzzing run of the process runner.
+type process struct {
+	cmd *exec.Cmd
+
+	// privateDir is the run's home, temporary and Go cache directory.
+	privateDir string
+
+	// cgroupDir is the run's cgroup, if any.
+	cgroupDir string
+
+	// logs is the combined output of the process. It is handed out to a
+	// single reader, or drained if nobody reads it.
+	logs     *io.PipeReader
+	logsOnce sync.Once
+
+	// done is closed once the process exited and status is set.
+	done   chan struct{}
+	status ExitStatus
+}
+
+// newProcessRunner creates a runner starting fuzz binaries as processes. If
+// cgroupParent is set, every run gets a cgroup below it.
+func newProcessRunner(logger *slog.Logger, cgroupParent string) (Runner,
+	error) {
+
+	if cgroupParent != "" {
+		controllers, err := os.ReadFile(filepath.Join(cgroupParent,
+			"cgroup.subtree_control"))
+		if err != nil {
+			return nil, fmt.Errorf("process cgroup %q is not a "+
+				"cgroup v2 directory: %w", cgroupParent, err)
+		}
+		logger.Info("Limiting fuzzing processes with cgroups",
+			"cgroup", cgroupParent, "controllers",
+			strings.TrimSpace(string(controllers)))
+	}
+
+	return &processRunner{
+		logger:       logger,
+		cgroupParent: cgroupParent,
+		procs:        make(map[string]*process),
+	}, nil
+}
+
+// PullImage does nothing, since processes run on the host.
+func (r *processRunner) PullImage(context.Context, string) error {
+	return nil
+}
+
+// ImageExists reports every image as present, since processes need none.
+func (r *processRunner) ImageExists(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+// hostArgs maps the container paths in the arguments of a run to the host
+// directories they are mounted from.
+func hostArgs(spec RunSpec) []string {
+	replacer := strings.NewReplacer(ContainerWorkDir, spec.WorkDir,
+		ContainerCorpusPath, spec.CorpusDir)
+
+	args := make([]string, len(spec.Cmd))
+	for i, arg := range spec.Cmd {
+		args[i] = replacer.Replace(arg)
+	}
+
+	return args
+}
+
+// Start starts the fuzz binary of the run in its working directory, in its own
+// process group, with the resource limits of the run applied before it runs,
+// and with the labels of the run in its environment.
+func (r *processRunner) Start(_ context.Context, spec RunSpec) (string,
+	error) {
+
+	if spec.Sandbox.Hardened {
+		return "", errors.New("the process runtime cannot apply the " +
+			"hardened sandbox")
+	}
+	if len(spec.Cmd) == 0 {
+		return "", errors.New("no command to run")
+	}
+
+	r.mu.Lock()
+	r.nextID++
+	id := fmt.Sprintf("process-%d", r.nextID)
+	r.mu.Unlock()
+
+	privateDir, err := os.MkdirTemp("", "go-continuous-fuzz-run-")
+	if err != nil {
+		return "", fmt.Errorf("creating private directory: %w", err)
+	}
+	p := &process{privateDir: privateDir, done: make(chan struct{})}
+
+	self, err := os.Executable()
+	if err != nil {
+		r.release(p)
+		return "", fmt.Errorf("locating rlimit wrapper: %w", err)
+	}
+
+	// The memory of a run with a cgroup is limited by the cgroup.
+	var memory int64
+	if r.cgroupParent == "" {
+		memory = spec.Limits.MemoryBytes
+	}
+	cmd := exec.Command(self, append([]string{rlimitExecArg,
+		strconv.FormatInt(memory, 10)}, hostArgs(spec)...)...)
+	cmd.Dir = spec.WorkDir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + privateDir,
+		"TMPDIR=" + privateDir,
+		"GOCACHE=" + privateDir,
+	}
+	if len(spec.Labels) > 0 {
+		labels, err := json.Marshal(spec.Labels)
+		if err != nil {
+			r.release(p)
+			return "", fmt.Errorf("encoding run labels: %w", err)
+		}
+		cmd.Env = append(cmd.Env, processLabelsEnv+"="+string(labels))
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+
+	if r.cgroupParent != "" {
+		p.cgroupDir = filepath.Join(r.cgroupParent, id)
+		cgroup, err := createRunCgroup(p.cgroupDir, spec.Limits)
+		if err != nil {
+			r.release(p)
+			return "", err
+		}
+		defer cgroup.Close()
+
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(cgroup.Fd())
+	}
+
+	// Multiplex the output as the Docker daemon does for containers.
+	logs, logsWriter := io.Pipe()
+	cmd.Stdout = stdcopy.NewStdWriter(logsWriter, stdcopy.Stdout)
+	cmd.Stderr = stdcopy.NewStdWriter(logsWriter, stdcopy.Stderr)
+	p.logs = logs
+	p.cmd = cmd
+
+	if err := cmd.Start(); err != nil {
+		r.release(p)
+		return "", fmt.Errorf("failed to start fuzz process: %w", err)
+	}
+
+	go func() {
+		err := cmd.Wait()
+		logsWriter.CloseWithError(io.EOF)
+
+		if err != nil {
+			r.logger.Debug("Fuzz process exited", "id", id,
+				"error", err)
+		}
+
+		// As in containers, a process killed by a signal exits with
+		// 128 plus the signal number.
+		p.status.Code = cmd.ProcessState.ExitCode()
+		ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		if ok && ws.Signaled() {
+			p.status.Code = 128 + int(ws.Signal())
+		}
+		p.status.OOMKilled = cgroupOOMKilled(p.cgroupDir)
+		close(p.done)
+	}()
+
+	r.mu.Lock()
+	r.procs[id] = p
+	r.mu.Unlock()
+
+	return id, nil
+}
+
+// createRunCgroup creates the cgroup of a run with the given limits and returns
+// the opened cgroup directory, which the process is started in.
+func createRunCgroup(dir string, limits ResourceLimits) (*os.File, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating cgroup: %w", err)
+	}
+
+	settings := map[string]string{
+		"cpu.max": fmt.Sprintf("%d %d",
+			int64(limits.CPUs*cgroupCPUPeriod), cgroupCPUPeriod),
+	}
+	if limits.MemoryBytes > 0 {
+		settings["memory.max"] = strconv.FormatInt(limits.MemoryBytes,
+			10)
+	}
+	if limits.PidsLimit > 0 {
+		settings["pids.max"] = strconv.FormatInt(limits.PidsLimit, 10)
+	}
+
+	for file, value := range settings {
+		err := os.WriteFile(filepath.Join(dir, file), []byte(value),
+			0644)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("setting %s: %w",
+				file, err), os.Remove(dir))
+		}
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("opening cgroup: %w", err),
+			os.Remove(dir))
+	}
+
+	return f, nil
+}
+
+// setRlimits applies the rlimits of a run to the calling process: no core
+// dumps and, if memoryBytes is positive, an address space limit of memoryBytes.
+// The limits are inherited by the command the process executes and by the
+// fuzzer's worker processes.
+func setRlimits(memoryBytes int64) error {
+	err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{})
+	if err != nil {
+		return fmt.Errorf("limiting core dumps: %w", err)
+	}
+
+	if memoryBytes > 0 {
+		memory := uint64(memoryBytes)
+		err := unix.Setrlimit(unix.RLIMIT_AS, &unix.Rlimit{
+			Cur: memory,
+			Max: memory,
+		})
+		if err != nil {
+			return fmt.Errorf("limiting address space: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// cgroupOOMKilled reports whether the OOM killer killed a process of the
+// cgroup at dir.
+func cgroupOOMKilled(dir string) bool {
+	if dir == "" {
+		return false
+	}
+
+	f, err := os.Open(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		if key == "oom_kill" {
+			return value != "0"
+		}
+	}
+
+	return false
+}
+
+// lookup returns the process with the given ID.
+func (r *processRunner) lookup(id string) (*process, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.procs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such fuzz process: %s", id)
+	}
+
+	return p, nil
+}
+
+// Logs returns the multiplexed output of the process. It can only be read once.
+func (r *processRunner) Logs(_ context.Context, id string) (io.ReadCloser,
+	error) {
+
+	p, err := r.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	handedOut := false
+	p.logsOnce.Do(func() { handedOut = true })
+	if !handedOut {
+		return nil, fmt.Errorf("logs of fuzz process %s already "+
+			"consumed", id)
+	}
+
+	return p.logs, nil
+}
+
+// Wait waits for the process to exit and returns its exit status. Output that
+// nobody reads is discarded, so that the process never blocks on it.
+func (r *processRunner) Wait(ctx context.Context, id string) (ExitStatus,
+	error) {
+
+	p, err := r.lookup(id)
+	if err != nil {
+		return ExitStatus{}, err
+	}
+
+	p.logsOnce.Do(func() {
+		go func() {
+			_, _ = io.Copy(io.Discard, p.logs)
+		}()
+	})
+
+	select {
+	case <-ctx.Done():
+		return ExitStatus{}, ctx.Err()
+
+	case <-p.done:
+		return p.status, nil
+	}
+}
+
+// Quit sends SIGQUIT to the process of the run.
+func (r *processRunner) Quit(_ context.Context, id string) error {
+	p, err := r.lookup(id)
+	if err != nil {
+		return err
+	}
+
+	return p.cmd.Process.Signal(syscall.SIGQUIT)
+}
+
+// Stop terminates the process group of the run, killing it if it does not exit
+// within processStopTimeout, and removes its cgroup and private directory.
+func (r *processRunner) Stop(id string) error {
+	r.mu.Lock()
+	p, ok := r.procs[id]
+	delete(r.procs, id)
+	r.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// Closing the logs unblocks the process if nobody reads them.
+	p.logs.Close()
+
+	pgid := -p.cmd.Process.Pid
+	select {
+	case <-p.done:
+	default:
+		_ = syscall.Kill(pgid, syscall.SIGTERM)
+
+		select {
+		case <-p.done:
+		case <-time.After(processStopTimeout):
+			_ = syscall.Kill(pgid, syscall.SIGKILL)
+			<-p.done
+		}
+	}
+
+	// The fuzzer's worker processes may outlive the main process.
+	_ = syscall.Kill(pgid, syscall.SIGKILL)
+
+	return r.release(p)
+}
+
+// release removes the cgroup and the private directory of the process.
+func (r *processRunner) release(p *process) error {
+	var err error
+	if p.cgroupDir != "" {
+		err = removeCgroup(p.cgroupDir)
+	}
+
+	return errors.Join(err, os.RemoveAll(p.privateDir))
+}
+
+// removeCgroup removes the cgroup at dir, waiting briefly for its last
+// processes to be reaped.
+func removeCgroup(dir string) error {
+	var err error
+	for range 50 {
+		err = os.Remove(dir)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if !errors.Is(err, unix.EBUSY) {
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("removing cgroup: %w", err)
+}
+
+// Reap kills the process groups of the runs carrying the given labels, which
+// every process of a run inherits in its environment, and returns their
+// number. This includes the runs of previous instances: their main processes
+// are killed when their parent exits, but not the fuzzer's worker processes.
+func (r *processRunner) Reap(_ context.Context,
+	labels map[string]string) (int, error) {
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, fmt.Errorf("listing processes: %w", err)
+	}
+
+	own := unix.Getpgrp()
+	groups := make(map[int]bool)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// Processes of other users, and processes that already
+		// exited, cannot be read and are no runs to reap.
+		environ, err := os.ReadFile(filepath.Join("/proc",
+			entry.Name(), "environ"))
+		if err != nil || !hasRunLabels(environ, labels) {
+			continue
+		}
+
+		pgid, err := unix.Getpgid(pid)
+		if err != nil || pgid == own {
+			continue
+		}
+		groups[pgid] = true
+	}
+
+	var errs []error
+	for pgid := range groups {
+		err := unix.Kill(-pgid, unix.SIGKILL)
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("killing process "+
+				"group %d: %w", pgid, err))
+		}
+	}
+
+	return len(groups) - len(errs), errors.Join(errs...)
+}
+
+// hasRunLabels reports whether the environment of a process, as listed in its
+// /proc environ file, holds the labels of a run that include the given ones.
+func hasRunLabels(environ []byte, labels map[string]string) bool {
+	prefix := processLabelsEnv + "="
+	for _, entry := range strings.Split(string(environ), "\x00") {
+		encoded, ok := strings.CutPrefix(entry, prefix)
+		if !ok {
+			continue
+		}
+
+		var runLabels map[string]string
+		err := json.Unmarshal([]byte(encoded), &runLabels)
+		if err != nil {
+			return false
+		}
+		for key, value := range labels {
+			if runLabels[key] != value {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Close stops all remaining runs.
+func (r *processRunner) Close() error {
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.procs))
+	for id := range r.procs {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	var err error
+	for _, id := range ids {
+		err = errors.Join(err, r.Stop(id))
+	}
+
+	return err
+}
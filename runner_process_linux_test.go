@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProcessRunner verifies that the process runner runs the command with the
+// container paths mapped to the host directories, streams its standard output
+// and standard error multiplexed and reports its exit code.
+func TestProcessRunner(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner, err := newProcessRunner(logger, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, runner.Close()) })
+
+	workDir := t.TempDir()
+	corpusDir := t.TempDir()
+	spec := RunSpec{
+		WorkDir:   workDir,
+		CorpusDir: corpusDir,
+		Cmd: []string{"sh", "-c", "pwd; echo " +
+			ContainerCorpusPath + "; echo oops >&2; exit 3"},
+	}
+	ctx := context.Background()
+
+	id, err := runner.Start(ctx, spec)
+	require.NoError(t, err)
+
+	logs, err := runner.Logs(ctx, id)
+	require.NoError(t, err)
+	var stdout, stderr bytes.Buffer
+	_, err = stdcopy.StdCopy(&stdout, &stderr, logs)
+	require.NoError(t, err)
+	assert.Equal(t, workDir+"\n"+corpusDir+"\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+
+	status, err := runner.Wait(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, ExitStatus{Code: 3}, status)
+	assert.NoError(t, runner.Stop(id))
+
+	// The hardened sandbox cannot be applied to processes.
+	spec.Sandbox.Hardened = true
+	_, err = runner.Start(ctx, spec)
+	assert.Error(t, err)
+}
+
+// TestProcessRunnerRlimits verifies that the rlimits of a run hold from the
+// start of its command.
+func TestProcessRunnerRlimits(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner, err := newProcessRunner(logger, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, runner.Close()) })
+
+	spec := RunSpec{
+		WorkDir:   t.TempDir(),
+		CorpusDir: t.TempDir(),
+		Cmd:       []string{"sh", "-c", "ulimit -c; ulimit -v"},
+		Limits:    ResourceLimits{MemoryBytes: 1 << 30},
+	}
+	ctx := context.Background()
+
+	id, err := runner.Start(ctx, spec)
+	require.NoError(t, err)
+	logs, err := runner.Logs(ctx, id)
+	require.NoError(t, err)
+	var stdout, stderr bytes.Buffer
+	_, err = stdcopy.StdCopy(&stdout, &stderr, logs)
+	require.NoError(t, err)
+	assert.Equal(t, "0\n1048576\n", stdout.String())
+	assert.Empty(t, stderr.String())
+
+	status, err := runner.Wait(ctx, id)
+	require.NoError(t, err)
+	assert.Zero(t, status.Code)
+	assert.NoError(t, runner.Stop(id))
+}
+
+// TestProcessRunnerReap verifies that reaping kills the whole process group of
+// the runs carrying the given labels, including the processes a run started,
+// from another runner, as after a restart of the daemon, and spares the runs
+// of other owners.
+func TestProcessRunnerReap(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner, err := newProcessRunner(logger, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, runner.Close()) })
+
+	workDir := t.TempDir()
+	start := func(owner string) string {
+		id, err := runner.Start(context.Background(), RunSpec{
+			WorkDir:   workDir,
+			CorpusDir: t.TempDir(),
+			Cmd: []string{"sh", "-c", "sleep 300 & echo $! > " +
+				owner + ".pid; wait"},
+			Labels: map[string]string{"owner": owner},
+		})
+		require.NoError(t, err)
+		return id
+	}
+	reaped := start("reaped")
+	spared := start("spared")
+
+	// The pid file of the background process is written once it runs.
+	var child int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(filepath.Join(workDir, "reaped.pid"))
+		if err != nil {
+			return false
+		}
+		child, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	other, err := newProcessRunner(logger, "")
+	require.NoError(t, err)
+	n, err := other.Reap(context.Background(),
+		map[string]string{"owner": "reaped"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		10*time.Second)
+	defer cancel()
+	status, err := runner.Wait(ctx, reaped)
+	require.NoError(t, err)
+	assert.Equal(t, 128+int(syscall.SIGKILL), status.Code)
+
+	// The background process is killed too, though it may linger as a
+	// zombie until it is reaped by its new parent.
+	assert.Eventually(t, func() bool {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", child))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 10*time.Second, 10*time.Millisecond)
+
+	ctx, cancel = context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	_, err = runner.Wait(ctx, spared)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// newProcessRunner reports that the process runtime is not supported, since it
+// relies on Linux rlimits and cgroups.
+func newProcessRunner(*slog.Logger, string) (Runner, error) {
+	return nil, errors.New("the process runtime is only supported on " +
+		"Linux")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestQualifyImage verifies that Docker Hub images are fully qualified for
+// Podman, and that images of other registries are kept.
+func TestQualifyImage(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "golang:1.24.6", want: "docker.io/library/golang:1.24.6"},
+		{ref: "user/fuzz:1", want: "docker.io/user/fuzz:1"},
+		{ref: "ghcr.io/org/fuzz", want: "ghcr.io/org/fuzz"},
+		{ref: "localhost/fuzz", want: "localhost/fuzz"},
+		{ref: "registry:5000/fuzz", want: "registry:5000/fuzz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			assert.Equal(t, tt.want, qualifyImage(tt.ref))
+		})
+	}
+}
+
+// TestPodmanHost verifies that the Podman API address is taken from the
+// configuration first, then from CONTAINER_HOST.
+func TestPodmanHost(t *testing.T) {
+	t.Setenv("CONTAINER_HOST", "unix:///env.sock")
+
+	assert.Equal(t, "tcp://host:8080", podmanHost("tcp://host:8080"))
+	assert.Equal(t, "unix:///env.sock", podmanHost(""))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+const (
+	// SandboxDefault runs fuzzing containers with Docker's default
+	// security settings.
+	SandboxDefault = "default"
+
+	// SandboxHardened runs fuzzing containers without network, with a
+	// read-only root filesystem and without capabilities.
+	SandboxHardened = "hardened"
+
+	// sandboxTmpDir is the writable tmpfs of hardened containers, which
+	// holds the Go build cache and the fuzzer's temporary files.
+	sandboxTmpDir = "/tmp"
+)
+
+// SandboxOptions describes the security settings of a fuzzing container.
+type SandboxOptions struct {
+	// Hardened enables the hardened profile.
+	Hardened bool
+
+	// SeccompProfile is the JSON seccomp profile of hardened containers.
+	// Empty means the daemon's default profile.
+	SeccompProfile string
+
+	// UsernsMode is the user namespace mode of hardened containers. Empty
+	// means the daemon's default.
+	UsernsMode string
+
+	// Network keeps the default network of a hardened container, for
+	// targets that need more than a loopback interface.
+	Network bool
+}
+
+// loadSeccompProfile reads the seccomp profile at path into
+// fuzz.SeccompProfileJSON, since the Docker API takes the profile itself
+// rather than its path.
+func loadSeccompProfile(fuzz *Fuzz) error {
+	if fuzz.SeccompProfile == "" {
+		return nil
+	}
+
+	path := CleanAndExpandPath(fuzz.SeccompProfile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading seccomp profile: %w", err)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("seccomp profile %q is not valid JSON", path)
+	}
+
+	fuzz.SeccompProfileJSON = string(data)
+
+	return nil
+}
+
+// sandboxOptions returns the security settings of the containers of the given
+// target.
+func sandboxOptions(fuzz *Fuzz, pkg, target string) SandboxOptions {
+	if fuzz.Sandbox != SandboxHardened {
+		return SandboxOptions{}
+	}
+
+	return SandboxOptions{
+		Hardened:       true,
+		SeccompProfile: fuzz.SeccompProfileJSON,
+		UsernsMode:     fuzz.UsernsMode,
+		Network: slices.Contains(fuzz.NetworkTargets, pkg) ||
+			slices.Contains(fuzz.NetworkTargets,
+				targetKey(pkg, target)),
+	}
+}
+
+// apply locks down the host configuration of a container if the hardened
+// profile is enabled. The root filesystem becomes read-only, so a tmpfs of the
+// container's tmpfs size, if any, is mounted at /tmp.
+func (s SandboxOptions) apply(hostConfig *container.HostConfig,
+	limits ResourceLimits) {
+
+	if !s.Hardened {
+		return
+	}
+
+	if !s.Network {
+		hostConfig.NetworkMode = container.NetworkMode(
+			network.NetworkNone)
+	}
+
+	hostConfig.ReadonlyRootfs = true
+	hostConfig.CapDrop = []string{"ALL"}
+	hostConfig.SecurityOpt = []string{"no-new-privileges:true"}
+	if s.SeccompProfile != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt,
+			"seccomp="+s.SeccompProfile)
+	}
+	if s.UsernsMode != "" {
+		hostConfig.UsernsMode = container.UsernsMode(s.UsernsMode)
+	}
+
+	tmpfsOptions := "rw,nosuid,nodev"
+	if limits.TmpfsBytes > 0 {
+		tmpfsOptions += fmt.Sprintf(",size=%d", limits.TmpfsBytes)
+	}
+	hostConfig.Tmpfs = map[string]string{sandboxTmpDir: tmpfsOptions}
+}
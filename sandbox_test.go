@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSandboxOptions verifies that the hardened profile locks down the host
+// configuration of the containers, except for the network of exempted
+// packages and targets, and that the default profile leaves it untouched.
+func TestSandboxOptions(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "seccomp.json")
+	seccomp := `{"defaultAction":"SCMP_ACT_ALLOW"}`
+	err := os.WriteFile(profile, []byte(seccomp), 0644)
+	require.NoError(t, err)
+
+	fuzz := &Fuzz{
+		Sandbox:        SandboxHardened,
+		SeccompProfile: profile,
+		UsernsMode:     "host",
+		NetworkTargets: []string{"net", "rpc/FuzzDial"},
+	}
+	require.NoError(t, loadSeccompProfile(fuzz))
+
+	limits := ResourceLimits{TmpfsBytes: 1 << 20}
+
+	tests := []struct {
+		name        string
+		pkg         string
+		target      string
+		networkMode container.NetworkMode
+	}{
+		{name: "no network", pkg: "rpc", target: "FuzzParse",
+			networkMode: "none"},
+		{name: "exempted package", pkg: "net", target: "FuzzParse"},
+		{name: "exempted target", pkg: "rpc", target: "FuzzDial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostConfig := &container.HostConfig{}
+			sandboxOptions(fuzz, tt.pkg, tt.target).apply(
+				hostConfig, limits)
+
+			assert.Equal(t, tt.networkMode, hostConfig.NetworkMode)
+			assert.True(t, hostConfig.ReadonlyRootfs)
+			assert.Equal(t, strslice.StrSlice{"ALL"},
+				hostConfig.CapDrop)
+			assert.Equal(t, []string{
+				"no-new-privileges:true",
+				"seccomp=" + seccomp,
+			}, hostConfig.SecurityOpt)
+			assert.Equal(t, container.UsernsMode("host"),
+				hostConfig.UsernsMode)
+			assert.Equal(t, map[string]string{
+				"/tmp": "rw,nosuid,nodev,size=1048576",
+			}, hostConfig.Tmpfs)
+		})
+	}
+
+	// The default profile keeps Docker's defaults.
+	fuzz.Sandbox = SandboxDefault
+	hostConfig := &container.HostConfig{}
+	sandboxOptions(fuzz, "rpc", "FuzzParse").apply(hostConfig, limits)
+	assert.Equal(t, &container.HostConfig{}, hostConfig)
+}
@@ -1,18 +1,17 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/client"
 	"github.com/go-git/go-git/v5"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 // runFuzzingCycles runs an infinite loop of fuzzing cycles. Each cycle consists
@@ -28,9 +27,11 @@ import (
 //  6. Uploading the updated corpus and reports to the S3 bucket.
 //
 // The loop repeats until the parent context is canceled. Errors in cloning or
-// target discovery are returned immediately.
+// target discovery are returned immediately. In coordinator mode, the fuzzing
+// runs are handed to agents through the given lease board, which is nil in
+// standalone mode.
 func runFuzzingCycles(ctx context.Context, logger *slog.Logger,
-	cfg *Config) error {
+	cfg *Config, board *leaseBoard) error {
 
 	// A non-positive number of iterations indicates we should run forever.
 	// Otherwise, run for the specified number of iterations.
@@ -65,6 +66,10 @@ func runFuzzingCycles(ctx context.Context, logger *slog.Logger,
 			return err
 		}
 
+		// Use the project's go.work file (if any) for every go command
+		// run inside the project.
+		cfg.Project.GoWork = detectGoWork(cfg.Project.SrcDir)
+
 		// 2. Download corpus and reports from S3 bucket.
 		s3s, err := NewS3Store(ctx, logger, cfg)
 		if err != nil {
@@ -102,7 +107,7 @@ func runFuzzingCycles(ctx context.Context, logger *slog.Logger,
 
 		// Launch the fuzz worker scheduler as a goroutine.
 		go scheduleFuzzing(schedulerCtx, logger, cfg, errChan,
-			shouldMinimizeCorpus)
+			shouldMinimizeCorpus, board)
 
 		// Set up the grace period for all workers to finish their
 		// tasks.
@@ -169,85 +174,119 @@ func runFuzzingCycles(ctx context.Context, logger *slog.Logger,
 //   - A worker returns an error (errgroup will cancel the others).
 //   - The cycle context (ctx) is canceled.
 //
-// Returns an error if any worker fails.
+// Returns an error if any worker fails. If board is not nil, the workers hand
+// the fuzzing runs to agents through it instead of running local containers.
 func scheduleFuzzing(ctx context.Context, logger *slog.Logger, cfg *Config,
-	errChan chan error, shouldMinimizeCorpus bool) {
+	errChan chan error, shouldMinimizeCorpus bool, board *leaseBoard) {
 
 	logger.Info("Starting fuzzing scheduler", "startTime", time.Now().
 		Format(time.RFC1123))
 
-	// Discover fuzz targets, and create the binary, build the task queue
-	// and master state.
+	// Resolve the configured package paths into packages and the modules
+	// they belong to.
+	pkgs, err := discoverPackages(cfg.Project.SrcDir, cfg.Fuzz.PkgsPath)
+	if err != nil {
+		errChan <- fmt.Errorf("failed to resolve packages: %w", err)
+		return
+	}
+
+	// Discover fuzz targets, and create the binary, collect the tasks and
+	// build the master state.
 	states := []TargetState{}
-	taskQueue := NewTaskQueue()
-	for _, pkgPath := range cfg.Fuzz.PkgsPath {
-		targets, err := listFuzzTargets(ctx, logger, cfg, pkgPath)
+	tasks := []Task{}
+	images := []string{}
+	for _, pkg := range pkgs {
+		// Determine the Go versions the package's targets are built
+		// and run with.
+		goVersions, err := resolveGoVersions(cfg, pkg)
+		if err != nil {
+			errChan <- fmt.Errorf("failed to resolve Go toolchain "+
+				"for package %q: %w", pkg.Path, err)
+			return
+		}
+
+		targets, err := listFuzzTargets(ctx, logger, cfg, pkg,
+			goVersions[0])
 		if err != nil {
 			logger.Error("Failed to list fuzz targets", "package",
-				pkgPath)
+				pkg.Path, "module", pkg.ModulePath)
 			errChan <- err
 			return
 		}
 
 		// Path to the testdata directory inside the package, which
 		// must be copied after creating the target's binary.
-		srcTestDataPath := filepath.Join(cfg.Project.SrcDir, pkgPath,
+		srcTestDataPath := filepath.Join(cfg.Project.SrcDir, pkg.Path,
 			"testdata")
 
 		for _, target := range targets {
-			// Create the fuzz binary for this target, to execute
-			// them inside a Docker container.
-			err := createFuzzBinary(ctx, logger, cfg, pkgPath,
-				target)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to create fuzz "+
-					"binary: %w", err)
-				return
-			}
-
-			// Copy the testdata directory for the given package
-			// into the fuzz binary path, so that tests depending on
-			// files from the testdata directory can fetch them
-			// properly.
-			//
-			// NOTE: We assume that all files needed by tests are
-			// placed under testdata/. If a test depends on files
-			// outside of testdata, those files will be ignored,
-			// which may cause GCF to report false positive errors,
-			// which GCF considers perfectly reasonable.
-			//
-			// NOTE: We need to copy the testdata into each target's
-			// directory because we can never be sure which tests
-			// will use which part of the testdata directory.
-			destTestDataPath := filepath.Join(cfg.Project.BinaryDir,
-				pkgPath, target, "testdata")
-			err = copyData(srcTestDataPath, destTestDataPath)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to copy "+
-					"testdata directory: %w", err)
-				return
+			for _, goVersion := range goVersions {
+				task := Task{
+					Package:   pkg,
+					Target:    target,
+					GoVersion: goVersion,
+				}
+
+				// Create the fuzz binary for this target, to
+				// execute them inside a Docker container.
+				err := createFuzzBinary(ctx, logger, cfg, task)
+				if err != nil {
+					errChan <- fmt.Errorf("failed to "+
+						"create fuzz binary: %w", err)
+					return
+				}
+
+				// Copy the testdata directory for the given
+				// package into the fuzz binary path, so that
+				// tests depending on files from the testdata
+				// directory can fetch them properly.
+				//
+				// NOTE: We assume that all files needed by
+				// tests are placed under testdata/. If a test
+				// depends on files outside of testdata, those
+				// files will be ignored, which may cause GCF to
+				// report false positive errors, which GCF
+				// considers perfectly reasonable.
+				//
+				// NOTE: We need to copy the testdata into each
+				// target's directory because we can never be
+				// sure which tests will use which part of the
+				// testdata directory.
+				destTestDataPath := filepath.Join(
+					task.binaryDir(cfg.Project.BinaryDir),
+					"testdata")
+				err = copyData(srcTestDataPath,
+					destTestDataPath)
+				if err != nil {
+					errChan <- fmt.Errorf("failed to copy "+
+						"testdata directory: %w", err)
+					return
+				}
+
+				// Collect all discovered fuzz targets.
+				tasks = append(tasks, task)
+
+				image := targetImage(&cfg.Fuzz, task)
+				if !slices.Contains(images, image) {
+					images = append(images, image)
+				}
 			}
 
-			// Enqueue all discovered fuzz targets.
-			taskQueue.Enqueue(Task{
-				PackagePath: pkgPath,
-				Target:      target,
-			})
-
 			// Append all discovered fuzz targets in master state.
-			states = append(states, TargetState{pkgPath, target})
+			states = append(states, newTargetState(pkg, target))
 		}
 	}
 
-	if taskQueue.Length() == 0 {
+	if len(tasks) == 0 {
 		errChan <- fmt.Errorf("No fuzz targets found; please add " +
 			"some fuzz targets.")
 		return
 	}
 
-	// Calculate the fuzzing time for each fuzz target.
+	// Calculate the fuzzing time for each fuzz target. Every shard of a
+	// sharded target takes the CPUs of its container for that time.
 	perTargetTimeout := calculateFuzzSeconds(cfg.Fuzz.SyncFrequency,
-		cfg.Fuzz.NumWorkers, taskQueue.Length())
+		cfg.Fuzz.NumWorkers, totalSlotTime(&cfg.Fuzz, tasks))
 
 	if perTargetTimeout == 0 {
 		errChan <- fmt.Errorf("invalid fuzz duration: %s",
@@ -258,44 +297,27 @@ func scheduleFuzzing(ctx context.Context, logger *slog.Logger, cfg *Config,
 	logger.Info("Per-target fuzz timeout calculated", "duration",
 		perTargetTimeout)
 
-	// Create a Docker client for running containers.
-	cli, err := client.NewClientWithOpts(client.FromEnv,
-		client.WithAPIVersionNegotiation())
+	// Create the runner of the configured runtime.
+	runner, err := newRunner(logger, cfg)
 	if err != nil {
-		errChan <- fmt.Errorf("failed to start docker client: %w", err)
+		errChan <- err
 		return
 	}
 	defer func() {
-		if err := cli.Close(); err != nil {
-			logger.Error("Failed to stop docker client", "error",
-				err)
+		if err := runner.Close(); err != nil {
+			logger.Error("Failed to close runner", "error", err)
 		}
 	}()
 
-	// Pull the Docker image specified by ContainerImage.
-	reader, err := cli.ImagePull(ctx, ContainerImage,
-		image.PullOptions{})
-	if err != nil {
-		errChan <- fmt.Errorf("failed to pull docker image: %w", err)
-		return
-	}
-	defer func() {
-		err := reader.Close()
+	// Make the container images of the targets available, according to
+	// the pull policy.
+	for _, image := range images {
+		err := ensureImage(ctx, logger, runner, image,
+			cfg.Fuzz.ImagePullPolicy)
 		if err != nil {
-			logger.Error("Failed to close image logs reader",
-				"error", err)
+			errChan <- err
+			return
 		}
-	}()
-
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		logger.Info("Image Pull output", "message", line)
-	}
-	if err := scanner.Err(); err != nil {
-		errChan <- fmt.Errorf("error reading image-pull stream: %w",
-			err)
-		return
 	}
 
 	// Extract the repository name from the source URL and use it to set the
@@ -314,23 +336,64 @@ func scheduleFuzzing(ctx context.Context, logger *slog.Logger, cfg *Config,
 		return
 	}
 
+	// Build the priority task queue from the scheduling history, recent
+	// changes and open crash issues of every target.
+	tracker, err := loadScheduleTracker(cfg.Project.ReportDir,
+		isGoMatrix(cfg))
+	if err != nil {
+		errChan <- fmt.Errorf("loading schedule failed: %w", err)
+		return
+	}
+
+	gh, err := NewGitHubRepo(ctx, logger, runner, cfg)
+	if err != nil {
+		errChan <- fmt.Errorf("error initializing GitHub client: %w",
+			err)
+		return
+	}
+	modulePaths := projectModulePaths(pkgs)
+	gh.modulePaths = modulePaths
+
+	cycleReport := newCycleReport(configRedactor(cfg))
+	taskQueue := buildTaskQueue(logger, cfg, tasks, tracker, gh,
+		cycleReport)
+
+	// Every worker contributes a CPU to the containers of the targets.
+	slots := semaphore.NewWeighted(slotCapacity(&cfg.Fuzz))
+
 	// Make sure to cancel all workers if any single worker errors.
 	g, workerCtx := errgroup.WithContext(ctx)
 	wg := &WorkerGroup{
 		ctx:                  workerCtx,
 		logger:               logger,
 		goGroup:              g,
-		cli:                  cli,
+		runner:               runner,
 		cfg:                  cfg,
 		taskQueue:            taskQueue,
 		taskTimeout:          perTargetTimeout,
 		shouldMinimizeCorpus: shouldMinimizeCorpus,
+		schedule:             tracker,
+		retrier:              newRetrier(logger, cfg),
+		cycleReport:          cycleReport,
+		modulePaths:          modulePaths,
+		slots:                slots,
+		remote:               board,
 	}
 
 	// Start and wait for all workers to finish or for the first
 	// error/cancellation.
-	if err := wg.WorkersStartAndWait(cfg.Fuzz.NumWorkers); err != nil {
-		errChan <- fmt.Errorf("fuzzing process failed: %w", err)
+	// Containers with a small CPU share may run more containers at once
+	// than there are workers.
+	workersErr := wg.WorkersStartAndWait(workerCount(&cfg.Fuzz, tasks))
+
+	// Save the cycle report before reporting the outcome, so that it is
+	// uploaded along with the other reports.
+	if err := cycleReport.save(cfg.Project.ReportDir); err != nil {
+		logger.Error("Failed to save cycle report", "error", err)
+	}
+
+	if workersErr != nil {
+		errChan <- fmt.Errorf("fuzzing process failed: %w", workersErr)
 		return
 	}
 
@@ -338,19 +401,76 @@ func scheduleFuzzing(ctx context.Context, logger *slog.Logger, cfg *Config,
 	errChan <- nil
 }
 
-// createFuzzBinary builds a fuzz test binary for the specified package and
-// target. The binary is cross-compiled for Linux/amd64 to ensure compatibility
-// with the Docker container environment. The resulting binary is placed in the
-// configured binary directory.
+// buildTaskQueue computes the priority of every task, enqueues them into a new
+// priority task queue, aging each from when its target was last fuzzed, and
+// records the resulting ordering in the logs and the cycle report, along with
+// the metrics of the tasks' last cycle.
+func buildTaskQueue(logger *slog.Logger, cfg *Config, tasks []Task,
+	tracker *scheduleTracker, gh *GitHubRepo,
+	cycleReport *CycleReport) *TaskQueue {
+
+	factors := prioritizeTasks(logger, cfg, tasks, tracker, gh)
+
+	taskQueue := NewTaskQueue(cfg.Fuzz.AgingWeight)
+	factorsByTask := make(map[Task]priorityFactors, len(tasks))
+	for i, task := range tasks {
+		taskQueue.Enqueue(task, computePriority(&cfg.Fuzz, factors[i]),
+			tracker.lastFuzzed(task))
+		factorsByTask[task] = factors[i]
+	}
+
+	ordered, priorities := taskQueue.Ordering()
+	for i, task := range ordered {
+		f := factorsByTask[task]
+		queued := QueuedTarget{
+			PkgPath:         task.Package.Path,
+			Target:          task.Target,
+			GoVersion:       task.GoVersion,
+			Priority:        priorities[i],
+			Weight:          f.Weight,
+			DaysSinceFuzzed: f.DaysSinceFuzzed,
+			Changed:         f.Changed,
+			OpenIssue:       f.OpenIssue,
+			Discovering:     f.Discovering,
+		}
+
+		var execsPerSec int64
+		metrics, ok := tracker.lastMetrics(task)
+		if ok {
+			queued.LastMetrics = &metrics
+			execsPerSec = metrics.Final.ExecsPerSec
+		}
+
+		logger.Info("Task queue order", "position", i+1, "package",
+			task.Package.Path, "target", task.Target, "goVersion",
+			task.GoVersion, "priority", priorities[i], "weight",
+			f.Weight, "daysSinceFuzzed", f.DaysSinceFuzzed,
+			"changed", f.Changed, "openIssue", f.OpenIssue,
+			"discovering", f.Discovering, "lastExecsPerSec",
+			execsPerSec)
+
+		cycleReport.TaskOrder = append(cycleReport.TaskOrder, queued)
+	}
+
+	return taskQueue
+}
+
+// createFuzzBinary builds the fuzz test binary of the given task. The binary
+// is cross-compiled for Linux/amd64 to ensure compatibility with the Docker
+// container environment, using the task's Go version. The resulting binary is
+// placed in the task's binary directory.
 func createFuzzBinary(ctx context.Context, logger *slog.Logger, cfg *Config,
-	pkg, target string) error {
+	task Task) error {
+
+	pkg, target := task.Package, task.Target
 
-	logger.Info("Building fuzz binary", "package", pkg, "target", target)
+	logger.Info("Building fuzz binary", "package", pkg.Path, "module",
+		pkg.ModulePath, "target", target, "goVersion", task.GoVersion)
 
-	// Construct the absolute path to the package and binary directory
+	// Construct the absolute path to the module root and binary directory
 	// within the temporary workspace directory.
-	pkgPath := filepath.Join(cfg.Project.SrcDir, pkg)
-	fuzzBinaryPath := filepath.Join(cfg.Project.BinaryDir, pkg, target,
+	modulePath := pkg.moduleRootPath(cfg.Project.SrcDir)
+	fuzzBinaryPath := filepath.Join(task.binaryDir(cfg.Project.BinaryDir),
 		fmt.Sprintf("%s.test", target))
 
 	// Prepare the command and environment to build the fuzz binary.
@@ -367,43 +487,48 @@ func createFuzzBinary(ctx context.Context, logger *slog.Logger, cfg *Config,
 	// Compile the test binary but do not run it. This is required so
 	// we can later run the binary directly in Docker container.
 	cmd := []string{"test", fmt.Sprintf("-fuzz=^%s$", target),
-		"-o", fuzzBinaryPath, "-c"}
+		"-o", fuzzBinaryPath, "-c", pkg.RelPath()}
 
-	// Run the go test command with GOOS and GOARCH set to build a
-	// linux/amd64 binary.
+	// Run the go test command from the module root with GOOS and GOARCH
+	// set to build a linux/amd64 binary.
 	//
 	// GOOS is the target operating system (here "linux"), and GOARCH
 	// is the target architecture (here "amd64"). These values control
 	// the environment for the go toolchain when building and testing.
-	_, err := runGoCommand(ctx, pkgPath, cmd, "GOOS=linux", "GOARCH=amd64")
+	env := append(goEnv(cfg, task.GoVersion), "GOOS=linux", "GOARCH=amd64")
+	_, err := runGoCommand(ctx, modulePath, cmd, env...)
 	if err != nil {
-		return fmt.Errorf("go test failed for %q: %w ", pkg, err)
+		return fmt.Errorf("go test failed for %q: %w ", pkg.Path, err)
 	}
 
 	return nil
 }
 
 // listFuzzTargets discovers and returns a list of fuzz targets for the given
-// package. It uses "go test -list=^Fuzz" to list the functions and filters
-// those that start with "Fuzz".
+// package. It uses "go test -list=^Fuzz" from the package's module root, with
+// the given Go version, to list the functions and filters those that start
+// with "Fuzz".
 func listFuzzTargets(ctx context.Context, logger *slog.Logger, cfg *Config,
-	pkg string) ([]string, error) {
+	pkg GoPackage, goVersion string) ([]string, error) {
 
-	logger.Info("Discovering fuzz targets", "package", pkg)
+	logger.Info("Discovering fuzz targets", "package", pkg.Path, "module",
+		pkg.ModulePath)
 
-	// Construct the absolute path to the package directory within the
-	// temporary project directory.
-	pkgPath := filepath.Join(cfg.Project.SrcDir, pkg)
+	// Construct the absolute path to the module root within the temporary
+	// project directory.
+	modulePath := pkg.moduleRootPath(cfg.Project.SrcDir)
 
 	// Prepare the command to list all test functions matching the pattern
 	// "^Fuzz". This leverages go's testing tool to identify fuzz targets.
 	//
 	// Execute the command and check for errors, when the context wasn't
 	// canceled.
-	cmd := []string{"test", "-list=^Fuzz", "."}
-	output, err := runGoCommand(ctx, pkgPath, cmd)
+	cmd := []string{"test", "-list=^Fuzz", pkg.RelPath()}
+	output, err := runGoCommand(ctx, modulePath, cmd,
+		goEnv(cfg, goVersion)...)
 	if err != nil && ctx.Err() == nil {
-		return nil, fmt.Errorf("go test failed for %q: %w ", pkg, err)
+		return nil, fmt.Errorf("go test failed for %q: %w ", pkg.Path,
+			err)
 	}
 
 	// targets holds the names of discovered fuzz targets.
@@ -421,7 +546,7 @@ func listFuzzTargets(ctx context.Context, logger *slog.Logger, cfg *Config,
 
 	// If no fuzz targets are found, log a warning to inform the user.
 	if len(targets) == 0 {
-		logger.Warn("No valid fuzz targets found", "package", pkg)
+		logger.Warn("No valid fuzz targets found", "package", pkg.Path)
 	}
 
 	return targets, nil
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// errShardCrashed is returned by a shard whose fuzz target crashed, to stop the
+// other shards of the target.
+var errShardCrashed = errors.New("shard crashed")
+
+// targetShards returns the configured number of parallel shards of the given
+// target, which defaults to 1.
+func targetShards(fuzz *Fuzz, pkg, target string) int {
+	if shards, ok := fuzz.TargetShards[targetKey(pkg, target)]; ok {
+		return shards
+	}
+
+	return 1
+}
+
+// shardGroup runs the shards of a sharded fuzz target. Each shard fuzzes in its
+// own container with its own fuzz cache directory. Shards restart every sync
+// interval, and exchange their new interesting inputs through the target's
+// corpus directory in between, since the fuzzer only loads its corpus at
+// startup.
+type shardGroup struct {
+	wg   *WorkerGroup
+	task Task
+
+	// corpusDir is the target's corpus directory, into which the shard
+	// corpora are merged.
+	corpusDir string
+
+	// shardRoot is the directory holding the fuzz cache directories of the
+	// shards.
+	shardRoot string
+
+	// mu serializes the exchanges with the target's corpus directory.
+	mu sync.Mutex
+
+	// crash is the crash found by the first shard whose target crashed.
+	crash *fuzzCrash
+}
+
+// runShards fuzzes the task's target with the given number of parallel shards
+// until one of them crashes or fuzzCtx is done, and merges the shard corpora
+// into the target's corpus at hostCorpusPath. It returns the crash found, if
+// any.
+func (wg *WorkerGroup) runShards(fuzzCtx context.Context, task Task,
+	hostCorpusPath string, shards int) (*fuzzCrash, error) {
+
+	s := &shardGroup{
+		wg:        wg,
+		task:      task,
+		corpusDir: filepath.Join(hostCorpusPath, task.Target),
+		shardRoot: task.binaryDir(wg.cfg.Project.ShardDir),
+	}
+	defer func() {
+		if err := os.RemoveAll(s.shardRoot); err != nil {
+			wg.logger.Error("shard cleanup failed", "error", err)
+		}
+	}()
+
+	// Stop every shard as soon as one of them fails or crashes.
+	g, ctx := errgroup.WithContext(fuzzCtx)
+	for shard := range shards {
+		g.Go(func() error {
+			return s.runShard(ctx, shard)
+		})
+	}
+
+	err := g.Wait()
+	if errors.Is(err, errShardCrashed) {
+		return s.crash, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// runShard runs a single shard in periods of the shard sync interval until the
+// fuzz target crashes or ctx is done, exchanging new interesting inputs with
+// the target's corpus before and after every period.
+func (s *shardGroup) runShard(ctx context.Context, shard int) error {
+	logger := s.wg.logger.With("package", s.task.Package.Path).With(
+		"target", s.task.Target).With("shard", shard)
+
+	cacheDir := filepath.Join(s.shardRoot, strconv.Itoa(shard))
+	shardCorpus := filepath.Join(cacheDir, s.task.Target)
+	if err := EnsureDirExists(shardCorpus); err != nil {
+		return err
+	}
+
+	for period := 0; ; period++ {
+		if err := s.exchange(logger, shardCorpus); err != nil {
+			return err
+		}
+
+		// Restarting the shard for only a few seconds of fuzzing is
+		// pointless.
+		remaining := remainingFuzzTime(ctx)
+		if ctx.Err() != nil || remaining == 0 ||
+			(period > 0 && remaining < MinRestartTime) {
+
+			return nil
+		}
+
+		duration := min(s.wg.cfg.Fuzz.ShardSyncInterval, remaining)
+		periodCtx, cancel := context.WithTimeout(ctx, duration+
+			ContainerGracePeriod)
+		crash, err := s.wg.runFuzzContainer(periodCtx, s.task, cacheDir,
+			shard)
+		cancel()
+
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("shard %d: %w", shard, err)
+		}
+
+		if crash != nil {
+			// Keep the shard's inputs found before the crash.
+			if err := s.exchange(logger, shardCorpus); err != nil {
+				return err
+			}
+
+			s.mu.Lock()
+			if s.crash == nil {
+				s.crash = crash
+			}
+			s.mu.Unlock()
+
+			return errShardCrashed
+		}
+	}
+}
+
+// exchange merges the shard's new interesting inputs into the target's corpus,
+// and the inputs found by the other shards into the shard's corpus.
+func (s *shardGroup) exchange(logger *slog.Logger, shardCorpus string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := EnsureDirExists(s.corpusDir); err != nil {
+		return err
+	}
+
+	pushed, err := mergeCorpusDir(s.corpusDir, shardCorpus)
+	if err != nil {
+		return fmt.Errorf("merging shard corpus: %w", err)
+	}
+	pulled, err := mergeCorpusDir(shardCorpus, s.corpusDir)
+	if err != nil {
+		return fmt.Errorf("syncing shard corpus: %w", err)
+	}
+
+	logger.Info("Exchanged shard corpus inputs", "pushed", pushed,
+		"pulled", pulled)
+
+	return nil
+}
+
+// mergeCorpusDir copies the corpus inputs of srcDir that dstDir does not hold
+// yet into dstDir, and returns the number of copied inputs. Inputs are
+// deduplicated by content. An input whose name is taken by a different input
+// in dstDir is stored under the name the fuzzer derives from its content.
+func mergeCorpusDir(dstDir, srcDir string) (int, error) {
+	known := make(map[[sha256.Size]byte]bool)
+	names := make(map[string]bool)
+
+	dstEntries, err := os.ReadDir(dstDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range dstEntries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dstDir, entry.Name()))
+		if err != nil {
+			return 0, err
+		}
+		known[sha256.Sum256(data)] = true
+		names[entry.Name()] = true
+	}
+
+	srcEntries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for _, entry := range srcEntries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(srcDir, entry.Name()))
+		if err != nil {
+			return copied, err
+		}
+
+		sum := sha256.Sum256(data)
+		if known[sum] {
+			continue
+		}
+
+		name := entry.Name()
+		if names[name] {
+			name = ComputeSHA256Short(string(data))
+		}
+
+		err = writeFileAtomic(bytes.NewReader(data),
+			filepath.Join(dstDir, name), 0644)
+		if err != nil {
+			return copied, err
+		}
+
+		known[sum] = true
+		names[name] = true
+		copied++
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMergeCorpusDir verifies that merging a shard corpus copies only the
+// inputs the destination does not hold yet, deduplicated by content, and keeps
+// inputs whose name is taken by a different input under their content name.
+func TestMergeCorpusDir(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"dst/a":       "input a",
+		"dst/b":       "input b",
+		"src/a":       "input a",
+		"src/copy-b":  "input b",
+		"src/b":       "other input b",
+		"src/c":       "input c",
+		"src/sub/bad": "not an input",
+	})
+	dst := filepath.Join(root, "dst")
+	src := filepath.Join(root, "src")
+
+	copied, err := mergeCorpusDir(dst, src)
+	require.NoError(t, err)
+	assert.Equal(t, 2, copied)
+
+	renamed := ComputeSHA256Short("other input b")
+	expected := map[string]string{
+		"a":     "input a",
+		"b":     "input b",
+		"c":     "input c",
+		renamed: "other input b",
+	}
+
+	entries, err := os.ReadDir(dst)
+	require.NoError(t, err)
+	got := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dst, entry.Name()))
+		require.NoError(t, err)
+		got[entry.Name()] = string(data)
+	}
+	assert.Equal(t, expected, got)
+
+	// Merging again copies nothing.
+	copied, err = mergeCorpusDir(dst, src)
+	require.NoError(t, err)
+	assert.Zero(t, copied)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// frameFileRegex matches the line following the function of a stack frame,
+// capturing the file and line of the call.
+//
+// It matches lines like:
+//
+//	"/src/parser/parser.go:42 +0x1d"
+var frameFileRegex = regexp.MustCompile(
+	`^(?P<file>\S+\.go):(?P<line>[0-9]+)(?: \+0x[0-9a-f]+)?$`,
+)
+
+// StackFrame is a frame of the stack trace of a crash.
+type StackFrame struct {
+	// Function is the fully qualified function, such as
+	// example.com/parser.(*Parser).parse.
+	Function string
+
+	// File is the base name of the source file of the call.
+	File string
+
+	// Line is the line of the call.
+	Line int
+}
+
+// String formats the frame as used in crash signatures.
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+}
+
+// inModules reports whether the frame is in a package of one of the given
+// modules, such as those of the fuzzed project, rather than in the standard
+// library, which holds the runtime, the testing package and the fuzzing
+// harness, or in a dependency.
+func (f StackFrame) inModules(modulePaths []string) bool {
+	pkg := f.Function
+	slash := strings.LastIndex(pkg, "/")
+	if dot := strings.Index(pkg[slash+1:], "."); dot >= 0 {
+		pkg = pkg[:slash+1+dot]
+	}
+
+	for _, mod := range modulePaths {
+		if pkg == mod || strings.HasPrefix(pkg, mod+"/") ||
+			strings.HasPrefix(pkg, mod+"_test") {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxStackFrames bounds the frames kept of a stack trace. The Go runtime prints
+// at most 100 frames per goroutine.
+const maxStackFrames = 100
+
+// stackParser extracts the frames of the first stack trace in the output of a
+// crash: the goroutine that panicked or faulted, or the access reported first
+// by the race detector. The frames of the project are picked from them when
+// the signature of the crash is built, since only the daemon knows the modules
+// of the project.
+type stackParser struct {
+	// function is the function of the frame whose file line is expected
+	// next.
+	function string
+
+	// frames are the frames parsed so far, top first, and seen reports
+	// whether the trace started.
+	frames []StackFrame
+	seen   bool
+
+	// done reports whether the first stack trace ended.
+	done bool
+}
+
+// observe parses an output line as part of a stack trace.
+func (p *stackParser) observe(line string) {
+	if p.done {
+		return
+	}
+	line = strings.TrimSpace(line)
+
+	if m := frameFileRegex.FindStringSubmatch(line); m != nil &&
+		p.function != "" {
+
+		frame := StackFrame{Function: p.function, File: path.Base(m[1])}
+		frame.Line, _ = strconv.Atoi(m[2])
+		p.function = ""
+		p.seen = true
+
+		if len(p.frames) < maxStackFrames {
+			p.frames = append(p.frames, frame)
+		}
+		return
+	}
+
+	if function := frameFunction(line); function != "" {
+		p.function = function
+		return
+	}
+
+	// Any other line ends the trace once it started.
+	p.function = ""
+	if p.seen {
+		p.done = true
+	}
+}
+
+// frameFunction returns the function of a line holding the function of a stack
+// frame, without its arguments, or an empty string for other lines.
+//
+// It matches lines like:
+//
+//	"example.com/parser.(*Parser).parse(0xc000010000, {0xc00001, 0x3, 0x3})"
+func frameFunction(line string) string {
+	if !strings.HasSuffix(line, ")") || strings.ContainsAny(line, " \t") &&
+		!strings.Contains(line, "(") {
+
+		return ""
+	}
+
+	// Find the opening parenthesis of the arguments, past those of method
+	// receivers such as (*Parser).
+	depth := 0
+	for i := len(line) - 1; i >= 0; i-- {
+		switch line[i] {
+		case ')':
+			depth++
+
+		case '(':
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			function := line[:i]
+			if function == "" || strings.ContainsAny(function,
+				" \t") {
+
+				return ""
+			}
+			return function
+		}
+	}
+
+	return ""
+}
+
+// SignatureOptions configure the crash signatures built from stack traces.
+type SignatureOptions struct {
+	// Depth is the number of topmost project frames in a signature.
+	Depth int
+
+	// IgnoreLines leaves the line numbers out of the frames, so that
+	// edits moving the code keep the signatures of its crashes.
+	IgnoreLines bool
+
+	// ModulePaths are the paths of the modules of the fuzzed project, as
+	// declared in their go.mod files. Only the frames of their packages
+	// are project frames.
+	ModulePaths []string
+}
+
+// signatureOptions returns the options of the crash signatures of a project
+// with the given modules.
+func signatureOptions(fuzz *Fuzz, modulePaths []string) SignatureOptions {
+	return SignatureOptions{
+		Depth:       fuzz.SignatureDepth,
+		IgnoreLines: fuzz.SignatureIgnoreLines,
+		ModulePaths: modulePaths,
+	}
+}
+
+// projectModulePaths returns the paths of the modules of the given packages,
+// each once and sorted.
+func projectModulePaths(pkgs []GoPackage) []string {
+	var paths []string
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.ModulePath)
+	}
+	slices.Sort(paths)
+
+	return slices.Compact(paths)
+}
+
+// stackSignature returns the part of a crash signature identifying the project
+// frames among the given ones, or an empty string if there are none.
+func stackSignature(frames []StackFrame, opts SignatureOptions) string {
+	frames = slices.DeleteFunc(slices.Clone(frames),
+		func(f StackFrame) bool {
+			return !f.inModules(opts.ModulePaths)
+		})
+	if opts.Depth > 0 && len(frames) > opts.Depth {
+		frames = frames[:opts.Depth]
+	}
+
+	parts := make([]string, len(frames))
+	for i, frame := range frames {
+		if opts.IgnoreLines {
+			parts[i] = frame.Function + " " + frame.File
+		} else {
+			parts[i] = frame.String()
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
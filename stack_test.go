@@ -0,0 +1,201 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// workerPanicOutput returns the failure report of a fuzz worker that panicked
+// in parseHeader, called from the given line of the fuzz target.
+func workerPanicOutput(targetLine string) string {
+	return "        testing.go:1591: panic: runtime error: index out of " +
+		"range [3] with length 3\n" +
+		"            goroutine 17 [running]:\n" +
+		"            runtime/debug.Stack()\n" +
+		"            \t/usr/local/go/src/runtime/debug/stack.go:26 " +
+		"+0x5e\n" +
+		"            testing.tRunner.func1()\n" +
+		"            \t/usr/local/go/src/testing/testing.go:1591 " +
+		"+0x1c8\n" +
+		"            panic({0x5c2f00?, 0xc0000a8018?})\n" +
+		"            \t/usr/local/go/src/runtime/panic.go:785 " +
+		"+0x132\n" +
+		"            example.com/proj/parser.parseHeader(...)\n" +
+		"            \t/work/proj/parser/parser.go:42\n" +
+		"            example.com/proj/parser.(*Parser).Parse(" +
+		"0xc000010000, {0xc000012345, 0x3, 0x8})\n" +
+		"            \t/work/proj/parser/parser.go:17 +0x1d\n" +
+		"            example.com/proj/parser.FuzzParse.func1(0x0?, " +
+		"{0xc000012345, 0x3, 0x8})\n" +
+		"            \t/work/proj/parser/parser_test.go:" +
+		targetLine + " +0x3c\n" +
+		"            reflect.Value.call({0x5b1f20?, 0x5fe0a8?, " +
+		"0x13?}, {0x5f3e8a, 0x4}, {0xc0000b6150, 0x2, 0x2?})\n" +
+		"            \t/usr/local/go/src/reflect/value.go:581 " +
+		"+0xca6\n" +
+		"            testing.(*F).Fuzz.func1.1(0xc0000bc340?)\n" +
+		"            \t/usr/local/go/src/testing/fuzz.go:322 +0x49c\n" +
+		"            created by testing.(*F).Fuzz.func1 in " +
+		"goroutine 8\n" +
+		"            \t/usr/local/go/src/testing/fuzz.go:309 +0x5b7\n" +
+		"    \n" +
+		"    Failing input written to testdata/fuzz/FuzzParse/" +
+		"5e8c2d0f1a3b4c6d\n"
+}
+
+// parseStack returns the frames of the first stack trace in output.
+func parseStack(output string) []StackFrame {
+	var p stackParser
+	for _, line := range strings.Split(output, "\n") {
+		p.observe(line)
+	}
+
+	return p.frames
+}
+
+// TestStackParser verifies that the frames of the first stack trace are
+// extracted from the output of a crash, without the traces following it.
+func TestStackParser(t *testing.T) {
+	frames := parseStack(workerPanicOutput("11"))
+	require.Len(t, frames, 8)
+	assert.Equal(t, StackFrame{
+		Function: "runtime/debug.Stack",
+		File:     "stack.go",
+		Line:     26,
+	}, frames[0])
+	assert.Equal(t, []StackFrame{{
+		Function: "example.com/proj/parser.parseHeader",
+		File:     "parser.go",
+		Line:     42,
+	}, {
+		Function: "example.com/proj/parser.(*Parser).Parse",
+		File:     "parser.go",
+		Line:     17,
+	}, {
+		Function: "example.com/proj/parser.FuzzParse.func1",
+		File:     "parser_test.go",
+		Line:     11,
+	}}, frames[3:6])
+
+	race := "WARNING: DATA RACE\n" +
+		"Write at 0x00c000012345 by goroutine 8:\n" +
+		"  main.(*counter).inc()\n" +
+		"      /work/cmd/counter.go:12 +0x44\n" +
+		"  sync.(*Once).Do()\n" +
+		"      /usr/local/go/src/sync/once.go:74 +0x12\n" +
+		"\n" +
+		"Previous write at 0x00c000012345 by goroutine 7:\n" +
+		"  main.(*counter).reset()\n" +
+		"      /work/cmd/counter.go:20 +0x44\n"
+	assert.Equal(t, []StackFrame{{
+		Function: "main.(*counter).inc",
+		File:     "counter.go",
+		Line:     12,
+	}, {
+		Function: "sync.(*Once).Do",
+		File:     "once.go",
+		Line:     74,
+	}}, parseStack(race))
+
+	assert.Empty(t, parseStack("    stringutils_test.go:17: invalid\n"))
+}
+
+// TestStackFrameInModules verifies that only the frames of the packages of the
+// project's modules are project frames, whether or not their paths have a dot,
+// and not those of the standard library or of dependencies.
+func TestStackFrameInModules(t *testing.T) {
+	modules := []string{"example.com/proj", "tools"}
+
+	tests := []struct {
+		function string
+		want     bool
+	}{
+		{"example.com/proj.Parse", true},
+		{"example.com/proj/parser.(*Parser).Parse", true},
+		{"example.com/proj_test.FuzzParse.func1", true},
+		{"tools/gen.Generate", true},
+		{"example.com/project.Parse", false},
+		{"github.com/dep/lib.Decode", false},
+		{"golang.org/x/text/unicode.Norm", false},
+		{"testing.tRunner.func1", false},
+		{"main.main", false},
+	}
+
+	for _, tt := range tests {
+		frame := StackFrame{Function: tt.function}
+		assert.Equal(t, tt.want, frame.inModules(modules), tt.function)
+	}
+}
+
+// TestStackSignature verifies that crash signatures are built from the topmost
+// project frames, so that the same bug reached through different lines of the
+// fuzz target is deduplicated with a shallow depth, and that line numbers can
+// be left out.
+func TestStackSignature(t *testing.T) {
+	crash := func(targetLine string) fuzzCrash {
+		output := workerPanicOutput(targetLine)
+		return fuzzCrash{
+			kind:               crashKindPanic,
+			failureFileAndLine: "testing.go:1591",
+			stack:              parseStack(output),
+		}
+	}
+
+	modules := []string{"example.com/proj"}
+	deep := SignatureOptions{Depth: 3, ModulePaths: modules}
+	assert.NotEqual(t, crash("11").signature(deep),
+		crash("12").signature(deep))
+
+	shallow := SignatureOptions{Depth: 2, ModulePaths: modules}
+	assert.Equal(t, crash("11").signature(shallow),
+		crash("12").signature(shallow))
+	assert.Equal(t, ComputeSHA256Short("panic:"+
+		"example.com/proj/parser.parseHeader parser.go:42\n"+
+		"example.com/proj/parser.(*Parser).Parse parser.go:17"),
+		crash("11").signature(shallow))
+
+	noLines := SignatureOptions{Depth: 1, IgnoreLines: true,
+		ModulePaths: modules}
+	assert.Equal(t, ComputeSHA256Short("panic:"+
+		"example.com/proj/parser.parseHeader parser.go"),
+		crash("11").signature(noLines))
+
+	// Crashes without a stack trace fall back to the location of the
+	// first error.
+	assert.Equal(t, ComputeSHA256Short("stringutils_test.go:17"),
+		fuzzCrash{failureFileAndLine: "stringutils_test.go:17"}.
+			signature(deep))
+}
+
+// TestLegacyCrashIDs verifies that crashes are also looked up under the titles
+// their issues had before signatures were built from stack traces, identified
+// by the location of the first error, and before crashes were classified,
+// as plain failures except for out-of-memory and hang crashes.
+func TestLegacyCrashIDs(t *testing.T) {
+	gh := &GitHubRepo{cfg: &Config{}}
+	task := Task{Package: GoPackage{Path: "parser"}, Target: "FuzzParse"}
+
+	panicked := fuzzCrash{
+		kind:               crashKindPanic,
+		failureFileAndLine: "testing.go:1591",
+		stack:              parseStack(workerPanicOutput("11")),
+	}
+	ids := panicked.legacyIDs()
+	require.Len(t, ids, 2)
+	assert.Equal(t, "[fuzz/"+ComputeSHA256Short("panic:testing.go:1591")+
+		"] [panic] Fuzzing crash in parser/FuzzParse", gh.crashTitle(
+		task, ids[0]))
+	assert.Equal(t, "[fuzz/"+ComputeSHA256Short("testing.go:1591")+
+		"] Fuzzing crash in parser/FuzzParse", gh.crashTitle(task,
+		ids[1]))
+
+	oom := fuzzCrash{kind: crashKindOOM, failureFileAndLine: "a.go:3"}
+	ids = oom.legacyIDs()
+	require.Len(t, ids, 1)
+	assert.Equal(t, "[fuzz/"+ComputeSHA256Short("oom:a.go:3")+
+		"] [oom] Fuzzing crash in parser/FuzzParse", gh.crashTitle(task,
+		ids[0]))
+}
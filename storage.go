@@ -10,14 +10,21 @@ import (
 	"mime"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// maxDeleteObjects is the maximum number of objects deleted by a single S3
+// DeleteObjects request.
+const maxDeleteObjects = 1000
+
 // S3Store encapsulates the configuration and state needed to manage S3‑backed
 // operations, including context, logger, S3 client configuration, local
 // corpus/reports directory and ZIP file handling.
@@ -30,6 +37,10 @@ type S3Store struct {
 	corpusDir string
 	reportDir string
 	zipPath   string
+
+	// logRetention is how long run logs are kept in the bucket; zero
+	// keeps them forever.
+	logRetention time.Duration
 }
 
 // NewS3Store constructs a S3Store for the given context, logger, and config.
@@ -50,6 +61,8 @@ func NewS3Store(ctx context.Context, logger *slog.Logger,
 		corpusDir: cfg.Project.CorpusDir,
 		reportDir: cfg.Project.ReportDir,
 		zipPath:   fmt.Sprintf("%s.zip", cfg.Project.CorpusDir),
+
+		logRetention: cfg.Fuzz.LogRetention,
 	}, nil
 }
 
@@ -331,6 +344,13 @@ func (s3s *S3Store) uploadCorpusAndReports(lastMinTime time.Time) error {
 
 	s3s.logger.Info("Successfully uploaded reports", "s3Bucket", s3s.bucket)
 
+	// Expired run logs only take up space, so failing to delete them is
+	// not worth failing the cycle for.
+	if err := s3s.pruneRunLogs(); err != nil {
+		s3s.logger.Error("Failed to prune expired run logs", "s3Bucket",
+			s3s.bucket, "error", err)
+	}
+
 	return nil
 }
 
@@ -390,6 +410,12 @@ func (s3s *S3Store) downloadReports() error {
 				continue
 			}
 
+			// Reports of previous cycles are never updated, so
+			// there is no need to download them.
+			if strings.HasPrefix(key, CycleReportDir+"/") {
+				continue
+			}
+
 			localPath := filepath.Join(s3s.reportDir, key)
 			err := EnsureDirExists(filepath.Dir(localPath))
 			if err != nil {
@@ -448,6 +474,65 @@ func (s3s *S3Store) uploadReports() error {
 	})
 }
 
+// pruneRunLogs deletes the run logs of the cycles older than the log retention
+// from the S3 bucket.
+func (s3s *S3Store) pruneRunLogs() error {
+	if s3s.logRetention == 0 {
+		return nil
+	}
+
+	// Collect the keys of the expired run logs, which are stored below
+	// the ID of their cycle.
+	prefix := RunLogDir + "/"
+	paginator := s3.NewListObjectsV2Paginator(s3s.client,
+		&s3.ListObjectsV2Input{Bucket: &s3s.bucket, Prefix: &prefix})
+
+	now := time.Now()
+	var expired []types.ObjectIdentifier
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(s3s.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list run logs: %w", err)
+		}
+
+		for _, item := range page.Contents {
+			cycleID, _, _ := strings.Cut(strings.TrimPrefix(
+				*item.Key, prefix), "/")
+			if expiredRunLog(cycleID, s3s.logRetention, now) {
+				expired = append(expired,
+					types.ObjectIdentifier{Key: item.Key})
+			}
+		}
+	}
+
+	// Delete them in batches of the maximum number of keys per request.
+	for batch := range slices.Chunk(expired, maxDeleteObjects) {
+		resp, err := s3s.client.DeleteObjects(s3s.ctx,
+			&s3.DeleteObjectsInput{
+				Bucket: &s3s.bucket,
+				Delete: &types.Delete{
+					Objects: batch,
+					Quiet:   aws.Bool(true),
+				},
+			})
+		if err != nil {
+			return fmt.Errorf("failed to delete run logs: %w", err)
+		}
+		if len(resp.Errors) > 0 {
+			return fmt.Errorf("failed to delete run log %q: %s",
+				aws.ToString(resp.Errors[0].Key),
+				aws.ToString(resp.Errors[0].Message))
+		}
+	}
+
+	if len(expired) > 0 {
+		s3s.logger.Info("Pruned expired run logs", "s3Bucket",
+			s3s.bucket, "count", len(expired))
+	}
+
+	return nil
+}
+
 // detectContentType returns the MIME type for filename based on its extension.
 // If the extension is unknown, it defaults to application/octet-stream.
 func detectContentType(filename string) string {
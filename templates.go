@@ -85,6 +85,7 @@ const masterHTML = `<!DOCTYPE html>
       <table>
         <thead>
           <tr>
+            <th>Module</th>
             <th>Package Path</th>
             <th>Target</th>
           </tr>
@@ -92,6 +93,7 @@ const masterHTML = `<!DOCTYPE html>
         <tbody>
           {{- range .Entries }}
           <tr>
+            <td>{{ .ModuleDir }}</td>
             <td>{{ .PkgPath }}</td>
             <td><a href="{{ .LinkFile }}">{{ .Target }}</a></td>
           </tr>
@@ -201,6 +203,8 @@ const targetHTML = `<!DOCTYPE html>
             <th>Date</th>
             <th>Coverage (%)</th>
             <th>Report</th>
+            <th>Run Logs</th>
+            <th>Fuzzing Metrics</th>
           </tr>
         </thead>
         <tbody>
@@ -209,6 +213,19 @@ const targetHTML = `<!DOCTYPE html>
             <td>{{ .Date }}</td>
             <td>{{ .Coverage }}</td>
             <td><a href="{{ .ReportPath }}" target="_blank">View</a></td>
+            <td>
+              {{- range .Logs }}
+              <a href="{{ .Path }}">{{ .Cycle }}/{{ .Name }}</a><br />
+              {{- end }}
+            </td>
+            <td>
+              {{- range .Metrics }}
+              {{ .Cycle }}: {{ .Final.Execs }} execs in
+              {{ .Final.Elapsed }} ({{ .Final.ExecsPerSec }}/sec, peak
+              {{ .Peak.ExecsPerSec }}/sec), {{ .Final.NewInteresting }} new
+              interesting, corpus {{ .Final.TotalCorpus }}<br />
+              {{- end }}
+            </td>
           </tr>
           {{- end }}
         </tbody>
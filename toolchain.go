@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ToolchainLocal selects the toolchain installed on the host for
+	// builds and the configured image for running the fuzz targets.
+	ToolchainLocal = "local"
+
+	// ToolchainGoMod selects the toolchain requested by the go.mod of the
+	// module being fuzzed, using its toolchain directive if present and its
+	// go directive otherwise.
+	ToolchainGoMod = "gomod"
+
+	// ContainerImageRepo is the repository of the official Go images used
+	// to run fuzz targets with a specific Go version.
+	ContainerImageRepo = "golang"
+)
+
+// goVersionRegex matches Go release versions, with or without the "go" prefix,
+// such as "1.24", "go1.24.6" or "1.25rc1".
+var goVersionRegex = regexp.MustCompile(
+	`^(?:go)?(1\.(\d+)(?:\.\d+)?(?:(?:rc|beta)\d+)?)$`,
+)
+
+// normalizeGoVersion validates a Go version and returns it without the "go"
+// prefix. Language versions without a patch release (e.g. "1.24") of Go 1.21
+// and later are mapped to the first release of that version ("1.24.0"), which
+// is the name of the corresponding toolchain.
+func normalizeGoVersion(version string) (string, error) {
+	matches := goVersionRegex.FindStringSubmatch(strings.TrimSpace(version))
+	if matches == nil {
+		return "", fmt.Errorf("invalid Go version %q", version)
+	}
+
+	normalized := matches[1]
+	minor, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid Go version %q: %w", version, err)
+	}
+	if minor >= 21 && strings.Count(normalized, ".") == 1 &&
+		!strings.Contains(normalized, "rc") &&
+		!strings.Contains(normalized, "beta") {
+
+		normalized += ".0"
+	}
+
+	return normalized, nil
+}
+
+// readGoModVersion returns the Go version requested by the given go.mod file.
+// The toolchain directive takes precedence over the go directive.
+func readGoModVersion(goModPath string) (string, error) {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return "", fmt.Errorf("read %q: %w", goModPath, err)
+	}
+
+	var goDirective, toolchainDirective string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "go":
+			goDirective = fields[1]
+		case "toolchain":
+			toolchainDirective = fields[1]
+		}
+	}
+
+	switch {
+	case toolchainDirective != "" && toolchainDirective != "default":
+		// A toolchain name may carry a custom suffix, e.g.
+		// "go1.24.6+auto"; only the version is relevant here.
+		version, _, _ := strings.Cut(toolchainDirective, "+")
+		return normalizeGoVersion(version)
+
+	case goDirective != "":
+		return normalizeGoVersion(goDirective)
+
+	default:
+		return "", fmt.Errorf("no go or toolchain directive found in "+
+			"%q", goModPath)
+	}
+}
+
+// validateToolchainConfig checks the toolchain related options of the fuzz
+// configuration and normalizes the configured versions in place.
+func validateToolchainConfig(fuzz *Fuzz) error {
+	switch fuzz.GoToolchain {
+	case ToolchainLocal, ToolchainGoMod:
+		// Nothing to normalize.
+
+	default:
+		version, err := normalizeGoVersion(fuzz.GoToolchain)
+		if err != nil {
+			return fmt.Errorf("invalid go-toolchain %q: must be "+
+				"%q, %q or a Go version", fuzz.GoToolchain,
+				ToolchainLocal, ToolchainGoMod)
+		}
+		fuzz.GoToolchain = version
+	}
+
+	seen := make(map[string]bool)
+	versions := make([]string, 0, len(fuzz.GoVersions))
+	for _, v := range fuzz.GoVersions {
+		version, err := normalizeGoVersion(v)
+		if err != nil {
+			return fmt.Errorf("invalid go-versions entry: %w", err)
+		}
+		if !seen[version] {
+			seen[version] = true
+			versions = append(versions, version)
+		}
+	}
+	fuzz.GoVersions = versions
+
+	return nil
+}
+
+// isGoMatrix reports whether every target is fuzzed with several Go versions.
+func isGoMatrix(cfg *Config) bool {
+	return len(cfg.Fuzz.GoVersions) > 0
+}
+
+// resolveGoVersions returns the Go versions the targets of the given package
+// must be built and run with. An empty version stands for the local toolchain.
+func resolveGoVersions(cfg *Config, pkg GoPackage) ([]string, error) {
+	if isGoMatrix(cfg) {
+		return cfg.Fuzz.GoVersions, nil
+	}
+
+	switch cfg.Fuzz.GoToolchain {
+	case ToolchainLocal:
+		return []string{""}, nil
+
+	case ToolchainGoMod:
+		goModPath := filepath.Join(pkg.moduleRootPath(
+			cfg.Project.SrcDir), "go.mod")
+		version, err := readGoModVersion(goModPath)
+		if err != nil {
+			return nil, err
+		}
+		return []string{version}, nil
+
+	default:
+		return []string{cfg.Fuzz.GoToolchain}, nil
+	}
+}
+
+// toolchainEnv returns the environment variables that make the go command use
+// the given Go version, downloading the toolchain if needed. The local
+// toolchain (empty version) needs no extra environment.
+func toolchainEnv(goVersion string) []string {
+	if goVersion == "" {
+		return nil
+	}
+
+	return []string{"GOTOOLCHAIN=go" + goVersion}
+}
+
+// containerImageFor returns the container image used to run fuzz targets built
+// with the given Go version: the configured image for the local toolchain, and
+// the official image of the version otherwise.
+func containerImageFor(fuzz *Fuzz, goVersion string) string {
+	if goVersion == "" {
+		return fuzz.Image
+	}
+
+	return fmt.Sprintf("%s:%s", ContainerImageRepo, goVersion)
+}
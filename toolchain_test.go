@@ -0,0 +1,125 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeGoVersion verifies that Go versions are validated and
+// normalized to toolchain versions.
+func TestNormalizeGoVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         string
+		expectedVersion string
+		expectErr       bool
+	}{
+		{
+			name:            "full version",
+			version:         "1.24.6",
+			expectedVersion: "1.24.6",
+		},
+		{
+			name:            "toolchain name",
+			version:         "go1.23.4",
+			expectedVersion: "1.23.4",
+		},
+		{
+			name:            "language version",
+			version:         "1.24",
+			expectedVersion: "1.24.0",
+		},
+		{
+			name:            "language version before go1.21",
+			version:         "1.20",
+			expectedVersion: "1.20",
+		},
+		{
+			name:            "release candidate",
+			version:         "go1.25rc1",
+			expectedVersion: "1.25rc1",
+		},
+		{
+			name:      "invalid version",
+			version:   "latest",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := normalizeGoVersion(tt.version)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVersion, version)
+		})
+	}
+}
+
+// TestReadGoModVersion verifies that the toolchain directive of a go.mod file
+// takes precedence over its go directive.
+func TestReadGoModVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		goMod           string
+		expectedVersion string
+		expectErrMsg    string
+	}{
+		{
+			name:            "go directive only",
+			goMod:           "module example.com/m\n\ngo 1.23\n",
+			expectedVersion: "1.23.0",
+		},
+		{
+			name: "toolchain directive",
+			goMod: "module example.com/m\n\ngo 1.23\n\n" +
+				"toolchain go1.24.6\n",
+			expectedVersion: "1.24.6",
+		},
+		{
+			name: "toolchain directive with suffix",
+			goMod: "module example.com/m\n\ngo 1.23\n\n" +
+				"toolchain go1.24.6+auto\n",
+			expectedVersion: "1.24.6",
+		},
+		{
+			name:         "no directive",
+			goMod:        "module example.com/m\n",
+			expectErrMsg: "no go or toolchain directive found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"go.mod": tt.goMod,
+			})
+
+			version, err := readGoModVersion(filepath.Join(dir,
+				"go.mod"))
+			if tt.expectErrMsg != "" {
+				assert.ErrorContains(t, err, tt.expectErrMsg)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedVersion, version)
+		})
+	}
+}
+
+// TestContainerImageFor verifies the container image selected for a Go
+// version.
+func TestContainerImageFor(t *testing.T) {
+	fuzz := &Fuzz{Image: ContainerImage}
+	assert.Equal(t, ContainerImage, containerImageFor(fuzz, ""))
+	assert.Equal(t, "golang:1.23.4", containerImageFor(fuzz, "1.23.4"))
+}
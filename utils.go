@@ -5,7 +5,10 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"net/url"
 	"os"
@@ -24,10 +27,18 @@ const (
 
 	seedCorpusErrMsg = "Failure occurred while testing the seed corpus; " +
 		"please check the entries added via f.Add."
+
+	// maxIssueBodyLen bounds the length of an issue body, in bytes, below
+	// GitHub's limit of 65,536 characters, leaving room for the notes of
+	// truncated logs.
+	maxIssueBodyLen = 64000
+
+	// truncatedLogNote ends a log truncated to fit into an issue body.
+	truncatedLogNote = "[truncated; see the run log for the full output]\n"
 )
 
-// cleanupTmpDirs deletes the project, corpus, reports, and binaries directory
-// to restart the fuzzing cycle.
+// cleanupTmpDirs deletes the project, corpus, reports, binaries and shards
+// directory to restart the fuzzing cycle.
 func cleanupTmpDirs(logger *slog.Logger, cfg *Config) {
 	if err := os.RemoveAll(cfg.Project.SrcDir); err != nil {
 		logger.Error("project cleanup failed", "error", err)
@@ -44,6 +55,10 @@ func cleanupTmpDirs(logger *slog.Logger, cfg *Config) {
 	if err := os.RemoveAll(cfg.Project.BinaryDir); err != nil {
 		logger.Error("binary cleanup failed", "error", err)
 	}
+
+	if err := os.RemoveAll(cfg.Project.ShardDir); err != nil {
+		logger.Error("shard cleanup failed", "error", err)
+	}
 }
 
 // cleanupWorkspace deletes the temp directory to reset the workspace state.
@@ -150,28 +165,146 @@ func extractRepo(srcURL string) (string, error) {
 	return repo, nil
 }
 
+// formatCrashKind formats the section of a crash report describing the kind of
+// the crash and its detail, or returns an empty string for unclassified
+// failures.
+func formatCrashKind(kind crashKind, detail string) string {
+	if kind == crashKindFailure {
+		return ""
+	}
+
+	section := fmt.Sprintf("## Crash kind\n%s\n", kind.label())
+	if detail != "" {
+		section += fmt.Sprintf("~~~sh\n%s\n~~~\n", detail)
+	}
+
+	return section
+}
+
 // formatCrashReport constructs a markdown-formatted report containing the error
-// logs, the failing test case, and a watermark.
-func formatCrashReport(failingLog, failingInputString string) string {
-	// Build the "Error logs" section.
+// logs, the standard error output of the run (if any), the failing test case,
+// and a watermark. The failing test case is encoded with formatInput, so that
+// any input survives the issue and is bounded in size.
+func formatCrashReport(failingLog, stderrLog,
+	failingInputString string) string {
+
+	// Build the "Error logs" section, followed by the "Standard error"
+	// section.
 	logSection := fmt.Sprintf("## Error logs\n~~~sh\n%s~~~", failingLog)
+	logSection += stderrSection(stderrLog)
 
 	// If a crash occurs but we cannot obtain the failing input, it likely
 	// stems from a seed corpus entry added via f.Add. In that case, report
 	// that the failure happened while testing the seed corpus.
-	if failingInputString == "" {
-		failingInputString = seedCorpusErrMsg
+	failingTc := fmt.Sprintf("~~~sh\n%s\n~~~", seedCorpusErrMsg)
+	if failingInputString != "" {
+		failingTc = formatInput(failingInputString)
 	}
 
 	// Build the "Failing testcase" section.
-	failingTcSection := fmt.Sprintf("## Failing testcase\n~~~sh\n%s\n~~~",
-		failingInputString)
+	failingTcSection := "## Failing testcase\n" + failingTc
 
 	// Combine sections with the watermark at the end.
 	return fmt.Sprintf("%s\n%s\n%s\n", logSection, failingTcSection,
 		waterMark)
 }
 
+// formatKilledRunReport formats the issue body of a run killed before the
+// fuzzer could write the failing input: its last output, on the standard output
+// and the standard error, and the inputs the fuzzer added to the corpus last.
+// It has no failing testcase section, since none of the inputs is known to
+// reproduce the crash.
+func formatKilledRunReport(lastOutput, lastStderr string,
+	recentInputs []string) string {
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Last output\n~~~sh\n%s~~~", lastOutput)
+	fmt.Fprintf(&b, "%s\n", stderrSection(lastStderr))
+
+	b.WriteString("## Recent inputs\n")
+	if len(recentInputs) == 0 {
+		b.WriteString("The fuzzer added no inputs to the corpus " +
+			"during the run.\n")
+	} else {
+		b.WriteString("The run was killed before the fuzzer could " +
+			"write the failing input. These are the inputs it " +
+			"added to the corpus last, newest first:\n")
+	}
+	for _, input := range recentInputs {
+		fmt.Fprintf(&b, "%s\n", formatInput(input))
+	}
+
+	b.WriteString(waterMark + "\n")
+
+	return b.String()
+}
+
+// fitLogs truncates the logs of a crash report, first and second, so that they
+// take at most budget bytes together. A log shorter than half of the budget is
+// kept whole, leaving the rest of the budget to the other log.
+func fitLogs(first, second string, budget int) (string, string) {
+	budget = max(budget, 0)
+	half := budget / 2
+
+	switch {
+	case len(first)+len(second) <= budget:
+		return first, second
+
+	case len(first) <= half:
+		return first, truncateLog(second, budget-len(first))
+
+	case len(second) <= half:
+		return truncateLog(first, budget-len(second)), second
+	}
+
+	return truncateLog(first, half), truncateLog(second, budget-half)
+}
+
+// truncateLog returns the first whole lines of a log that fit in n bytes along
+// with truncatedLogNote, which ends them, or the log itself if it fits.
+func truncateLog(log string, n int) string {
+	if len(log) <= n {
+		return log
+	}
+
+	keep := max(n-len(truncatedLogNote), 0)
+	cut := strings.LastIndexByte(log[:keep], '\n') + 1
+
+	return log[:cut] + truncatedLogNote
+}
+
+// stderrSection returns the report section holding the standard error output
+// of a run, preceded by a newline, or an empty string if there is none.
+func stderrSection(stderr string) string {
+	if stderr == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("\n## Standard error\n~~~sh\n%s~~~", stderr)
+}
+
+// addRunLogLink adds a section linking the run log archived at logURL to a
+// crash report, before its watermark.
+func addRunLogLink(report, logURL string) string {
+	return addReportSection(report, fmt.Sprintf("## Run log\nThe full "+
+		"output of the run is archived at %s once the fuzzing cycle "+
+		"ends.\n", logURL))
+}
+
+// addReportSection adds a section to a crash report, before its watermark.
+func addReportSection(report, section string) string {
+	if section == "" {
+		return report
+	}
+
+	body, found := strings.CutSuffix(report, waterMark+"\n")
+	if !found {
+		return report + section
+	}
+
+	return body + section + waterMark + "\n"
+}
+
 // runGoCommand executes a `go` command with the given arguments in the
 // specified working directory. It appends any additional environment variables
 // provided via extraEnv to the current environment and returns the standard
@@ -213,3 +346,34 @@ func copyData(srcPath, destPath string) error {
 	// Recursively copy the source path contents into the dest path.
 	return cp.Copy(srcPath, destPath)
 }
+
+// writeFileAtomic writes the contents read from r to fullPath. The file is
+// written to a temporary file first and renamed into place, so that concurrent
+// readers never see a partial file.
+func writeFileAtomic(r io.Reader, fullPath string, mode fs.FileMode) error {
+	if err := EnsureDirExists(filepath.Dir(fullPath)); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating file for %q: %w", fullPath, err)
+	}
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode.Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fullPath)
+	}
+	if err != nil {
+		return fmt.Errorf("writing %q: %w", fullPath,
+			errors.Join(err, os.Remove(tmp.Name())))
+	}
+
+	return nil
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestSanitizeURL verifies that the sanitizeURL function correctly masks
@@ -132,6 +134,7 @@ func TestFormatCrashReport(t *testing.T) {
 	tests := []struct {
 		name               string
 		failingLog         string
+		stderrLog          string
 		failingInputString string
 		expectedReport     string
 	}{
@@ -144,6 +147,33 @@ func TestFormatCrashReport(t *testing.T) {
 				"--- FAIL: FuzzParseComplex\n" +
 				"~~~\n" +
 				"## Failing testcase\n" +
+				"<!-- input encoding=text size=28 sha256=" +
+				inputChecksum("go test fuzz v1\n"+
+					"string(\"0\")\n") +
+				" -->\n" +
+				"~~~sh\n" +
+				"go test fuzz v1\n" +
+				"string(\"0\")\n\n" +
+				"~~~\n" + waterMark + "\n",
+		},
+		{
+			name:               "with standard error output",
+			failingLog:         "--- FAIL: FuzzParseComplex\n",
+			stderrLog:          "panic: boom\n",
+			failingInputString: "go test fuzz v1\nstring(\"0\")\n",
+			expectedReport: "## Error logs\n" +
+				"~~~sh\n" +
+				"--- FAIL: FuzzParseComplex\n" +
+				"~~~\n" +
+				"## Standard error\n" +
+				"~~~sh\n" +
+				"panic: boom\n" +
+				"~~~\n" +
+				"## Failing testcase\n" +
+				"<!-- input encoding=text size=28 sha256=" +
+				inputChecksum("go test fuzz v1\n"+
+					"string(\"0\")\n") +
+				" -->\n" +
 				"~~~sh\n" +
 				"go test fuzz v1\n" +
 				"string(\"0\")\n\n" +
@@ -165,8 +195,92 @@ func TestFormatCrashReport(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			report := formatCrashReport(tt.failingLog,
-				tt.failingInputString)
+				tt.stderrLog, tt.failingInputString)
 			assert.Equal(t, tt.expectedReport, report)
 		})
 	}
 }
+
+// TestFitLogs verifies that the logs of a crash report are truncated to whole
+// lines fitting in their budget, the shorter log being kept whole if it fits
+// in half of it.
+func TestFitLogs(t *testing.T) {
+	short := "panic: boom\n"
+	long := strings.Repeat("goroutine 1 [running]:\n", 100)
+
+	first, second := fitLogs(short, long, 5000)
+	assert.Equal(t, short, first)
+	assert.Equal(t, long, second)
+
+	first, second = fitLogs(short, long, 200)
+	assert.Equal(t, short, first)
+	assert.True(t, strings.HasSuffix(second, "\n"+truncatedLogNote))
+	assert.LessOrEqual(t, len(second), 200-len(short))
+
+	first, second = fitLogs(long, long, 400)
+	assert.Equal(t, first, second)
+	assert.LessOrEqual(t, len(first)+len(second), 400)
+	assert.True(t, strings.HasPrefix(first, "goroutine 1 [running]:\n"))
+
+	first, second = fitLogs(long, "", -1)
+	assert.Equal(t, truncatedLogNote, first)
+	assert.Empty(t, second)
+}
+
+// TestFormatKilledRunReport verifies the report of a run killed before the
+// fuzzer wrote the failing input, which must have no failing testcase section
+// that issue verification would try to reproduce.
+func TestFormatKilledRunReport(t *testing.T) {
+	report := formatKilledRunReport("=== RUN FuzzFoo\n",
+		"fuzz: elapsed: 3s\n",
+		[]string{"go test fuzz v1\nstring(\"a\")"})
+	assert.Equal(t, "## Last output\n"+
+		"~~~sh\n"+
+		"=== RUN FuzzFoo\n"+
+		"~~~\n"+
+		"## Standard error\n"+
+		"~~~sh\n"+
+		"fuzz: elapsed: 3s\n"+
+		"~~~\n"+
+		"## Recent inputs\n"+
+		"The run was killed before the fuzzer could write the "+
+		"failing input. These are the inputs it added to the corpus "+
+		"last, newest first:\n"+
+		"<!-- input encoding=text size=27 sha256="+
+		inputChecksum("go test fuzz v1\nstring(\"a\")")+" -->\n"+
+		"~~~sh\n"+
+		"go test fuzz v1\n"+
+		"string(\"a\")\n"+
+		"~~~\n"+waterMark+"\n", report)
+
+	_, err := parseIssueBody(report)
+	assert.Error(t, err)
+}
+
+// TestAddRunLogLink verifies that the run log section is added before the
+// watermark, and leaves the failing testcase of the report intact.
+func TestAddRunLogLink(t *testing.T) {
+	report := addRunLogLink(formatCrashReport("--- FAIL: FuzzFoo\n", "",
+		"go test fuzz v1\n"),
+		"s3://bucket/logs/c1/parser/FuzzFoo.log.gz")
+
+	assert.True(t, strings.HasSuffix(report, "## Run log\n"+
+		"The full output of the run is archived at "+
+		"s3://bucket/logs/c1/parser/FuzzFoo.log.gz once the fuzzing "+
+		"cycle ends.\n"+waterMark+"\n"))
+
+	input, err := parseIssueBody(report)
+	require.NoError(t, err)
+	assert.Equal(t, "go test fuzz v1\n", input.data)
+	assert.True(t, input.complete())
+}
+
+// TestFormatCrashKind verifies the section describing the kind of a crash and
+// its detail, which unclassified failures do without.
+func TestFormatCrashKind(t *testing.T) {
+	assert.Equal(t, "## Crash kind\npanic\n~~~sh\nboom\n~~~\n",
+		formatCrashKind(crashKindPanic, "boom"))
+	assert.Equal(t, "## Crash kind\nout-of-memory\n",
+		formatCrashKind(crashKindOOM, ""))
+	assert.Empty(t, formatCrashKind(crashKindFailure, ""))
+}
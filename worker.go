@@ -1,43 +1,129 @@
 package main
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/docker/docker/client"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
-// Task represents a single fuzz target job, containing the package path and the
-// specific target name to execute.
+// Task represents a single fuzz target job, containing the package (and the
+// module it belongs to), the specific target name to execute and the Go
+// version it is built and run with (empty for the local toolchain).
 type Task struct {
-	PackagePath string
-	Target      string
+	Package   GoPackage
+	Target    string
+	GoVersion string
 }
 
-// TaskQueue is a simple FIFO queue for scheduling Task items.
+// binaryDir returns the directory holding the task's fuzz binary and testdata
+// below the given binary root directory. Binaries built with a specific Go
+// version are kept apart so that a fuzzing matrix never mixes them up.
+func (t Task) binaryDir(binaryRoot string) string {
+	if t.GoVersion == "" {
+		return filepath.Join(binaryRoot, t.Package.Path, t.Target)
+	}
+
+	return filepath.Join(binaryRoot, "go"+t.GoVersion, t.Package.Path,
+		t.Target)
+}
+
+// queuedTask is a task waiting in the TaskQueue together with its priority.
+type queuedTask struct {
+	task     Task
+	priority float64
+
+	// key orders the heap. It is the priority plus the aging bonus the
+	// task had accumulated when the queue was created, which is negative
+	// for tasks that started waiting later. Since every waiting task ages
+	// at the same rate, ordering by key is equivalent to ordering by aged
+	// priority at any point in time.
+	key float64
+
+	// seq is the insertion sequence number, which keeps equal keys in
+	// FIFO order.
+	seq int
+}
+
+// taskHeap is a max-heap of queued tasks implementing heap.Interface.
+type taskHeap []*queuedTask
+
+// Len returns the number of queued tasks.
+func (h taskHeap) Len() int { return len(h) }
+
+// Less orders tasks by descending key, then by insertion order.
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key > h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+
+// Swap swaps two queued tasks.
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Push appends a queued task to the heap.
+func (h *taskHeap) Push(x any) { *h = append(*h, x.(*queuedTask)) }
+
+// Pop removes and returns the last queued task of the heap.
+func (h *taskHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// TaskQueue is a priority queue for scheduling Task items. Tasks with a higher
+// priority are dequeued first. Waiting tasks age: their priority grows by
+// agingWeight per hour since they started waiting, so that no task starves
+// behind tasks with a higher priority. A task may have started waiting before
+// it was enqueued, such as a target waiting since its last fuzzing run.
 type TaskQueue struct {
-	mu    sync.Mutex
-	tasks []Task
+	mu          sync.Mutex
+	tasks       taskHeap
+	created     time.Time
+	agingWeight float64
+	seq         int
 }
 
-// NewTaskQueue returns an empty, initialized TaskQueue.
-func NewTaskQueue() *TaskQueue {
+// NewTaskQueue returns an empty, initialized TaskQueue whose tasks age with the
+// given weight per hour.
+func NewTaskQueue(agingWeight float64) *TaskQueue {
 	return &TaskQueue{
-		tasks: make([]Task, 0),
+		tasks:       make(taskHeap, 0),
+		created:     time.Now(),
+		agingWeight: agingWeight,
 	}
 }
 
-// Enqueue adds a new Task to the back of the queue.
-func (q *TaskQueue) Enqueue(t Task) {
+// Enqueue adds a new Task with the given priority to the queue. The task ages
+// from the given time on, or from now if the time is zero or in the future.
+func (q *TaskQueue) Enqueue(t Task, priority float64, waitingSince time.Time) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	q.tasks = append(q.tasks, t)
+	now := time.Now()
+	if waitingSince.IsZero() || waitingSince.After(now) {
+		waitingSince = now
+	}
+
+	waited := q.created.Sub(waitingSince).Hours()
+	heap.Push(&q.tasks, &queuedTask{
+		task:     t,
+		priority: priority,
+		key:      priority + q.agingWeight*waited,
+		seq:      q.seq,
+	})
+	q.seq++
 }
 
 // Length returns the current number of tasks in the queue.
@@ -48,8 +134,8 @@ func (q *TaskQueue) Length() int {
 	return len(q.tasks)
 }
 
-// Dequeue removes and returns the next Task from the queue. If the queue is
-// empty, it returns false for the second return value.
+// Dequeue removes and returns the Task with the highest aged priority. If the
+// queue is empty, it returns false for the second return value.
 func (q *TaskQueue) Dequeue() (Task, bool) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -57,23 +143,127 @@ func (q *TaskQueue) Dequeue() (Task, bool) {
 	if len(q.tasks) == 0 {
 		return Task{}, false
 	}
-	t := q.tasks[0]
-	q.tasks = q.tasks[1:]
-	return t, true
+	return heap.Pop(&q.tasks).(*queuedTask).task, true
+}
+
+// Ordering returns the queued tasks and their priorities in the order they
+// would be dequeued, without modifying the queue.
+func (q *TaskQueue) Ordering() ([]Task, []float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	h := append(taskHeap{}, q.tasks...)
+	tasks := make([]Task, 0, len(h))
+	priorities := make([]float64, 0, len(h))
+	for h.Len() > 0 {
+		qt := heap.Pop(&h).(*queuedTask)
+		tasks = append(tasks, qt.task)
+		priorities = append(priorities, qt.priority)
+	}
+
+	return tasks, priorities
+}
+
+// timePool collects the fuzzing time left unused by targets whose run ended
+// early, and hands it out to the targets fuzzed after them.
+type timePool struct {
+	mu       sync.Mutex
+	leftover time.Duration
+}
+
+// deposit adds unused fuzzing time to the pool.
+func (p *timePool) deposit(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.leftover += d
+}
+
+// take withdraws the share of the pooled time of a task that is about to run,
+// given the number of tasks still queued behind it. The time is split evenly,
+// so that the last task takes whatever is left.
+func (p *timePool) take(queued int) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	share := p.leftover / time.Duration(queued+1)
+	p.leftover -= share
+
+	return share
 }
 
 // WorkerGroup manages a group of fuzzing workers, their context, logger, Docker
-// client, configuration, shared task queue, per-task timeout, and if corpus
-// should be minimized or not.
+// client, configuration, shared task queue, per-task timeout, if corpus should
+// be minimized or not, the scheduling history of the targets, the retry policy
+// for transient failures, the report of the current cycle, the fuzzing time
+// left unused by targets, the worker slots taken by the shards of the running
+// targets and, in coordinator mode, the board through which the fuzzing runs
+// are handed to agents.
 type WorkerGroup struct {
 	ctx                  context.Context
 	logger               *slog.Logger
 	goGroup              *errgroup.Group
-	cli                  *client.Client
+	runner               Runner
 	cfg                  *Config
 	taskQueue            *TaskQueue
 	taskTimeout          time.Duration
 	shouldMinimizeCorpus bool
+	schedule             *scheduleTracker
+	retrier              *retrier
+	cycleReport          *CycleReport
+	spareTime            timePool
+
+	// modulePaths are the paths of the modules of the fuzzed project,
+	// whose frames identify the crashes.
+	modulePaths []string
+
+	// corpora keeps the versions of a fuzzing matrix from fuzzing a
+	// target while its shared corpus is copied or pruned.
+	corpora corpusLocks
+
+	// slots holds the CPUs of the workers, in thousandths of a CPU. A
+	// task takes the CPUs of its containers while it is processed, so
+	// that containers only run while their CPUs are free.
+	slots *semaphore.Weighted
+
+	// remote hands the fuzzing runs to agents in coordinator mode. It is
+	// nil when fuzz targets run in local containers.
+	remote *leaseBoard
+}
+
+// corpusLocks guards the corpora of the fuzz targets, which the versions of a
+// fuzzing matrix share. Fuzzing runs add inputs to a corpus side by side, while
+// copying it, for a coverage run or a minimization, and removing the inputs a
+// minimization dropped need it to themselves. The zero value is ready to use.
+type corpusLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+// get returns the lock of the corpus of the task's fuzz target.
+func (c *corpusLocks) get(task Task) *sync.RWMutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.locks == nil {
+		c.locks = make(map[string]*sync.RWMutex)
+	}
+	key := task.Package.Path + "/" + task.Target
+	if c.locks[key] == nil {
+		c.locks[key] = &sync.RWMutex{}
+	}
+
+	return c.locks[key]
+}
+
+// isPrimaryVersion reports whether the task is built with the first Go version
+// of the fuzzing matrix, or whether no matrix is configured.
+func (wg *WorkerGroup) isPrimaryVersion(task Task) bool {
+	if !isGoMatrix(wg.cfg) {
+		return true
+	}
+
+	return task.GoVersion == wg.cfg.Fuzz.GoVersions[0]
 }
 
 // WorkersStartAndWait starts the specified number of workers and waits for all
@@ -95,9 +285,9 @@ func (wg *WorkerGroup) WorkersStartAndWait(numWorkers int) error {
 }
 
 // runWorker pulls tasks from the taskQueue until it is empty or the worker
-// context is canceled:
-//   - Verifies and close any resolved GitHub issues related to the fuzz target.
-//   - Executes the fuzz target with a timeout.
+// context is canceled, and processes each of them. A task that permanently
+// fails is logged and recorded in the cycle report, and the worker moves on to
+// the next task so that a single failing target never cancels the cycle.
 func (wg *WorkerGroup) runWorker(workerID int) error {
 	for {
 		task, ok := wg.taskQueue.Dequeue()
@@ -107,162 +297,277 @@ func (wg *WorkerGroup) runWorker(workerID int) error {
 			return nil
 		}
 
-		wg.logger.Info(
-			"Worker starting issue verification", "workerID",
-			workerID, "package", task.PackagePath, "target",
-			task.Target,
-		)
+		pkg := task.Package.Path
 
-		// Initialize a GitHub client for issue verification.
-		gh, err := NewGitHubRepo(wg.ctx, wg.logger.With("target",
-			task.Target).With("package", task.PackagePath), wg.cli,
-			wg.cfg)
-		if err != nil {
-			return fmt.Errorf("error initializing GitHub client: "+
-				"%w", err)
+		// Wait until enough CPUs are free to run the containers of
+		// every shard of the task.
+		slots := taskSlots(&wg.cfg.Fuzz, task)
+		if err := wg.slots.Acquire(wg.ctx, slots); err != nil {
+			return nil
 		}
 
-		// The worker will verify and close any open GitHub issues
-		// related to the fuzz target.
-		err = gh.verifyAndCloseResolvedIssues(task.PackagePath,
-			task.Target)
+		err := wg.processTask(workerID, task)
+		wg.slots.Release(slots)
 		if err != nil {
 			if wg.ctx.Err() != nil {
 				return nil
 			}
-			return fmt.Errorf("failed to verify and close open "+
-				"issues: %w", err)
-		}
 
-		wg.logger.Info(
-			"Worker starting fuzzing", "workerID", workerID,
-			"package", task.PackagePath, "target", task.Target,
-			"timeout", wg.taskTimeout,
-		)
+			wg.logger.Error(
+				"Fuzz target failed; moving on to next task",
+				"workerID", workerID, "package", pkg,
+				"target", task.Target, "goVersion",
+				task.GoVersion, "error", err,
+			)
+			wg.cycleReport.addFailure(task, err)
+			continue
+		}
 
-		err = wg.executeFuzzTarget(task.PackagePath, task.Target, gh)
+		// Record the completion so that the target is deprioritized
+		// until it becomes stale again.
+		err = wg.schedule.markFuzzed(task,
+			wg.cycleReport.targetMetrics(task))
 		if err != nil {
-			if wg.ctx.Err() != nil {
-				return nil
-			}
-			return fmt.Errorf("worker %d: fuzz target %q/%q "+
-				"failed: %w", workerID, task.PackagePath,
-				task.Target, err)
+			return fmt.Errorf("recording schedule: %w", err)
 		}
 
 		wg.logger.Info(
 			"Worker completed fuzz target", "workerID", workerID,
-			"package", task.PackagePath, "target", task.Target,
+			"package", pkg, "target", task.Target,
 		)
 	}
 }
 
+// processTask handles a single task:
+//   - Verifies and close any resolved GitHub issues related to the fuzz target.
+//   - Executes the fuzz target with a timeout.
+//
+// Operations failing with transient errors are retried.
+func (wg *WorkerGroup) processTask(workerID int, task Task) error {
+	pkg := task.Package.Path
+
+	wg.logger.Info(
+		"Worker starting issue verification", "workerID", workerID,
+		"package", pkg, "module", task.Package.ModulePath, "target",
+		task.Target, "goVersion", task.GoVersion,
+	)
+
+	// Initialize a GitHub client for issue verification.
+	gh, err := NewGitHubRepo(wg.ctx, wg.logger.With("target",
+		task.Target).With("package", pkg), wg.runner, wg.cfg)
+	if err != nil {
+		return fmt.Errorf("error initializing GitHub client: %w", err)
+	}
+	gh.cycleID = wg.cycleReport.CycleID
+
+	// The worker will verify and close any open GitHub issues related to
+	// the fuzz target.
+	err = wg.retrier.do(wg.ctx, "issue verification", func() error {
+		return gh.verifyAndCloseResolvedIssues(task)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify and close open issues: %w",
+			err)
+	}
+
+	wg.logger.Info(
+		"Worker starting fuzzing", "workerID", workerID, "package", pkg,
+		"target", task.Target, "goVersion", task.GoVersion, "timeout",
+		wg.taskTimeout,
+	)
+
+	return wg.executeFuzzTarget(task, gh)
+}
+
 // executeFuzzTarget runs the specified fuzz target for a package using Docker.
 // It performs the following steps:
-//   - Starts the fuzzing container and streams its output.
-//   - Reports any fuzz crashes by creating a GitHub issue.
-//   - Updates the coverage report.
-//   - Optionally minimizes the corpus if configured.
-func (wg *WorkerGroup) executeFuzzTarget(pkg string, target string,
-	gh *GitHubRepo) error {
+//   - Starts the fuzzing container, or one container per shard of a sharded
+//     target, and streams its output, restarting it if the run fails with a
+//     transient error.
+//   - Reports any fuzz crashes by creating a GitHub issue, and, if configured,
+//     restarts the target for the rest of its time slice.
+//   - Updates the coverage report from a run of the corpus in a container.
+//   - Optionally minimizes the corpus if configured, in containers too.
+func (wg *WorkerGroup) executeFuzzTarget(task Task, gh *GitHubRepo) error {
+	pkg := task.Package.Path
+	target := task.Target
+
+	// Targets fuzzed after one whose run ended early share its unused
+	// time.
+	timeout := wg.taskTimeout + wg.spareTime.take(wg.taskQueue.Length())
 
 	wg.logger.Info("Executing fuzz target in Docker", "package", pkg,
-		"target", target, "duration", wg.taskTimeout)
-
-	// Construct the absolute path to the package directory within the
-	// temporary project directory on the host machine.
-	hostPkgPath := filepath.Join(wg.cfg.Project.SrcDir, pkg)
+		"target", target, "goVersion", task.GoVersion, "duration",
+		timeout)
 
 	// Define the path to store the corpus data generated during fuzzing on
 	// the host machine.
 	hostCorpusPath := filepath.Join(wg.cfg.Project.CorpusDir, pkg,
 		"testdata", "fuzz")
 
-	// Define the path to the fuzz target binary on the host machine that
-	// will be executed inside the container.
-	fuzzBinaryPath := filepath.Join(wg.cfg.Project.BinaryDir, pkg, target)
-
 	// Ensure that the corpus directory on the host machine exists to avoid
 	// permission errors when running the container as a non-root user.
 	if err := EnsureDirExists(hostCorpusPath); err != nil {
 		return err
 	}
 
-	// Prepare the arguments for the 'go test' command to run the specific
-	// fuzz target in container.
-	goTestCmd := []string{
-		fmt.Sprintf("./%s.test", target),
-		fmt.Sprintf("-test.fuzz=^%s$", target),
-		fmt.Sprintf("-test.fuzzcachedir=%s", ContainerCorpusPath),
-		"-test.parallel=1",
-	}
+	// Other versions of the target may fuzz its corpus at the same time,
+	// but not while it is minimized. Waiting for the lock does not count
+	// against the time slice.
+	corpusLock := wg.corpora.get(task)
+	corpusLock.RLock()
+	fuzzing := true
+	defer func() {
+		if fuzzing {
+			corpusLock.RUnlock()
+		}
+	}()
 
 	// Create a subcontext with timeout for this individual fuzz target.
-	fuzzCtx, cancel := context.WithTimeout(wg.ctx, wg.taskTimeout+
+	// Retries and restarts of the container run share this budget.
+	fuzzCtx, cancel := context.WithTimeout(wg.ctx, timeout+
 		ContainerGracePeriod)
 	defer cancel()
 
-	c := &Container{
-		ctx:            fuzzCtx,
-		logger:         wg.logger,
-		cli:            wg.cli,
-		fuzzBinaryPath: fuzzBinaryPath,
-		hostCorpusPath: hostCorpusPath,
-		cmd:            goTestCmd,
+	// Signatures of the distinct crashes found in this time slice.
+	var signatures []string
+	seen := make(map[string]bool)
+
+	shards := targetShards(&wg.cfg.Fuzz, pkg, target)
+
+	var crash *fuzzCrash
+	runContainer := func() error {
+		var err error
+		if shards > 1 {
+			crash, err = wg.runShards(fuzzCtx, task,
+				hostCorpusPath, shards)
+		} else {
+			crash, err = wg.runFuzzContainer(fuzzCtx, task,
+				hostCorpusPath, -1)
+		}
+		return err
 	}
 
-	// Start the fuzzing container.
-	containerID, err := c.Start()
-	if err != nil {
-		if fuzzCtx.Err() != nil {
-			return nil
+	for {
+		err := wg.retrier.do(fuzzCtx, "fuzz container run",
+			runContainer)
+		if err != nil && fuzzCtx.Err() == nil {
+			return err
+		}
+		if crash == nil {
+			break
 		}
-		return fmt.Errorf("error while starting container: %w", err)
-	}
-	defer c.Stop(containerID)
 
-	// Channels to receive either a fuzz failure or a container error.
-	fuzzCrashChan := make(chan fuzzCrash, 1)
-	errorChan := make(chan error, 1)
+		// A crash seen before means the fuzzer keeps finding the same
+		// bug, so restarting again is pointless.
+		signature := crash.signature(signatureOptions(&wg.cfg.Fuzz,
+			wg.modulePaths))
+		if seen[signature] {
+			wg.donateRemainingTime(fuzzCtx, task,
+				"crash found again")
+			break
+		}
+		seen[signature] = true
+		signatures = append(signatures, signature)
 
-	// Begin processing logs and wait for completion/failure signal in a
-	// goroutine.
-	go c.WaitAndGetLogs(containerID, pkg, target, fuzzCrashChan, errorChan)
+		// Report the fuzz crash, shrinking its failing input first
+		// unless it is already reported.
+		if err := wg.reportCrash(task, gh, crash); err != nil {
+			return fmt.Errorf("handling fuzz crash: %w", err)
+		}
 
-	select {
-	case <-fuzzCtx.Done():
-		// Context timeout or cancellation occurred.
+		if !wg.cfg.Fuzz.ContinueAfterCrash {
+			break
+		}
 
-	case err := <-errorChan:
-		if err != nil {
-			// Container exited with an error (non-fuzz crash).
-			return fmt.Errorf("fuzz execution failed: %w", err)
+		// A failing seed corpus entry, which the fuzzer did not write
+		// to a file, fails every restart before fuzzing begins.
+		if crash.kind == crashKindSeedCorpus {
+			wg.donateRemainingTime(fuzzCtx, task,
+				"seed corpus entry fails")
+			break
 		}
 
-	case fuzzCrash := <-fuzzCrashChan:
-		// Report the fuzz crash.
-		if err := gh.handleCrash(pkg, target, fuzzCrash); err != nil {
-			return fmt.Errorf("handling fuzz crash: %w", err)
+		// A run killed for running out of memory or hanging had no
+		// chance to write its failing input, which cannot be excluded
+		// then, so a restart would most likely be killed again.
+		killed := crash.kind == crashKindOOM ||
+			crash.kind == crashKindHang
+		if killed && crash.failingInputFile == "" {
+			wg.donateRemainingTime(fuzzCtx, task,
+				"killed run left no crasher to exclude")
+			break
+		}
+
+		// Exclude the crasher from the seed corpus of the next run, so
+		// that the fuzzer does not fail on it right away.
+		if crash.failingInputFile != "" {
+			err := os.Remove(crash.failingInputFile)
+			if err != nil {
+				return fmt.Errorf("removing crasher: %w", err)
+			}
 		}
+
+		remaining := remainingFuzzTime(fuzzCtx)
+		if remaining < MinRestartTime {
+			wg.donateRemainingTime(fuzzCtx, task,
+				"too little time left")
+			break
+		}
+
+		wg.logger.Info("Restarting fuzz target after crash", "package",
+			pkg, "target", target, "signature", signature,
+			"remaining", remaining)
+	}
+
+	corpusLock.RUnlock()
+	fuzzing = false
+
+	if len(signatures) > 0 {
+		wg.cycleReport.addCrashes(task, signatures)
 	}
 
 	wg.logger.Info("Fuzzing in Docker completed successfully", "package",
 		pkg, "target", target)
 
-	err = updateReport(wg.ctx, pkg, target, wg.cfg, wg.logger)
+	// In a fuzzing matrix, every version shares the target's corpus and
+	// reports, so only the first version updates the coverage report and
+	// minimizes the corpus.
+	if !wg.isPrimaryVersion(task) {
+		return nil
+	}
+
+	profilePath, err := wg.measureCoverage(task, gh)
 	if err != nil {
-		return fmt.Errorf("failed to add coverage report for package "+
-			"%s, target %s: %w", pkg, target, err)
+		return fmt.Errorf("failed to measure coverage for package %s, "+
+			"target %s: %w", pkg, target, err)
 	}
 
-	wg.logger.Info("Successfully added/updated coverage report", "package",
-		pkg, "target", target)
+	// The coverage is unknown if the fuzz target crashed on every input,
+	// or the cycle ended before it was measured.
+	if profilePath == "" {
+		wg.logger.Warn("Coverage runs ended without a profile; not "+
+			"updating the coverage report", "package", pkg,
+			"target", target)
+	} else {
+		err := updateReport(wg.ctx, task, wg.cfg,
+			wg.cycleReport.CycleID, profilePath,
+			wg.cycleReport.targetMetrics(task), wg.logger)
+		if err != nil {
+			return fmt.Errorf("failed to add coverage report for "+
+				"package %s, target %s: %w", pkg, target, err)
+		}
 
-	// Minimize the corpus if needed.
-	if wg.shouldMinimizeCorpus {
-		err := MinimizeCorpus(wg.ctx, wg.logger.With("target", target).
-			With("package", pkg), hostPkgPath, hostCorpusPath,
-			target)
+		wg.logger.Info("Successfully added/updated coverage report",
+			"package", pkg, "target", target)
+	}
+
+	// Minimize the corpus if needed, or resume its interrupted
+	// minimization.
+	if wg.shouldMinimizeCorpus ||
+		corpusMinimizationPending(wg.cfg.Project.ReportDir, task) {
+
+		err := wg.minimizeCorpus(task, gh)
 		if err != nil {
 			return fmt.Errorf("minimizing corpus for target %q: %w",
 				target, err)
@@ -271,3 +576,183 @@ func (wg *WorkerGroup) executeFuzzTarget(pkg string, target string,
 
 	return nil
 }
+
+// reportCrash files a crash of the task's fuzz target as an issue, after
+// minimizing its failing input, unless an issue is already open for it. The
+// fuzzer keeps finding a crash until it is fixed, so the lookup comes first,
+// sparing the minimization of the crashes already reported.
+func (wg *WorkerGroup) reportCrash(task Task, gh *GitHubRepo,
+	crash *fuzzCrash) error {
+
+	var reported bool
+	err := wg.retrier.do(wg.ctx, "crash lookup", func() error {
+		var err error
+		reported, err = gh.crashReported(task, *crash)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("checking existing GitHub issues: %w", err)
+	}
+
+	if reported {
+		wg.logger.Info("Fuzz crash already reported; skipping "+
+			"minimization", "package", task.Package.Path, "target",
+			task.Target, "signature", crash.signature(
+				signatureOptions(&wg.cfg.Fuzz, wg.modulePaths)))
+		return nil
+	}
+
+	wg.minimizeCrash(task, crash)
+
+	return wg.retrier.do(wg.ctx, "crash report", func() error {
+		return gh.fileCrash(task, *crash)
+	})
+}
+
+// remainingFuzzTime returns the fuzzing time left before the deadline of
+// fuzzCtx, excluding the container grace period.
+func remainingFuzzTime(fuzzCtx context.Context) time.Duration {
+	deadline, ok := fuzzCtx.Deadline()
+	if !ok {
+		return 0
+	}
+
+	return max(time.Until(deadline)-ContainerGracePeriod, 0)
+}
+
+// donateRemainingTime hands the fuzzing time left in the task's time slice over
+// to the tasks fuzzed after it, since restarting the task is pointless for the
+// given reason.
+func (wg *WorkerGroup) donateRemainingTime(fuzzCtx context.Context, task Task,
+	reason string) {
+
+	remaining := remainingFuzzTime(fuzzCtx)
+	wg.logger.Info("Not restarting fuzz target", "package",
+		task.Package.Path, "target", task.Target, "reason", reason,
+		"donatedTime", remaining)
+
+	wg.spareTime.deposit(remaining)
+}
+
+// runFuzzContainer runs the task's fuzz target until it crashes, exits or
+// fuzzCtx is done, either in a local container or, in coordinator mode, on an
+// agent, and archives its output in the run log of the given shard, negative
+// for unsharded targets. The metrics of the run are added to those of the task
+// in the cycle report. It returns the crash found, if any. The end of fuzzCtx
+// is not an error: it is how a fuzzing run normally ends.
+func (wg *WorkerGroup) runFuzzContainer(fuzzCtx context.Context, task Task,
+	hostCorpusPath string, shard int) (*fuzzCrash, error) {
+
+	// The fuzz target binary on the host machine that will be executed
+	// inside the container.
+	fuzzBinaryPath := task.binaryDir(wg.cfg.Project.BinaryDir)
+
+	pkg, target := task.Package.Path, task.Target
+	limits := resourceLimits(&wg.cfg.Fuzz, pkg, target)
+	sandbox := sandboxOptions(&wg.cfg.Fuzz, pkg, target)
+	image := targetImage(&wg.cfg.Fuzz, task)
+	logPath := runLogPath(wg.cfg.Project.ReportDir,
+		wg.cycleReport.CycleID, task, shard)
+	labels := taskLabels(wg.cfg, task, wg.cycleReport.CycleID)
+
+	var metrics metricsRecorder
+	var crash *fuzzCrash
+	var err error
+	if wg.remote != nil {
+		crash, err = wg.remote.run(fuzzCtx, task, image, limits,
+			sandbox, labels, fuzzBinaryPath, hostCorpusPath,
+			logPath, &metrics)
+	} else {
+		crash, err = runContainer(&Container{
+			ctx:            fuzzCtx,
+			logger:         wg.logger,
+			runner:         wg.runner,
+			image:          image,
+			fuzzBinaryPath: fuzzBinaryPath,
+			hostCorpusPath: hostCorpusPath,
+			cmd: fuzzCommand(task.Target,
+				limits.Parallel),
+			limits:   limits,
+			sandbox:  sandbox,
+			labels:   withOwnerLabels(wg.cfg, labels),
+			hang:     hangLimits(&wg.cfg.Fuzz),
+			logPath:  logPath,
+			metrics:  &metrics,
+			redactor: configRedactor(wg.cfg),
+		}, task)
+	}
+	if crash != nil {
+		crash.logPath = logPath
+	}
+	wg.cycleReport.addMetrics(task, metrics.result())
+
+	return crash, err
+}
+
+// fuzzCommand returns the arguments of the 'go test' command running the given
+// fuzz target in a container with the given number of fuzzing processes.
+func fuzzCommand(target string, parallel int) []string {
+	return []string{
+		fmt.Sprintf("./%s.test", target),
+		fmt.Sprintf("-test.fuzz=^%s$", target),
+		fmt.Sprintf("-test.fuzzcachedir=%s", ContainerCorpusPath),
+		fmt.Sprintf("-test.parallel=%d", parallel),
+	}
+}
+
+// runContainer starts the given fuzzing container and streams its output until
+// the fuzz target crashes, the container exits or the container context is
+// done. It returns the crash found, if any.
+func runContainer(c *Container, task Task) (*fuzzCrash, error) {
+	// Start the fuzzing container.
+	containerID, err := c.Start()
+	if err != nil {
+		if c.ctx.Err() != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error while starting container: %w",
+			err)
+	}
+
+	// The run log is closed only once the output stream ended, after the
+	// container was stopped, so that the next run appends to a complete
+	// log.
+	streamDone := make(chan struct{})
+	if c.logPath != "" {
+		c.runLog, err = openRunLog(c.logger, c.logPath)
+		if err != nil {
+			c.logger.Error("Failed to open run log", "error", err)
+		} else {
+			defer c.closeRunLog(streamDone)
+		}
+	}
+	defer c.Stop(containerID)
+
+	// Channels to receive either a fuzz failure or a container error.
+	fuzzCrashChan := make(chan fuzzCrash, 1)
+	errorChan := make(chan error, 1)
+
+	// Begin processing logs and wait for completion/failure signal in a
+	// goroutine.
+	go func() {
+		defer close(streamDone)
+		c.WaitAndGetLogs(containerID, task.Package.Path, task.Target,
+			fuzzCrashChan, errorChan)
+	}()
+
+	select {
+	case <-c.ctx.Done():
+		// Context timeout or cancellation occurred.
+		return nil, nil
+
+	case err := <-errorChan:
+		if err != nil {
+			// Container exited with an error (non-fuzz crash).
+			return nil, fmt.Errorf("fuzz execution failed: %w", err)
+		}
+		return nil, nil
+
+	case crash := <-fuzzCrashChan:
+		return &crash, nil
+	}
+}